@@ -0,0 +1,329 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/arunprasad2002/go-jwt/audit"
+	"github.com/arunprasad2002/go-jwt/config"
+	"github.com/arunprasad2002/go-jwt/controllers"
+	"github.com/arunprasad2002/go-jwt/database"
+	"github.com/arunprasad2002/go-jwt/health"
+	"github.com/arunprasad2002/go-jwt/helpers"
+	"github.com/arunprasad2002/go-jwt/keyring"
+	"github.com/arunprasad2002/go-jwt/logging"
+	"github.com/arunprasad2002/go-jwt/metrics"
+	"github.com/arunprasad2002/go-jwt/middleware"
+	"github.com/arunprasad2002/go-jwt/openapi"
+	"github.com/arunprasad2002/go-jwt/routes"
+	"github.com/arunprasad2002/go-jwt/store"
+	"github.com/arunprasad2002/go-jwt/tracing"
+	"github.com/arunprasad2002/go-jwt/webhook"
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
+)
+
+// App is one fully wired instance of the service. Nothing in it is global,
+// so several instances can live in the same process.
+type App struct {
+	Config   config.Config
+	Store    *store.Store
+	Accounts *helpers.Accounts
+	Audit    *audit.Recorder
+	Metrics  *metrics.Metrics
+	// Health runs the readiness checks, Register adds checks of further dependencies
+	Health *health.Checker
+	// Tracing is the provider of the app's spans, main makes it the global one
+	Tracing *tracing.Provider
+	// Webhooks sends the events of the webhook outbox once its Run loop is started
+	Webhooks *webhook.Dispatcher
+	Handler  *controllers.Handler
+	Router   *gin.Engine
+	// Logger writes JSON logs to stdout at LogLevel, which admins can change at runtime
+	Logger   *slog.Logger
+	LogLevel *slog.LevelVar
+}
+
+// New builds the application around an already opened store.
+func New(cfg config.Config, st *store.Store) (*App, error) {
+	tp, err := tracing.New(context.Background(), cfg.TracingExporter, cfg.TracingEndpoint, cfg.TracingServiceName)
+	if err != nil {
+		return nil, err
+	}
+	application, err := build(cfg, st, metrics.New(), tp)
+	if err != nil {
+		tp.Shutdown(context.Background())
+		return nil, err
+	}
+	return application, nil
+}
+
+func build(cfg config.Config, st *store.Store, m *metrics.Metrics, tp *tracing.Provider) (*App, error) {
+	level, err := logging.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+	logLevel := new(slog.LevelVar)
+	logLevel.Set(level)
+	logger := logging.New(os.Stdout, logLevel)
+
+	ring, err := keyring.Load(cfg.SigningKeyFile, cfg.VerificationKeyFiles)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := ring.Signing(); !ok {
+		logger.Warn("no signing key configured, tokens are signed with the HMAC secret and the JWK Set is empty")
+	}
+
+	sinks, err := audit.Open(cfg.AuditFile, cfg.AuditSyslogAddr)
+	if err != nil {
+		return nil, err
+	}
+	recorder := audit.NewRecorder(st.AuditEvents, sinks...)
+
+	checker := health.NewChecker()
+	checker.Register("store", st.Ping)
+	checker.Register("keyring", func(ctx context.Context) error {
+		if _, ok := ring.Signing(); !ok && cfg.SecretKey == "" {
+			return errors.New("no signing key loaded")
+		}
+		return nil
+	})
+	checker.Register("config", func(ctx context.Context) error {
+		return cfg.Validate()
+	})
+
+	accounts := helpers.NewAccounts(st, cfg.DeletionGracePeriod)
+	cookies := &helpers.Cookies{
+		Enabled:  cfg.CookieMode,
+		Domain:   cfg.CookieDomain,
+		Secure:   cfg.CookieSecure,
+		SameSite: sameSite(cfg.CookieSameSite),
+	}
+	handler := &controllers.Handler{
+		Store:       st,
+		Tokens:      helpers.NewTokens(cfg.SecretKey, ring, cfg.Issuer, cfg.Audiences, cfg.ClockSkew),
+		Accounts:    accounts,
+		Cookies:     cookies,
+		Audit:       recorder,
+		Metrics:     m,
+		Health:      checker,
+		DPoPClients: cfg.DPoPRequiredClients,
+		GoogleOAuth: controllers.GoogleOAuthConfig(cfg.GoogleClientID, cfg.GoogleClientSecret, cfg.GoogleRedirectURL),
+		FrontendURL: cfg.FrontendURL,
+		LogLevel:    logLevel,
+
+		WebhooksAllowInsecure: cfg.WebhooksAllowInsecure,
+	}
+
+	// The routes are registered and documented from the same table
+	api := routes.API(handler)
+	document, err := openapi.Build(api)
+	if err != nil {
+		return nil, err
+	}
+	handler.OpenAPIDocument = document
+
+	// Initialize Gin router, requests are logged as JSON by RequestLogger instead of Gin's logger.
+	// Every request gets a span first, so its log line can name the trace. Probes and scrapes are not traced.
+	router := gin.New()
+	router.Use(
+		otelgin.Middleware(cfg.TracingServiceName, otelgin.WithTracerProvider(tp), otelgin.WithPropagators(tracing.Propagator),
+			otelgin.WithFilter(func(r *http.Request) bool {
+				return r.URL.Path != "/healthz" && r.URL.Path != "/readyz" && r.URL.Path != "/metrics"
+			})),
+		middleware.RequestLogger(logger), middleware.Recovery(), middleware.Metrics(m),
+	)
+
+	// Configure CORS
+	corsConfig := cors.DefaultConfig()
+	if len(cfg.CORSOrigins) > 0 {
+		corsConfig.AllowOrigins = cfg.CORSOrigins
+	} else {
+		corsConfig.AllowAllOrigins = true
+	}
+	corsConfig.AllowCredentials = true
+	corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	corsConfig.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization", "token", "X-API-Key", helpers.DPoPHeader, helpers.CSRFTokenHeader, middleware.RequestIDHeader, "traceparent", "tracestate", "baggage"}
+	corsConfig.ExposeHeaders = []string{"WWW-Authenticate", middleware.RequestIDHeader}
+	router.Use(cors.New(corsConfig))
+
+	// Initialize routes, metrics are scraped without a token
+	routes.Register(router, handler, api)
+	router.NoRoute(handler.NoRoute())
+
+	return &App{
+		Config:   cfg,
+		Store:    st,
+		Accounts: accounts,
+		Audit:    recorder,
+		Metrics:  m,
+		Health:   checker,
+		Tracing:  tp,
+		Webhooks: webhook.NewDispatcher(st, cfg.WebhooksAllowInsecure),
+		Handler:  handler,
+		Router:   router,
+		Logger:   logger,
+		LogLevel: logLevel,
+	}, nil
+}
+
+func sameSite(mode string) http.SameSite {
+	switch mode {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
+
+// Open opens the store selected by cfg and builds the application on it.
+func Open(ctx context.Context, cfg config.Config) (*App, error) {
+	m := metrics.New()
+	tp, err := tracing.New(ctx, cfg.TracingExporter, cfg.TracingEndpoint, cfg.TracingServiceName)
+	if err != nil {
+		return nil, err
+	}
+	monitor := database.CombineMonitors(m.MongoMonitor(), otelmongo.NewMonitor(otelmongo.WithTracerProvider(tp)))
+	st, err := database.OpenStore(ctx, cfg, monitor)
+	if err != nil {
+		tp.Shutdown(ctx)
+		return nil, err
+	}
+	application, err := build(cfg, st, m, tp)
+	if err != nil {
+		st.Close(ctx)
+		tp.Shutdown(ctx)
+		return nil, err
+	}
+	return application, nil
+}
+
+// Run serves HTTP, or HTTPS when a TLS certificate is configured, on the
+// configured port and runs the background jobs until ctx is done or the server
+// fails. Then it shuts down gracefully: readiness starts failing, after the
+// shutdown delay new connections are refused, requests in flight are drained
+// and the background jobs are stopped, all within the shutdown timeout. The
+// store stays open, Close releases it.
+func (a *App) Run(ctx context.Context) error {
+	server, err := a.Server()
+	if err != nil {
+		return err
+	}
+
+	// The jobs outlive ctx until the requests in flight are drained
+	jobsCtx, stopJobs := context.WithCancel(context.WithoutCancel(ctx))
+	defer stopJobs()
+	var jobs sync.WaitGroup
+	jobs.Add(2)
+	go func() {
+		defer jobs.Done()
+		// Purge accounts whose deletion grace period has ended
+		a.Accounts.RunPurgeJob(jobsCtx, time.Hour)
+	}()
+	go func() {
+		defer jobs.Done()
+		// Send webhook events
+		a.Webhooks.Run(jobsCtx, 5*time.Second)
+	}()
+
+	served := make(chan error, 1)
+	go func() {
+		if a.Config.TLSCertFile == "" {
+			served <- server.ListenAndServe()
+		} else {
+			served <- server.ListenAndServeTLS(a.Config.TLSCertFile, a.Config.TLSKeyFile)
+		}
+	}()
+	a.Logger.Info("server running", "port", a.Config.Port)
+
+	select {
+	case err := <-served:
+		stopJobs()
+		jobs.Wait()
+		return err
+	case <-ctx.Done():
+	}
+
+	a.Logger.Info("shutting down", "delay", a.Config.ShutdownDelay.String(), "timeout", a.Config.ShutdownTimeout.String())
+	a.Health.SetShuttingDown()
+	time.Sleep(a.Config.ShutdownDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), a.Config.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		stopJobs()
+		return fmt.Errorf("draining requests: %w", err)
+	}
+	stopJobs()
+	stopped := make(chan struct{})
+	go func() {
+		jobs.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-shutdownCtx.Done():
+		return errors.New("background jobs did not stop within the shutdown timeout")
+	}
+	a.Logger.Info("server stopped")
+	return nil
+}
+
+// Server returns the HTTP server of the app, with the configured timeouts and TLS settings.
+func (a *App) Server() (*http.Server, error) {
+	server := &http.Server{
+		Addr:         ":" + a.Config.Port,
+		Handler:      a.Router,
+		ReadTimeout:  a.Config.ReadTimeout,
+		WriteTimeout: a.Config.WriteTimeout,
+		IdleTimeout:  a.Config.IdleTimeout,
+		ErrorLog:     slog.NewLogLogger(a.Logger.Handler(), slog.LevelWarn),
+	}
+	if a.Config.TLSCertFile != "" {
+		tlsConfig, err := ServerTLSConfig(a.Config)
+		if err != nil {
+			return nil, err
+		}
+		server.TLSConfig = tlsConfig
+	}
+	return server, nil
+}
+
+// ServerTLSConfig returns the TLS settings of the server. With a client CA,
+// client certificates are requested and verified when presented, but clients
+// without one can still connect.
+func ServerTLSConfig(cfg config.Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.TLSClientCAFile == "" {
+		return tlsConfig, nil
+	}
+	encoded, err := os.ReadFile(cfg.TLSClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(encoded) {
+		return nil, fmt.Errorf("%s: no PEM certificates found", cfg.TLSClientCAFile)
+	}
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	return tlsConfig, nil
+}
+
+// Close closes the audit sinks, flushes buffered spans and releases the store's connections.
+func (a *App) Close(ctx context.Context) error {
+	return errors.Join(a.Audit.Close(), a.Tracing.Shutdown(ctx), a.Store.Close(ctx))
+}
@@ -0,0 +1,55 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/arunprasad2002/go-jwt/config"
+	"github.com/arunprasad2002/go-jwt/store"
+	"github.com/gin-gonic/gin"
+)
+
+func TestRoutesDocumented(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name string
+		// register adds routes outside the route table
+		register func(router *gin.Engine)
+		// want is part of the error, empty if the routes match the document
+		want string
+	}{
+		{name: "route table"},
+		{
+			name: "route missing from the document",
+			register: func(router *gin.Engine) {
+				router.GET("/users/:user_id/sessions", func(c *gin.Context) { c.Status(http.StatusOK) })
+			},
+			want: "GET /users/:user_id/sessions",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.SecretKey = strings.Repeat("k", 32)
+			cfg.LogLevel = "error"
+			application, err := New(cfg, store.NewMemoryStore())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer application.Close(context.Background())
+			if tt.register != nil {
+				tt.register(application.Router)
+			}
+
+			err = application.Handler.OpenAPIDocument.Check(application.Router.Routes())
+			switch {
+			case tt.want == "" && err != nil:
+				t.Fatal(err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Fatalf("Check() = %v, want an error naming %s", err, tt.want)
+			}
+		})
+	}
+}
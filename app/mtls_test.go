@@ -0,0 +1,197 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arunprasad2002/go-jwt/config"
+	"github.com/arunprasad2002/go-jwt/helpers"
+	"github.com/arunprasad2002/go-jwt/models"
+	"github.com/arunprasad2002/go-jwt/pki"
+	"github.com/arunprasad2002/go-jwt/store"
+	"github.com/gin-gonic/gin"
+)
+
+func TestMutualTLS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	ca, err := pki.NewAuthority("go-jwt test CA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rogueCA, err := pki.NewAuthority("rogue CA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverCert, err := ca.IssueServer("localhost", []string{"127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	issue := func(authority *pki.Authority, name string) *pki.Issued {
+		issued, err := authority.IssueClient(pkix.Name{CommonName: name, Organization: []string{"Example"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return issued
+	}
+	billing, otherClient, rogue := issue(ca, "billing"), issue(ca, "reporting"), issue(rogueCA, "billing")
+
+	cfg := config.Default()
+	cfg.SecretKey = strings.Repeat("k", 32)
+	cfg.LogLevel = "error"
+	cfg.TLSCertFile = writeFile(t, dir, "server.pem", serverCert.CertPEM)
+	cfg.TLSKeyFile = writeFile(t, dir, "server-key.pem", serverCert.KeyPEM)
+	cfg.TLSClientCAFile = writeFile(t, dir, "ca.pem", ca.CertPEM())
+	st := store.NewMemoryStore()
+	now := time.Now().UTC()
+	if err := st.ServiceAccounts.Create(ctx, &models.ServiceAccount{
+		Client_id:                  "billing",
+		Name:                       "Billing",
+		Scopes:                     []string{helpers.ScopeUsersRead},
+		Tls_client_auth_subject_dn: billing.Cert.Subject.String(),
+		Created_at:                 now,
+		Updated_at:                 now,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	application, err := New(cfg, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer application.Close(ctx)
+	server, err := application.Server()
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.ServeTLS(listener, cfg.TLSCertFile, cfg.TLSKeyFile)
+	defer server.Close()
+	baseURL := "https://" + listener.Addr().String()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+	// client presents cert, or no certificate if it is nil
+	client := func(t *testing.T, cert *pki.Issued) *http.Client {
+		tlsConfig := &tls.Config{RootCAs: roots}
+		if cert != nil {
+			pair, err := tls.X509KeyPair(cert.CertPEM, cert.KeyPEM)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Sent even if the server does not list its issuer as acceptable
+			tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				return &pair, nil
+			}
+		}
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	}
+	requestToken := func(t *testing.T, cert *pki.Issued) (*http.Response, error) {
+		form := url.Values{"grant_type": {"client_credentials"}, "client_id": {"billing"}}
+		return client(t, cert).PostForm(baseURL+"/oauth/token", form)
+	}
+
+	tokenTests := []struct {
+		name string
+		cert *pki.Issued
+		// wantStatus is the status of the token endpoint, 0 if the handshake must fail
+		wantStatus int
+	}{
+		{name: "certificate with the subject of the account", cert: billing, wantStatus: http.StatusOK},
+		{name: "certificate of another client", cert: otherClient, wantStatus: http.StatusUnauthorized},
+		{name: "no certificate", wantStatus: http.StatusUnauthorized},
+		{name: "certificate of an untrusted CA", cert: rogue},
+	}
+	for _, tt := range tokenTests {
+		t.Run("token/"+tt.name, func(t *testing.T) {
+			res, err := requestToken(t, tt.cert)
+			if tt.wantStatus == 0 {
+				if err == nil {
+					res.Body.Close()
+					t.Fatalf("status = %d, want the handshake refused", res.StatusCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			if res.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", res.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+
+	// The token issued over the billing connection is bound to its certificate
+	res, err := requestToken(t, billing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var issued struct {
+		Access_token string `json:"access_token"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&issued)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := application.Handler.Tokens.ValidateToken(ctx, issued.Access_token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !claims.CertificateBound() || claims.Cnf.X5tS256 != helpers.CertificateThumbprint(billing.Cert) {
+		t.Fatalf("cnf = %+v, want the thumbprint of the billing certificate", claims.Cnf)
+	}
+
+	useTests := []struct {
+		name       string
+		cert       *pki.Issued
+		wantStatus int
+	}{
+		{name: "certificate the token is bound to", cert: billing, wantStatus: http.StatusOK},
+		{name: "certificate of another client", cert: otherClient, wantStatus: http.StatusUnauthorized},
+		{name: "no certificate", wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range useTests {
+		t.Run("bound token/"+tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, baseURL+"/users", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+issued.Access_token)
+			res, err := client(t, tt.cert).Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			if res.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", res.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func writeFile(t *testing.T, dir string, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
@@ -0,0 +1,263 @@
+// Package audit keeps the security audit log: who logged in or failed to, who
+// got tokens, and who read or changed which accounts.
+//
+// Events are appended to the store as a hash chain. Each event's hash covers
+// its contents and the hash of the event before it, so Verify notices events
+// that were changed or removed after the fact. A Recorder also copies every
+// event to its sinks, such as a JSON lines file or syslog, for a SIEM.
+//
+// Requests do not wait for the store: a Recorder queues their events for a
+// single writer, which keeps the end of the chain in memory and only reads it
+// back from the store when another instance appended in between.
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/arunprasad2002/go-jwt/logging"
+	"github.com/arunprasad2002/go-jwt/models"
+	"github.com/arunprasad2002/go-jwt/store"
+)
+
+// Actions recorded in the audit log.
+const (
+	ActionSignup                 = "user.signup"
+	ActionLogin                  = "auth.login"
+	ActionLogout                 = "auth.logout"
+	ActionTokenIssued            = "token.issued"
+	ActionSessionRevoked         = "session.revoked"
+	ActionUserRead               = "user.read"
+	ActionUserList               = "user.list"
+	ActionUserDeactivated        = "user.deactivated"
+	ActionUserReactivated        = "user.reactivated"
+	ActionUserTypeChanged        = "user.type_changed"
+	ActionEmailChanged           = "user.email_changed"
+	ActionAccountDeleted         = "account.deleted"
+	ActionAccountExported        = "account.exported"
+	ActionAPIKeyCreated          = "api_key.created"
+	ActionAPIKeyRevoked          = "api_key.revoked"
+	ActionServiceAccountCreated  = "service_account.created"
+	ActionServiceAccountRotated  = "service_account.secret_rotated"
+	ActionServiceAccountDisabled = "service_account.disabled"
+	ActionDeviceApproved         = "device.approved"
+	ActionDeviceDenied           = "device.denied"
+	ActionLogLevelChanged        = "log_level.changed"
+	ActionAuditRead              = "audit.read"
+	ActionWebhookCreated         = "webhook.created"
+	ActionWebhookDeleted         = "webhook.deleted"
+	ActionWebhookRedelivered     = "webhook.redelivered"
+)
+
+// Kinds of targets an event can be about.
+const (
+	TargetUser                = "user"
+	TargetSession             = "session"
+	TargetServiceAccount      = "service_account"
+	TargetAPIKey              = "api_key"
+	TargetDeviceAuthorization = "device_authorization"
+	TargetWebhook             = "webhook"
+	TargetWebhookDelivery     = "webhook_delivery"
+)
+
+// ErrChainBroken is returned by Verify for an event that does not match its
+// hash or does not follow the event before it.
+var ErrChainBroken = errors.New("audit chain is broken")
+
+// appendAttempts bounds retries when other instances append at the same time
+const appendAttempts = 5
+
+// verifyPageSize is how many events Verify loads at once
+const verifyPageSize = 500
+
+// queueSize is how many events can wait for the writer before Record blocks
+const queueSize = 1024
+
+// appendTimeout bounds storing one event
+const appendTimeout = 10 * time.Second
+
+// ErrClosed is returned by Record once the Recorder is closed.
+var ErrClosed = errors.New("audit recorder is closed")
+
+// Recorder appends events to the audit log and copies them to its sinks.
+type Recorder struct {
+	events store.AuditEventStore
+	sinks  []Sink
+
+	// mu guards closing the queue, Record holds it shared while queueing
+	mu     sync.RWMutex
+	closed bool
+	queue  chan queuedEvent
+	done   chan struct{}
+}
+
+// queuedEvent is an event waiting for the writer. ctx carries the logger of
+// the request that recorded it.
+type queuedEvent struct {
+	ctx   context.Context
+	event models.AuditEvent
+}
+
+// NewRecorder returns a Recorder storing events in events. Close stops its writer.
+func NewRecorder(events store.AuditEventStore, sinks ...Sink) *Recorder {
+	r := &Recorder{
+		events: events,
+		sinks:  sinks,
+		queue:  make(chan queuedEvent, queueSize),
+		done:   make(chan struct{}),
+	}
+	go r.write()
+	return r
+}
+
+// Record timestamps event and queues it for the writer, which links it to the
+// end of the chain, stores it and copies it to the sinks. It only waits while
+// the queue is full. The writer logs events it fails to store; sink failures
+// are logged as well but the stored event is authoritative.
+func (r *Recorder) Record(ctx context.Context, event models.AuditEvent) error {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	// Every backend keeps milliseconds, so the hash survives a round trip
+	event.Time = event.Time.UTC().Truncate(time.Millisecond)
+	// The caller may reuse its map once the event is queued
+	event.Details = maps.Clone(event.Details)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed {
+		return ErrClosed
+	}
+	// The event is stored after the request is done, keep its logger but not its deadline
+	queued := queuedEvent{ctx: context.WithoutCancel(ctx), event: event}
+	select {
+	case r.queue <- queued:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// write stores the queued events in order until the queue is closed
+func (r *Recorder) write() {
+	defer close(r.done)
+
+	// last is the end of the chain, nil when it has to be read from the store
+	var last *models.AuditEvent
+	for queued := range r.queue {
+		ctx, cancel := context.WithTimeout(queued.ctx, appendTimeout)
+		event, err := r.append(ctx, queued.event, last)
+		cancel()
+		if err != nil {
+			// The event may have been stored regardless, so read the end of the chain again
+			last = nil
+			logging.FromContext(queued.ctx).Error("failed to record audit event", "action", queued.event.Action, "error", err)
+			continue
+		}
+		last = event
+
+		for _, sink := range r.sinks {
+			if err := sink.Write(event); err != nil {
+				logging.FromContext(queued.ctx).Error("failed to copy audit event to sink", "sequence", event.Sequence, "error", err)
+			}
+		}
+	}
+}
+
+// append links event to last and stores it. When last is nil or another
+// instance appended after it, the end of the chain is read from the store.
+func (r *Recorder) append(ctx context.Context, event models.AuditEvent, last *models.AuditEvent) (*models.AuditEvent, error) {
+	for attempt := 1; ; attempt++ {
+		if last == nil {
+			stored, err := r.events.Last(ctx)
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				last = &models.AuditEvent{}
+			case err != nil:
+				return nil, err
+			default:
+				last = stored
+			}
+		}
+		event.Sequence, event.Prev_hash = last.Sequence+1, last.Hash
+		event.Hash = Hash(event)
+
+		err := r.events.Append(ctx, &event)
+		// Another instance took the sequence number, link to its event instead
+		if errors.Is(err, store.ErrConflict) && attempt < appendAttempts {
+			last = nil
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &event, nil
+	}
+}
+
+// List returns the stored events matching query.
+func (r *Recorder) List(ctx context.Context, query store.AuditQuery) ([]models.AuditEvent, error) {
+	return r.events.List(ctx, query)
+}
+
+// Verify checks the whole chain and returns the number of events checked. The
+// first event that was changed, or that follows a removed one, fails it with
+// ErrChainBroken. Removing events from the end of the chain is not detected.
+func (r *Recorder) Verify(ctx context.Context) (int64, error) {
+	var checked int64
+	prevHash := ""
+	for {
+		events, err := r.events.List(ctx, store.AuditQuery{After: checked, Limit: verifyPageSize})
+		if err != nil {
+			return checked, err
+		}
+		for _, event := range events {
+			if event.Sequence != checked+1 {
+				return checked, fmt.Errorf("%w: event %d is missing", ErrChainBroken, checked+1)
+			}
+			if event.Prev_hash != prevHash || Hash(event) != event.Hash {
+				return checked, fmt.Errorf("%w: event %d does not match its hash", ErrChainBroken, event.Sequence)
+			}
+			prevHash = event.Hash
+			checked = event.Sequence
+		}
+		if len(events) < verifyPageSize {
+			return checked, nil
+		}
+	}
+}
+
+// Close stores the events still queued and closes the sinks.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.queue)
+	}
+	r.mu.Unlock()
+	<-r.done
+
+	var errs []error
+	for _, sink := range r.sinks {
+		errs = append(errs, sink.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Hash returns the SHA-256 hash chaining event to its predecessor: it covers
+// every field but Hash itself, including Prev_hash.
+func Hash(event models.AuditEvent) string {
+	event.Hash = ""
+	event.Time = event.Time.UTC()
+	// Events only hold strings, numbers and a time, which always encode
+	encoded, _ := json.Marshal(event)
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
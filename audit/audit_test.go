@@ -0,0 +1,50 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/arunprasad2002/go-jwt/models"
+	"github.com/arunprasad2002/go-jwt/store"
+)
+
+func TestRecorderChainsConcurrentEvents(t *testing.T) {
+	ctx := context.Background()
+	events := store.NewMemoryStore().AuditEvents
+	// Two instances of the service share the store
+	first, second := NewRecorder(events), NewRecorder(events)
+
+	const perInstance = 50
+	var wg sync.WaitGroup
+	for i := 0; i < perInstance; i++ {
+		for _, r := range []*Recorder{first, second} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := r.Record(ctx, models.AuditEvent{Action: ActionLogin, Outcome: models.AuditSuccess}); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	// Closing stores the events still queued
+	for _, r := range []*Recorder{first, second} {
+		if err := r.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checked, err := first.Verify(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checked != 2*perInstance {
+		t.Errorf("Verify() checked %d events, want %d", checked, 2*perInstance)
+	}
+	if err := first.Record(ctx, models.AuditEvent{Action: ActionLogin}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Record() after Close() = %v, want %v", err, ErrClosed)
+	}
+}
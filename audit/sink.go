@@ -0,0 +1,86 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/arunprasad2002/go-jwt/models"
+)
+
+// Sink receives a copy of every recorded event.
+type Sink interface {
+	Write(event *models.AuditEvent) error
+	Close() error
+}
+
+// FileSink appends events to a file as JSON lines.
+type FileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileSink opens path for appending, creating it readable only by the service.
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{file: file}, nil
+}
+
+func (s *FileSink) Write(event *models.AuditEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.file.Write(append(line, '\n'))
+	return err
+}
+
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
+
+// NewSyslogSink sends events as JSON messages to syslog at addr: "local" for
+// the local daemon, or udp://host:port or tcp://host:port for a remote one.
+func NewSyslogSink(addr string) (Sink, error) {
+	if addr == "local" {
+		return dialSyslog("", "")
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "udp" && u.Scheme != "tcp") || u.Host == "" {
+		return nil, fmt.Errorf("syslog address must be local, udp://host:port or tcp://host:port, got %q", addr)
+	}
+	return dialSyslog(u.Scheme, u.Host)
+}
+
+// Open returns a sink for each configured destination.
+func Open(file string, syslogAddr string) ([]Sink, error) {
+	var sinks []Sink
+	if file != "" {
+		sink, err := NewFileSink(file)
+		if err != nil {
+			return nil, fmt.Errorf("opening audit file: %w", err)
+		}
+		sinks = append(sinks, sink)
+	}
+	if syslogAddr != "" {
+		sink, err := NewSyslogSink(syslogAddr)
+		if err != nil {
+			for _, opened := range sinks {
+				opened.Close()
+			}
+			return nil, fmt.Errorf("connecting to audit syslog: %w", err)
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
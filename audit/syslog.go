@@ -0,0 +1,38 @@
+//go:build !windows && !plan9
+
+package audit
+
+import (
+	"encoding/json"
+	"log/syslog"
+
+	"github.com/arunprasad2002/go-jwt/models"
+)
+
+// syslogSink writes events to the auth facility, failures as warnings
+type syslogSink struct {
+	writer *syslog.Writer
+}
+
+func dialSyslog(network string, addr string) (Sink, error) {
+	writer, err := syslog.Dial(network, addr, syslog.LOG_AUTH|syslog.LOG_INFO, "go-jwt")
+	if err != nil {
+		return nil, err
+	}
+	return &syslogSink{writer: writer}, nil
+}
+
+func (s *syslogSink) Write(event *models.AuditEvent) error {
+	message, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if event.Outcome == models.AuditFailure {
+		return s.writer.Warning(string(message))
+	}
+	return s.writer.Info(string(message))
+}
+
+func (s *syslogSink) Close() error {
+	return s.writer.Close()
+}
@@ -0,0 +1,11 @@
+//go:build windows || plan9
+
+package audit
+
+import (
+	"errors"
+)
+
+func dialSyslog(network string, addr string) (Sink, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
@@ -0,0 +1,234 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Config holds every setting the service needs to start.
+//
+// Each field is described by struct tags: key is its name in config files
+// (dots nest sections) and on the command line, env is the environment
+// variable that sets it, and secret marks values that are masked when the
+// configuration is printed redacted. secret:"url" masks only the password
+// of a URL.
+type Config struct {
+	Port    string `key:"port" env:"PORT" usage:"HTTP port to listen on"`
+	GinMode string `key:"gin_mode" env:"GIN_MODE" usage:"Gin mode: debug, release or test"`
+	// LogLevel is the level at startup, admins can change it at runtime
+	LogLevel string `key:"log.level" env:"LOG_LEVEL" usage:"minimum level of logged messages: debug, info, warn or error"`
+
+	// Connection timeouts of the HTTP server. On SIGTERM or SIGINT readiness fails first, after
+	// ShutdownDelay new connections are refused and requests in flight get ShutdownTimeout to finish.
+	ReadTimeout     time.Duration `key:"server.read_timeout" env:"SERVER_READ_TIMEOUT" usage:"maximum time to read a request, including its body"`
+	WriteTimeout    time.Duration `key:"server.write_timeout" env:"SERVER_WRITE_TIMEOUT" usage:"maximum time from the end of the request headers to the end of the response"`
+	IdleTimeout     time.Duration `key:"server.idle_timeout" env:"SERVER_IDLE_TIMEOUT" usage:"how long idle keep-alive connections are kept open"`
+	ShutdownDelay   time.Duration `key:"server.shutdown_delay" env:"SERVER_SHUTDOWN_DELAY" usage:"how long to keep serving with failing readiness after a shutdown signal, so load balancers stop sending traffic"`
+	ShutdownTimeout time.Duration `key:"server.shutdown_timeout" env:"SERVER_SHUTDOWN_TIMEOUT" usage:"how long requests in flight and background jobs get to finish on shutdown"`
+
+	// TLS is terminated by the service itself when a certificate is set. With a client CA,
+	// clients may authenticate with certificates and get certificate bound tokens.
+	TLSCertFile     string `key:"server.tls_cert_file" env:"TLS_CERT_FILE" usage:"PEM certificate chain to serve HTTPS with"`
+	TLSKeyFile      string `key:"server.tls_key_file" env:"TLS_KEY_FILE" usage:"PEM private key of the TLS certificate"`
+	TLSClientCAFile string `key:"server.tls_client_ca_file" env:"TLS_CLIENT_CA_FILE" usage:"PEM CA certificates client certificates are verified against"`
+
+	SecretKey string `key:"auth.secret_key" env:"SECRET_KEY" secret:"true" usage:"HMAC key used to sign tokens (at least 32 bytes)"`
+
+	// Registered claims: iss, and the aud values clients may ask for (the first is the default)
+	Issuer    string        `key:"auth.issuer" env:"TOKEN_ISSUER" usage:"iss claim of issued tokens, required when validating"`
+	Audiences []string      `key:"auth.audiences" env:"TOKEN_AUDIENCES" usage:"comma separated client audiences tokens may be issued for, the first is the default"`
+	ClockSkew time.Duration `key:"auth.clock_skew" env:"TOKEN_CLOCK_SKEW" usage:"leeway allowed when checking exp, nbf and iat"`
+
+	// Clients listed here must bind their tokens to a DPoP key, it is optional for everyone else
+	DPoPRequiredClients []string `key:"auth.dpop_required_clients" env:"DPOP_REQUIRED_CLIENTS" usage:"comma separated audiences and service account client IDs that must use DPoP bound tokens"`
+
+	// Asymmetric keys published at /.well-known/jwks.json. Without a signing key tokens are signed with the HMAC secret.
+	SigningKeyFile       string   `key:"auth.signing_key_file" env:"SIGNING_KEY_FILE" usage:"PEM RSA or EC P-256 private key to sign tokens with"`
+	VerificationKeyFiles []string `key:"auth.verification_key_files" env:"VERIFICATION_KEY_FILES" usage:"comma separated PEM keys of earlier signing keys still accepted"`
+
+	// Browser mode keeps tokens in HttpOnly cookies protected by a CSRF token
+	CookieMode     bool     `key:"auth.cookie_mode" env:"AUTH_COOKIE_MODE" usage:"issue tokens in HttpOnly cookies instead of response bodies"`
+	CookieDomain   string   `key:"auth.cookie_domain" env:"AUTH_COOKIE_DOMAIN" usage:"domain attribute of auth cookies"`
+	CookieSecure   bool     `key:"auth.cookie_secure" env:"AUTH_COOKIE_SECURE" usage:"only send auth cookies over HTTPS"`
+	CookieSameSite string   `key:"auth.cookie_same_site" env:"AUTH_COOKIE_SAME_SITE" usage:"SameSite attribute of auth cookies: lax, strict or none"`
+	CORSOrigins    []string `key:"cors.allowed_origins" env:"CORS_ALLOWED_ORIGINS" usage:"comma separated origins allowed by CORS, all if empty"`
+
+	// Storage
+	StoreBackend  string `key:"store.backend" env:"STORE_BACKEND" usage:"storage backend: mongo, postgres, sqlite or memory"`
+	DatabaseURL   string `key:"store.database_url" env:"DATABASE_URL" secret:"url" usage:"PostgreSQL URL or SQLite path"`
+	MongoURL      string `key:"store.mongodb_url" env:"MONGODB_URL" secret:"url" usage:"MongoDB connection URL"`
+	MongoDatabase string `key:"store.mongodb_database" env:"MONGODB_DATABASE" usage:"MongoDB database name"`
+
+	// Google OAuth
+	GoogleClientID     string `key:"google.client_id" env:"GOOGLE_CLIENT_ID" usage:"Google OAuth client ID"`
+	GoogleClientSecret string `key:"google.client_secret" env:"GOOGLE_CLIENT_SECRET" secret:"true" usage:"Google OAuth client secret"`
+	GoogleRedirectURL  string `key:"google.redirect_url" env:"GOOGLE_REDIRECT_URL" usage:"Google OAuth redirect URL"`
+	FrontendURL        string `key:"google.frontend_url" env:"CREATE_RESUME_BASE_URL" usage:"frontend URL users are sent to after Google login"`
+
+	// Webhook receivers must be public https URLs, local ones are allowed for development only
+	WebhooksAllowInsecure bool `key:"webhooks.allow_insecure" env:"WEBHOOKS_ALLOW_INSECURE" usage:"allow http webhook URLs and receivers on private, loopback and link-local addresses"`
+
+	DeletionGracePeriod time.Duration `key:"accounts.deletion_grace_period" env:"ACCOUNT_DELETION_GRACE_PERIOD" usage:"how long deleted accounts can be restored before they are purged"`
+
+	// Spans of requests, password hashing, tokens and MongoDB commands
+	TracingExporter    string `key:"tracing.exporter" env:"TRACING_EXPORTER" usage:"where spans are sent: none, stdout or otlp"`
+	TracingEndpoint    string `key:"tracing.otlp_endpoint" env:"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT" usage:"OTLP/HTTP traces URL, the OTEL_EXPORTER_OTLP_* defaults if empty"`
+	TracingServiceName string `key:"tracing.service_name" env:"OTEL_SERVICE_NAME" usage:"service.name of exported spans"`
+
+	// Audit events are always stored, these copy them to a SIEM as well
+	AuditFile       string `key:"audit.file" env:"AUDIT_FILE" usage:"file audit events are appended to as JSON lines"`
+	AuditSyslogAddr string `key:"audit.syslog_addr" env:"AUDIT_SYSLOG_ADDR" usage:"syslog to send audit events to: local, or udp://host:port or tcp://host:port"`
+}
+
+// Default returns the configuration used when nothing else is set.
+func Default() Config {
+	return Config{
+		Port:                "8080",
+		LogLevel:            "info",
+		ReadTimeout:         15 * time.Second,
+		WriteTimeout:        30 * time.Second,
+		IdleTimeout:         2 * time.Minute,
+		ShutdownTimeout:     30 * time.Second,
+		Issuer:              "go-jwt",
+		Audiences:           []string{"go-jwt"},
+		ClockSkew:           30 * time.Second,
+		CookieSecure:        true,
+		CookieSameSite:      "lax",
+		StoreBackend:        "mongo",
+		MongoDatabase:       "cluster0",
+		FrontendURL:         "https://recreate-resume.vercel.app",
+		DeletionGracePeriod: 30 * 24 * time.Hour,
+		TracingExporter:     "none",
+		TracingServiceName:  "go-jwt",
+	}
+}
+
+// Validate reports every invalid setting at once.
+func (c Config) Validate() error {
+	var errs []error
+	invalid := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		invalid("port: %q is not a valid TCP port", c.Port)
+	}
+	switch c.GinMode {
+	case "", "debug", "release", "test":
+	default:
+		invalid("gin_mode: must be debug, release or test, got %q", c.GinMode)
+	}
+	switch c.LogLevel {
+	case "debug", "info", "warn", "error":
+	default:
+		invalid("log.level: must be debug, info, warn or error, got %q", c.LogLevel)
+	}
+
+	if c.ReadTimeout < 0 {
+		invalid("server.read_timeout: must not be negative")
+	}
+	if c.WriteTimeout < 0 {
+		invalid("server.write_timeout: must not be negative")
+	}
+	if c.IdleTimeout < 0 {
+		invalid("server.idle_timeout: must not be negative")
+	}
+	if c.ShutdownDelay < 0 {
+		invalid("server.shutdown_delay: must not be negative")
+	}
+	if c.ShutdownTimeout <= 0 {
+		invalid("server.shutdown_timeout: must be positive, got %s", c.ShutdownTimeout)
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		invalid("server.tls_cert_file: must be set together with server.tls_key_file")
+	}
+	if c.TLSClientCAFile != "" && c.TLSCertFile == "" {
+		invalid("server.tls_client_ca_file: requires server.tls_cert_file, client certificates need TLS")
+	}
+
+	if c.SecretKey == "" {
+		invalid("auth.secret_key: is required (set SECRET_KEY or SECRET_KEY_FILE)")
+	} else if len(c.SecretKey) < 32 {
+		invalid("auth.secret_key: must be at least 32 bytes long")
+	}
+
+	if c.Issuer == "" {
+		invalid("auth.issuer: is required")
+	}
+	if len(c.Audiences) == 0 {
+		invalid("auth.audiences: must list at least one audience")
+	}
+	for _, audience := range c.Audiences {
+		if audience == "" {
+			invalid("auth.audiences: must not contain empty audiences")
+		}
+	}
+	if c.ClockSkew < 0 || c.ClockSkew > 5*time.Minute {
+		invalid("auth.clock_skew: must be between 0 and 5m, got %s", c.ClockSkew)
+	}
+
+	switch c.CookieSameSite {
+	case "lax", "strict":
+	case "none":
+		if !c.CookieSecure {
+			invalid("auth.cookie_same_site: none requires auth.cookie_secure")
+		}
+	default:
+		invalid("auth.cookie_same_site: must be lax, strict or none, got %q", c.CookieSameSite)
+	}
+	if c.CookieMode && len(c.CORSOrigins) == 0 {
+		invalid("cors.allowed_origins: must list the frontend origins when auth.cookie_mode is on")
+	}
+
+	switch c.StoreBackend {
+	case "mongo":
+		if c.MongoURL == "" {
+			invalid("store.mongodb_url: is required for the mongo backend (set MONGODB_URL)")
+		}
+	case "postgres", "sqlite":
+		if c.DatabaseURL == "" {
+			invalid("store.database_url: is required for the %s backend (set DATABASE_URL)", c.StoreBackend)
+		}
+	case "memory":
+	default:
+		invalid("store.backend: must be mongo, postgres, sqlite or memory, got %q", c.StoreBackend)
+	}
+
+	switch c.TracingExporter {
+	case "none", "stdout":
+	case "otlp":
+		if u, err := url.Parse(c.TracingEndpoint); c.TracingEndpoint != "" && (err != nil || u.Host == "") {
+			invalid("tracing.otlp_endpoint: must be an http or https URL, got %q", c.TracingEndpoint)
+		}
+	default:
+		invalid("tracing.exporter: must be none, stdout or otlp, got %q", c.TracingExporter)
+	}
+
+	if c.AuditSyslogAddr != "" && c.AuditSyslogAddr != "local" {
+		if u, err := url.Parse(c.AuditSyslogAddr); err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Host == "" {
+			invalid("audit.syslog_addr: must be local, udp://host:port or tcp://host:port, got %q", c.AuditSyslogAddr)
+		}
+	}
+
+	if c.GoogleClientID != "" || c.GoogleClientSecret != "" || c.GoogleRedirectURL != "" {
+		if c.GoogleClientID == "" || c.GoogleClientSecret == "" || c.GoogleRedirectURL == "" {
+			invalid("google: client_id, client_secret and redirect_url must be set together")
+		}
+		if _, err := url.ParseRequestURI(c.GoogleRedirectURL); c.GoogleRedirectURL != "" && err != nil {
+			invalid("google.redirect_url: %v", err)
+		}
+	}
+	if _, err := url.ParseRequestURI(c.FrontendURL); err != nil {
+		invalid("google.frontend_url: %v", err)
+	}
+
+	if c.DeletionGracePeriod < 0 {
+		invalid("accounts.deletion_grace_period: must not be negative")
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,260 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Load builds the configuration from, in increasing order of precedence:
+// defaults, the config file, environment variables and command line flags.
+//
+// The config file is given with --config or CONFIG_FILE and may be YAML or
+// TOML. Any environment variable can instead be read from a file named by
+// the same variable with a _FILE suffix, e.g. SECRET_KEY_FILE.
+func Load(args []string) (Config, error) {
+	loadDotEnv()
+
+	cfg := Default()
+	fields := configFields(reflect.TypeOf(cfg))
+	v := reflect.ValueOf(&cfg).Elem()
+
+	// Flags are parsed first to find the config file, but applied last
+	fs := flag.NewFlagSet("go-jwt", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML or TOML config file")
+	flags := map[string]*rawFlag{}
+	for _, f := range fields {
+		raw := &rawFlag{boolean: f.typ.Kind() == reflect.Bool}
+		fs.Var(raw, f.key, f.usage)
+		flags[f.key] = raw
+	}
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+
+	if *configFile != "" {
+		values, err := readFile(*configFile)
+		if err != nil {
+			return cfg, err
+		}
+		for key, value := range values {
+			f, ok := findField(fields, key)
+			if !ok {
+				return cfg, fmt.Errorf("%s: unknown setting %q", *configFile, key)
+			}
+			if err := setFromFile(v.FieldByIndex(f.index), value); err != nil {
+				return cfg, fmt.Errorf("%s: %s: %w", *configFile, key, err)
+			}
+		}
+	}
+
+	for _, f := range fields {
+		if f.env == "" {
+			continue
+		}
+		value, ok, err := lookupEnv(f.env)
+		if err != nil {
+			return cfg, err
+		}
+		if !ok {
+			continue
+		}
+		if err := setString(v.FieldByIndex(f.index), value); err != nil {
+			return cfg, fmt.Errorf("%s: %w", f.env, err)
+		}
+	}
+
+	for _, f := range fields {
+		if raw := flags[f.key]; raw.set {
+			if err := setString(v.FieldByIndex(f.index), raw.value); err != nil {
+				return cfg, fmt.Errorf("--%s: %w", f.key, err)
+			}
+		}
+	}
+
+	return cfg, nil
+}
+
+// loadDotEnv loads .env in local development. It never overrides variables that are already set.
+func loadDotEnv() {
+	// Check if running on Railway
+	isRailway := os.Getenv("RAILWAY_ENVIRONMENT") != "" || os.Getenv("RAILWAY_STATIC_URL") != ""
+	if isRailway {
+		return
+	}
+	if err := godotenv.Load(".env"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Warn("failed to load .env", "error", err)
+	}
+}
+
+// lookupEnv reads name, or the file named by name_FILE.
+func lookupEnv(name string) (string, bool, error) {
+	if path := os.Getenv(name + "_FILE"); path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return "", false, fmt.Errorf("%s_FILE: %w", name, err)
+		}
+		return strings.TrimRight(string(content), "\r\n"), true, nil
+	}
+	value, ok := os.LookupEnv(name)
+	return value, ok, nil
+}
+
+// readFile parses a YAML or TOML file into a map of dotted keys.
+func readFile(path string) (map[string]interface{}, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tree map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &tree)
+	case ".toml":
+		err = toml.Unmarshal(content, &tree)
+	default:
+		return nil, fmt.Errorf("%s: config file must be .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	values := map[string]interface{}{}
+	flatten("", tree, values)
+	return values, nil
+}
+
+func flatten(prefix string, tree map[string]interface{}, values map[string]interface{}) {
+	for key, value := range tree {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if section, ok := value.(map[string]interface{}); ok {
+			flatten(key, section, values)
+			continue
+		}
+		values[key] = value
+	}
+}
+
+type field struct {
+	index  []int
+	typ    reflect.Type
+	key    string
+	env    string
+	secret string
+	usage  string
+}
+
+func configFields(t reflect.Type) []field {
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		key := sf.Tag.Get("key")
+		if key == "" {
+			continue
+		}
+		fields = append(fields, field{
+			index:  sf.Index,
+			typ:    sf.Type,
+			key:    key,
+			env:    sf.Tag.Get("env"),
+			secret: sf.Tag.Get("secret"),
+			usage:  sf.Tag.Get("usage"),
+		})
+	}
+	return fields
+}
+
+func findField(fields []field, key string) (field, bool) {
+	for _, f := range fields {
+		if f.key == key {
+			return f, true
+		}
+	}
+	return field{}, false
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setString parses s into the field according to its type.
+func setString(v reflect.Value, s string) error {
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(s)
+	case v.Kind() == reflect.Int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(n))
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
+
+// setFromFile sets a value decoded from a config file.
+func setFromFile(v reflect.Value, value interface{}) error {
+	if list, ok := value.([]interface{}); ok {
+		if v.Kind() != reflect.Slice {
+			return fmt.Errorf("expected a single value, got a list")
+		}
+		items := make([]string, 0, len(list))
+		for _, item := range list {
+			items = append(items, fmt.Sprint(item))
+		}
+		v.Set(reflect.ValueOf(items))
+		return nil
+	}
+	return setString(v, fmt.Sprint(value))
+}
+
+// rawFlag records a flag's value as text so it can be applied after the config file and environment.
+type rawFlag struct {
+	value   string
+	set     bool
+	boolean bool
+}
+
+func (f *rawFlag) String() string { return f.value }
+
+func (f *rawFlag) Set(s string) error {
+	f.value = s
+	f.set = true
+	return nil
+}
+
+func (f *rawFlag) IsBoolFlag() bool { return f.boolean }
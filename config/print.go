@@ -0,0 +1,82 @@
+package config
+
+import (
+	"io"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const redactedValue = "[REDACTED]"
+
+// Print writes the configuration as YAML. With redacted set, secrets are masked.
+func (c Config) Print(w io.Writer, redacted bool) error {
+	tree := map[string]interface{}{}
+	v := reflect.ValueOf(c)
+	for _, f := range configFields(v.Type()) {
+		value := v.FieldByIndex(f.index).Interface()
+		if redacted && f.secret != "" {
+			value = redact(f.secret, value.(string))
+		}
+		if d, ok := value.(time.Duration); ok {
+			value = d.String()
+		}
+
+		// Nest dotted keys into sections
+		section := tree
+		parts := strings.Split(f.key, ".")
+		for _, part := range parts[:len(parts)-1] {
+			next, ok := section[part].(map[string]interface{})
+			if !ok {
+				next = map[string]interface{}{}
+				section[part] = next
+			}
+			section = next
+		}
+		section[parts[len(parts)-1]] = value
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(tree); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+func redact(kind string, value string) string {
+	if value == "" {
+		return ""
+	}
+	if kind == "url" {
+		return redactURL(value)
+	}
+	return redactedValue
+}
+
+// redactURL masks the password of a URL. Values without a password in their
+// userinfo, such as key/value Postgres DSNs, are masked whole.
+func redactURL(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" || u.User == nil {
+		return redactedValue
+	}
+	if _, hasPassword := u.User.Password(); !hasPassword {
+		return redactedValue
+	}
+	u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	// Drivers also take passwords as query parameters, e.g. sslpassword
+	if u.RawQuery != "" {
+		query := u.Query()
+		for key := range query {
+			if strings.Contains(strings.ToLower(key), "password") {
+				query.Set(key, "xxxxx")
+			}
+		}
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
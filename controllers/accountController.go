@@ -0,0 +1,280 @@
+package controllers
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/arunprasad2002/go-jwt/audit"
+	"github.com/arunprasad2002/go-jwt/helpers"
+	"github.com/arunprasad2002/go-jwt/models"
+	"github.com/arunprasad2002/go-jwt/problem"
+	"github.com/arunprasad2002/go-jwt/store"
+	"github.com/gin-gonic/gin"
+)
+
+// AccountExport is everything stored about a user, as handed out by the export endpoint
+type AccountExport struct {
+	Exported_at time.Time           `json:"exported_at"`
+	Profile     models.UserResponse `json:"profile"`
+	Sessions    []models.Session    `json:"sessions"`
+	Identities  []models.Identity   `json:"identities"`
+	API_keys    []models.APIKey     `json:"api_keys"`
+	// Audit_events are the recorded actions by or on the user
+	Audit_events []models.AuditEvent `json:"audit_events"`
+}
+
+func (h *Handler) DeactivateUser() gin.HandlerFunc {
+	return h.setUserStatus(models.StatusDeactivated, audit.ActionUserDeactivated)
+}
+
+func (h *Handler) ReactivateUser() gin.HandlerFunc {
+	return h.setUserStatus(models.StatusActive, audit.ActionUserReactivated)
+}
+
+func (h *Handler) setUserStatus(status string, action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := helpers.CheckAdmin(c); err != nil {
+			problem.Write(c, err)
+			return
+		}
+		ctx, cancel := context.WithTimeout(requestContext(c), 100*time.Second)
+		defer cancel()
+
+		user, err := h.Accounts.SetAccountStatus(ctx, c.Param("user_id"), status)
+		if errors.Is(err, store.ErrNotFound) {
+			problem.Write(c, problem.New(problem.CodeUserNotFound, ""))
+			return
+		}
+		if err != nil {
+			problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Failed to update account status"))
+			return
+		}
+		h.audit(c, models.AuditEvent{
+			Action:      action,
+			Outcome:     models.AuditSuccess,
+			Target_id:   *user.User_id,
+			Target_type: audit.TargetUser,
+		})
+		c.JSON(http.StatusOK, models.NewUserResponse(*user, models.VisibilityAdmin))
+	}
+}
+
+// SetUserType lets an admin make a user an admin or a regular user
+func (h *Handler) SetUserType() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := helpers.CheckAdmin(c); err != nil {
+			problem.Write(c, err)
+			return
+		}
+		ctx, cancel := context.WithTimeout(requestContext(c), 100*time.Second)
+		defer cancel()
+
+		var request models.SetUserTypeRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			problem.Write(c, problem.Body(err))
+			return
+		}
+		if err := validate.Struct(request); err != nil {
+			problem.Write(c, err)
+			return
+		}
+
+		user, err := h.Accounts.SetUserType(ctx, c.Param("user_id"), *request.User_type)
+		if errors.Is(err, store.ErrNotFound) {
+			problem.Write(c, problem.New(problem.CodeUserNotFound, ""))
+			return
+		}
+		if err != nil {
+			problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Failed to update user type"))
+			return
+		}
+		h.audit(c, models.AuditEvent{
+			Action:      audit.ActionUserTypeChanged,
+			Outcome:     models.AuditSuccess,
+			Target_id:   *user.User_id,
+			Target_type: audit.TargetUser,
+			Details:     map[string]string{"user_type": *user.User_type},
+		})
+		c.JSON(http.StatusOK, models.NewUserResponse(*user, models.VisibilityAdmin))
+	}
+}
+
+// DeleteAccount schedules the caller's account for deletion. It is purged once the
+// grace period ends unless the user logs in again before that.
+func (h *Handler) DeleteAccount() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(requestContext(c), 100*time.Second)
+		defer cancel()
+
+		user, err := h.Accounts.SetAccountStatus(ctx, c.GetString("uid"), models.StatusPendingDeletion)
+		if err != nil {
+			problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Failed to delete account"))
+			return
+		}
+		h.audit(c, models.AuditEvent{
+			Action:      audit.ActionAccountDeleted,
+			Outcome:     models.AuditSuccess,
+			Target_id:   *user.User_id,
+			Target_type: audit.TargetUser,
+		})
+		c.JSON(http.StatusOK, gin.H{
+			"message":      "Account scheduled for deletion",
+			"delete_after": user.Delete_after,
+		})
+	}
+}
+
+// ChangeEmail gives the caller a new email address after checking their password.
+// Their sessions are revoked, so they have to log in again with the new address.
+func (h *Handler) ChangeEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(requestContext(c), 100*time.Second)
+		defer cancel()
+
+		var request models.ChangeEmailRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			problem.Write(c, problem.Body(err))
+			return
+		}
+		if err := validate.Struct(request); err != nil {
+			problem.Write(c, err)
+			return
+		}
+
+		user, err := h.Store.Users.GetByID(ctx, c.GetString("uid"))
+		if err != nil {
+			problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Failed to load user"))
+			return
+		}
+		if user.Password == nil {
+			problem.Write(c, problem.New(problem.CodePasswordNotSet, "Set a password before changing the email"))
+			return
+		}
+		if ok, _ := h.verifyPassword(ctx, *request.Password, *user.Password); !ok {
+			h.audit(c, models.AuditEvent{
+				Action:      audit.ActionEmailChanged,
+				Outcome:     models.AuditFailure,
+				Reason:      "invalid password",
+				Target_id:   *user.User_id,
+				Target_type: audit.TargetUser,
+			})
+			problem.Write(c, problem.New(problem.CodeInvalidCredentials, "Password is incorrect"))
+			return
+		}
+		if user.Email != nil && *user.Email == *request.Email {
+			problem.Write(c, problem.New(problem.CodeEmailUnchanged, ""))
+			return
+		}
+		exists, err := h.Store.Users.EmailExists(ctx, *request.Email)
+		if err != nil {
+			problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Failed to change email"))
+			return
+		}
+		if exists {
+			problem.Write(c, problem.New(problem.CodeEmailTaken, ""))
+			return
+		}
+
+		user, err = h.Accounts.ChangeEmail(ctx, *user.User_id, *request.Email)
+		if err != nil {
+			problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Failed to change email"))
+			return
+		}
+		h.audit(c, models.AuditEvent{
+			Action:      audit.ActionEmailChanged,
+			Outcome:     models.AuditSuccess,
+			Target_id:   *user.User_id,
+			Target_type: audit.TargetUser,
+		})
+		c.JSON(http.StatusOK, models.NewUserResponse(*user, models.VisibilitySelf))
+	}
+}
+
+// ExportAccount returns all data held about the caller as JSON, or as a ZIP archive with ?format=zip
+func (h *Handler) ExportAccount() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(requestContext(c), 100*time.Second)
+		defer cancel()
+
+		uid := c.GetString("uid")
+		user, err := h.Store.Users.GetByID(ctx, uid)
+		if err != nil {
+			problem.Write(c, problem.Wrap(err, problem.CodeUserNotFound, ""))
+			return
+		}
+		sessions, err := h.Store.Sessions.ListByUser(ctx, uid)
+		if err != nil {
+			problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Failed to load sessions"))
+			return
+		}
+		apiKeys, err := h.Store.APIKeys.ListByUser(ctx, uid)
+		if err != nil {
+			problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Failed to load API keys"))
+			return
+		}
+		auditEvents, err := h.Audit.List(ctx, store.AuditQuery{UserId: uid})
+		if err != nil {
+			problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Failed to load audit events"))
+			return
+		}
+		h.audit(c, models.AuditEvent{
+			Action:      audit.ActionAccountExported,
+			Outcome:     models.AuditSuccess,
+			Target_id:   uid,
+			Target_type: audit.TargetUser,
+		})
+
+		export := AccountExport{
+			Exported_at: time.Now(),
+			Profile:     models.NewUserResponse(*user, models.VisibilitySelf),
+			Sessions:    sessions,
+			Identities:  user.Identities,
+			API_keys:    apiKeys,
+
+			Audit_events: auditEvents,
+		}
+		if export.Identities == nil {
+			export.Identities = []models.Identity{}
+		}
+
+		if c.Query("format") != "zip" {
+			c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=export-%s.json", uid))
+			c.JSON(http.StatusOK, export)
+			return
+		}
+
+		c.Header("Content-Type", "application/zip")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=export-%s.zip", uid))
+		c.Status(http.StatusOK)
+		archive := zip.NewWriter(c.Writer)
+		files := map[string]interface{}{
+			"profile.json":    export.Profile,
+			"sessions.json":   export.Sessions,
+			"identities.json": export.Identities,
+			"api_keys.json":   export.API_keys,
+
+			"audit_events.json": export.Audit_events,
+		}
+		for _, name := range []string{"profile.json", "sessions.json", "identities.json", "api_keys.json", "audit_events.json"} {
+			f, err := archive.Create(name)
+			if err != nil {
+				c.Error(err)
+				return
+			}
+			encoder := json.NewEncoder(f)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(files[name]); err != nil {
+				c.Error(err)
+				return
+			}
+		}
+		if err := archive.Close(); err != nil {
+			c.Error(err)
+		}
+	}
+}
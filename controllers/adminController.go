@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/arunprasad2002/go-jwt/audit"
+	"github.com/arunprasad2002/go-jwt/helpers"
+	"github.com/arunprasad2002/go-jwt/logging"
+	"github.com/arunprasad2002/go-jwt/models"
+	"github.com/arunprasad2002/go-jwt/problem"
+	"github.com/gin-gonic/gin"
+)
+
+// GetLogLevel returns the current log level
+func (h *Handler) GetLogLevel() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := helpers.CheckAdmin(c); err != nil {
+			problem.Write(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"level": h.LogLevel.Level().String()})
+	}
+}
+
+// SetLogLevel changes the log level until the service restarts, e.g. to debug an incident
+func (h *Handler) SetLogLevel() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := helpers.CheckAdmin(c); err != nil {
+			problem.Write(c, err)
+			return
+		}
+		var request models.LogLevelRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			problem.Write(c, problem.Body(err))
+			return
+		}
+		level, err := logging.ParseLevel(request.Level)
+		if err != nil {
+			problem.Write(c, problem.Invalid("level", "oneof", "must be one of debug, info, warn, error"))
+			return
+		}
+
+		previous := h.LogLevel.Level()
+		h.LogLevel.Set(level)
+		logging.FromContext(c).Warn("log level changed", "from", previous.String(), "to", level.String(), "changed_by", c.GetString("uid"))
+		h.audit(c, models.AuditEvent{
+			Action:  audit.ActionLogLevelChanged,
+			Outcome: models.AuditSuccess,
+			Details: map[string]string{"from": previous.String(), "to": level.String()},
+		})
+		c.JSON(http.StatusOK, gin.H{"level": level.String()})
+	}
+}
@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/arunprasad2002/go-jwt/audit"
+	"github.com/arunprasad2002/go-jwt/helpers"
+	"github.com/arunprasad2002/go-jwt/models"
+	"github.com/arunprasad2002/go-jwt/problem"
+	"github.com/arunprasad2002/go-jwt/store"
+	"github.com/gin-gonic/gin"
+)
+
+// CreateAPIKey creates a personal API key for the caller. The key is only shown in this response.
+func (h *Handler) CreateAPIKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// A key must not be able to mint more keys, nor a service acting for the user
+		// with a delegated token, whose keys would outlive the delegation
+		if c.GetString("api_key_id") != "" || c.GetString("actor") != "" || c.GetString("uid") == "" {
+			problem.Write(c, problem.New(problem.CodeUserTokenRequired, ""))
+			return
+		}
+		ctx, cancel := context.WithTimeout(requestContext(c), 100*time.Second)
+		defer cancel()
+
+		var request models.APIKeyRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			problem.Write(c, problem.Body(err))
+			return
+		}
+		if err := validate.Struct(request); err != nil {
+			problem.Write(c, err)
+			return
+		}
+		if request.Expires_at != nil && !request.Expires_at.After(time.Now()) {
+			problem.Write(c, problem.Invalid("expires_at", "gt", "must be in the future"))
+			return
+		}
+
+		// Keys never get more than the token used to create them
+		callerScopes := c.GetStringSlice("scopes")
+		scopes := request.Scopes
+		if len(scopes) == 0 {
+			scopes = callerScopes
+		}
+		if !helpers.HasScopes(callerScopes, scopes...) {
+			problem.Write(c, problem.New(problem.CodeAPIKeyScopeExceeded, ""))
+			return
+		}
+
+		key, apiKey, err := h.Accounts.CreateAPIKey(ctx, c.GetString("uid"), request.Name, scopes, request.Expires_at)
+		if err != nil {
+			problem.Write(c, err)
+			return
+		}
+		h.audit(c, models.AuditEvent{
+			Action:      audit.ActionAPIKeyCreated,
+			Outcome:     models.AuditSuccess,
+			Target_id:   apiKey.Key_id,
+			Target_type: audit.TargetAPIKey,
+			Details:     map[string]string{"name": apiKey.Name, "scope": strings.Join(apiKey.Scopes, " ")},
+		})
+		c.JSON(http.StatusCreated, gin.H{"api_key": apiKey, "key": key})
+	}
+}
+
+func (h *Handler) ListAPIKeys() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(requestContext(c), 100*time.Second)
+		defer cancel()
+
+		keys, err := h.Store.APIKeys.ListByUser(ctx, c.GetString("uid"))
+		if err != nil {
+			problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Failed to list API keys"))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"api_keys": keys})
+	}
+}
+
+func (h *Handler) RevokeAPIKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(requestContext(c), 100*time.Second)
+		defer cancel()
+
+		err := h.Store.APIKeys.Revoke(ctx, c.GetString("uid"), c.Param("key_id"), time.Now())
+		if errors.Is(err, store.ErrNotFound) {
+			problem.Write(c, problem.New(problem.CodeAPIKeyNotFound, ""))
+			return
+		}
+		if err != nil {
+			problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Failed to revoke API key"))
+			return
+		}
+		h.audit(c, models.AuditEvent{
+			Action:      audit.ActionAPIKeyRevoked,
+			Outcome:     models.AuditSuccess,
+			Target_id:   c.Param("key_id"),
+			Target_type: audit.TargetAPIKey,
+		})
+		c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+	}
+}
@@ -0,0 +1,190 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/arunprasad2002/go-jwt/audit"
+	"github.com/arunprasad2002/go-jwt/helpers"
+	"github.com/arunprasad2002/go-jwt/logging"
+	"github.com/arunprasad2002/go-jwt/models"
+	"github.com/arunprasad2002/go-jwt/problem"
+	"github.com/arunprasad2002/go-jwt/store"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultAuditPageSize = 100
+	maxAuditPageSize     = 1000
+)
+
+// audit records event for the request. The caller is the actor unless the event
+// names one, e.g. the user who just logged in. Failing to record is logged but
+// does not fail the request.
+func (h *Handler) audit(c *gin.Context, event models.AuditEvent) {
+	if h.Audit == nil {
+		return
+	}
+	if event.Actor_id == "" {
+		if clientId := c.GetString("client_id"); clientId != "" {
+			event.Actor_id, event.Actor_type = clientId, "SERVICE"
+		} else if uid := c.GetString("uid"); uid != "" {
+			event.Actor_id, event.Actor_type = uid, c.GetString("user_type")
+		}
+	}
+	if keyId := c.GetString("api_key_id"); keyId != "" {
+		event.Details = withDetail(event.Details, "api_key_id", keyId)
+	}
+	// Exchanged tokens act for the user on behalf of a service
+	if actor := c.GetString("actor"); actor != "" {
+		event.Details = withDetail(event.Details, "acting_client_id", actor)
+	}
+	event.Ip = c.ClientIP()
+	event.User_agent = c.Request.UserAgent()
+	event.Request_id = c.GetString("request_id")
+
+	ctx, cancel := context.WithTimeout(requestContext(c), 10*time.Second)
+	defer cancel()
+	if err := h.Audit.Record(ctx, event); err != nil {
+		logging.FromContext(c).Error("failed to record audit event", "action", event.Action, "error", err)
+	}
+}
+
+// auditLogin records a login attempt by user, nil if no user matched. A reason marks a failed attempt.
+func (h *Handler) auditLogin(c *gin.Context, user *models.User, reason string, details map[string]string) {
+	method := details["method"]
+	if method == "" {
+		method = "password"
+	}
+	h.Metrics.Login(method, reason)
+	if reason == "" {
+		// A successful login issues tokens directly
+		h.Metrics.TokenIssued(method, "")
+	}
+
+	event := models.AuditEvent{Action: audit.ActionLogin, Outcome: models.AuditSuccess, Reason: reason, Details: details}
+	if reason != "" {
+		event.Outcome = models.AuditFailure
+	}
+	if user != nil && user.User_id != nil {
+		event.Actor_id, event.Target_id, event.Target_type = *user.User_id, *user.User_id, audit.TargetUser
+		if user.User_type != nil {
+			event.Actor_type = *user.User_type
+		}
+	}
+	h.audit(c, event)
+}
+
+// auditToken records a token request of the given grant type by actorId, empty if
+// the client could not be identified. A reason marks a refused request.
+func (h *Handler) auditToken(c *gin.Context, grant string, actorId string, actorType string, reason string, details map[string]string) {
+	h.Metrics.TokenIssued(grant, reason)
+
+	event := models.AuditEvent{
+		Action:     audit.ActionTokenIssued,
+		Outcome:    models.AuditSuccess,
+		Reason:     reason,
+		Actor_id:   actorId,
+		Actor_type: actorType,
+		Details:    withDetail(details, "grant_type", grant),
+	}
+	if reason != "" {
+		event.Outcome = models.AuditFailure
+	}
+	h.audit(c, event)
+}
+
+func withDetail(details map[string]string, key string, value string) map[string]string {
+	if details == nil {
+		details = map[string]string{}
+	}
+	details[key] = value
+	return details
+}
+
+// ListAuditEvents returns audit events oldest first, filtered by actor_id, target_id,
+// user_id (actor or target), action, outcome and an RFC 3339 since/until window.
+// Pages are continued by passing the returned next_after as after.
+func (h *Handler) ListAuditEvents() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := helpers.ChekcUserType(c, "ADMIN"); err != nil {
+			problem.Write(c, err)
+			return
+		}
+		ctx, cancel := context.WithTimeout(requestContext(c), 100*time.Second)
+		defer cancel()
+
+		query := store.AuditQuery{
+			ActorId:  c.Query("actor_id"),
+			TargetId: c.Query("target_id"),
+			UserId:   c.Query("user_id"),
+			Action:   c.Query("action"),
+			Outcome:  c.Query("outcome"),
+			Limit:    defaultAuditPageSize,
+		}
+		var err error
+		if since := c.Query("since"); since != "" {
+			if query.Since, err = time.Parse(time.RFC3339, since); err != nil {
+				problem.Write(c, problem.Invalid("since", "datetime", "must be an RFC 3339 time"))
+				return
+			}
+		}
+		if until := c.Query("until"); until != "" {
+			if query.Until, err = time.Parse(time.RFC3339, until); err != nil {
+				problem.Write(c, problem.Invalid("until", "datetime", "must be an RFC 3339 time"))
+				return
+			}
+		}
+		if after := c.Query("after"); after != "" {
+			if query.After, err = strconv.ParseInt(after, 10, 64); err != nil || query.After < 0 {
+				problem.Write(c, problem.Invalid("after", "number", "must be a sequence number"))
+				return
+			}
+		}
+		if limit := c.Query("limit"); limit != "" {
+			if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit < 1 || query.Limit > maxAuditPageSize {
+				problem.Write(c, problem.Invalid("limit", "range", "must be between 1 and "+strconv.Itoa(maxAuditPageSize)))
+				return
+			}
+		}
+
+		events, err := h.Audit.List(ctx, query)
+		if err != nil {
+			problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Failed to list audit events"))
+			return
+		}
+		response := gin.H{"events": events}
+		if len(events) == query.Limit {
+			response["next_after"] = events[len(events)-1].Sequence
+		}
+		h.audit(c, models.AuditEvent{Action: audit.ActionAuditRead, Outcome: models.AuditSuccess})
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// VerifyAuditLog checks the hash chain of the whole audit log
+func (h *Handler) VerifyAuditLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := helpers.ChekcUserType(c, "ADMIN"); err != nil {
+			problem.Write(c, err)
+			return
+		}
+		ctx, cancel := context.WithTimeout(requestContext(c), 100*time.Second)
+		defer cancel()
+
+		checked, err := h.Audit.Verify(ctx)
+		if errors.Is(err, audit.ErrChainBroken) {
+			logging.FromContext(c).Error("audit log failed verification", "error", err)
+			c.JSON(http.StatusOK, gin.H{"valid": false, "checked": checked, "error": err.Error()})
+			return
+		}
+		if err != nil {
+			problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Failed to verify audit log"))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"valid": true, "checked": checked})
+	}
+}
@@ -0,0 +1,336 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/arunprasad2002/go-jwt/audit"
+	"github.com/arunprasad2002/go-jwt/helpers"
+	"github.com/arunprasad2002/go-jwt/models"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+)
+
+// DeviceAuthorization starts the device authorization grant (RFC 8628) for
+// clients that cannot open a browser, such as a CLI over SSH. The client shows
+// the user code and verification URI, then polls the token endpoint.
+func (h *Handler) DeviceAuthorization() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "no-store")
+		ctx, cancel := context.WithTimeout(requestContext(c), 10*time.Second)
+		defer cancel()
+
+		// Device clients are public, their client_id names the audience they want tokens for
+		clientId, err := h.Tokens.Audience(c.PostForm("client_id"))
+		if err != nil {
+			oauthError(c, http.StatusUnauthorized, "invalid_client", err.Error())
+			return
+		}
+		scope := strings.Join(strings.Fields(c.PostForm("scope")), " ")
+		for _, s := range strings.Fields(scope) {
+			if !helpers.IsUserScope(s) {
+				oauthError(c, http.StatusBadRequest, "invalid_scope", "invalid scope "+s)
+				return
+			}
+		}
+
+		deviceCode, auth, err := h.Accounts.StartDeviceAuthorization(ctx, clientId, scope)
+		if err != nil {
+			oauthError(c, http.StatusInternalServerError, "server_error", "failed to start device authorization")
+			return
+		}
+		verificationURI := helpers.BaseURL(c) + "/device"
+		c.JSON(http.StatusOK, gin.H{
+			"device_code":               deviceCode,
+			"user_code":                 auth.User_code,
+			"verification_uri":          verificationURI,
+			"verification_uri_complete": verificationURI + "?user_code=" + url.QueryEscape(auth.User_code),
+			"expires_in":                int(helpers.DeviceCodeLifetime.Seconds()),
+			"interval":                  auth.Interval,
+		})
+	}
+}
+
+// deviceCode answers a device polling the token endpoint. Once the user has
+// approved the request the device gets the same tokens a password login would.
+func (h *Handler) deviceCode(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(requestContext(c), 10*time.Second)
+	defer cancel()
+
+	deviceCode := c.PostForm("device_code")
+	if deviceCode == "" {
+		oauthError(c, http.StatusBadRequest, "invalid_request", "device_code is required")
+		return
+	}
+	clientId, err := h.Tokens.Audience(c.PostForm("client_id"))
+	if err != nil {
+		oauthError(c, http.StatusUnauthorized, "invalid_client", err.Error())
+		return
+	}
+	// Checked before polling, an approved device code can only be redeemed once
+	cnf, err := h.tokenBinding(c, clientId)
+	if err != nil {
+		oauthError(c, http.StatusBadRequest, "invalid_dpop_proof", err.Error())
+		return
+	}
+
+	auth, err := h.Accounts.PollDeviceAuthorization(ctx, deviceCode, clientId)
+	switch {
+	case errors.Is(err, helpers.ErrAuthorizationPending):
+		oauthError(c, http.StatusBadRequest, err.Error(), "the user has not approved the request yet")
+		return
+	case errors.Is(err, helpers.ErrSlowDown):
+		oauthError(c, http.StatusBadRequest, err.Error(), "polling too fast, wait 5 more seconds between requests")
+		return
+	case errors.Is(err, helpers.ErrDeviceCodeExpired):
+		oauthError(c, http.StatusBadRequest, err.Error(), "the device code has expired")
+		return
+	case errors.Is(err, helpers.ErrAccessDenied):
+		oauthError(c, http.StatusBadRequest, err.Error(), "the user denied the request")
+		return
+	case errors.Is(err, helpers.ErrInvalidDeviceCode):
+		oauthError(c, http.StatusBadRequest, "invalid_grant", err.Error())
+		return
+	case err != nil:
+		oauthError(c, http.StatusInternalServerError, "server_error", "failed to check device authorization")
+		return
+	}
+
+	user, err := h.Store.Users.GetByID(ctx, auth.User_id)
+	if err != nil {
+		oauthError(c, http.StatusBadRequest, "invalid_grant", "user not found")
+		return
+	}
+	if err := h.Accounts.CheckAccountActive(ctx, auth.User_id, time.Now().Unix()); err != nil {
+		oauthError(c, http.StatusBadRequest, "invalid_grant", err.Error())
+		return
+	}
+	scopes, err := helpers.GrantScopes(helpers.UserScopes(*user.User_type), auth.Scope)
+	if err != nil {
+		oauthError(c, http.StatusBadRequest, "invalid_scope", err.Error())
+		return
+	}
+	token, refreshToken, err := h.issueUserTokens(ctx, c, user, auth.Client_id, scopes, cnf)
+	if err != nil {
+		oauthError(c, http.StatusInternalServerError, "server_error", "token generation failed")
+		return
+	}
+	h.auditToken(c, "device_code", *user.User_id, *user.User_type, "", map[string]string{
+		"audience": auth.Client_id,
+		"scope":    strings.Join(scopes, " "),
+	})
+
+	response := tokenResponse(token, helpers.AccessTokenLifetime, scopes, cnf)
+	response["refresh_token"] = refreshToken
+	c.JSON(http.StatusOK, response)
+}
+
+// devicePageData is what the device verification page shows
+type devicePageData struct {
+	UserCode   string
+	Client     string
+	Scope      string
+	Email      string
+	CSRFToken  string
+	NeedsLogin bool
+	Message    string
+	Error      string
+}
+
+// DevicePage is the page where a user enters the code shown by a device. When a
+// valid code is given it asks the user to approve or deny the request.
+func (h *Handler) DevicePage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(requestContext(c), 10*time.Second)
+		defer cancel()
+
+		data := h.devicePageData(c)
+		if userCode := c.Query("user_code"); userCode != "" {
+			auth, err := h.Accounts.FindDeviceAuthorization(ctx, userCode)
+			if err != nil {
+				data.Error = helpers.ErrInvalidUserCode.Error()
+			} else {
+				data.UserCode = auth.User_code
+				data.Client = auth.Client_id
+				data.Scope = auth.Scope
+			}
+		}
+		renderDevicePage(c, http.StatusOK, data)
+	}
+}
+
+// DeviceDecision records the user's approval or denial of a device's request
+func (h *Handler) DeviceDecision() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(requestContext(c), 100*time.Second)
+		defer cancel()
+
+		data := h.devicePageData(c)
+		auth, err := h.Accounts.FindDeviceAuthorization(ctx, c.PostForm("user_code"))
+		if err != nil {
+			data.Error = err.Error()
+			renderDevicePage(c, http.StatusBadRequest, data)
+			return
+		}
+		data.UserCode = auth.User_code
+		data.Client = auth.Client_id
+		data.Scope = auth.Scope
+
+		user, err := h.deviceUser(ctx, c, data.NeedsLogin)
+		if err != nil {
+			data.Error = err.Error()
+			renderDevicePage(c, http.StatusUnauthorized, data)
+			return
+		}
+
+		approve := c.PostForm("action") == "approve"
+		// Refuse here rather than let the device fail when it asked for more than the user has
+		if _, err := helpers.GrantScopes(helpers.UserScopes(*user.User_type), auth.Scope); approve && err != nil {
+			data.Error = "You cannot grant the requested access: " + err.Error()
+			renderDevicePage(c, http.StatusForbidden, data)
+			return
+		}
+		if err := h.Accounts.DecideDeviceAuthorization(ctx, auth.User_code, *user.User_id, approve); err != nil {
+			if errors.Is(err, helpers.ErrInvalidUserCode) {
+				data.Error = err.Error()
+				renderDevicePage(c, http.StatusConflict, data)
+				return
+			}
+			data.Error = "Failed to record your decision"
+			renderDevicePage(c, http.StatusInternalServerError, data)
+			return
+		}
+
+		action := audit.ActionDeviceDenied
+		if approve {
+			action = audit.ActionDeviceApproved
+		}
+		h.audit(c, models.AuditEvent{
+			Action:      action,
+			Outcome:     models.AuditSuccess,
+			Actor_id:    *user.User_id,
+			Actor_type:  *user.User_type,
+			Target_id:   auth.User_code,
+			Target_type: audit.TargetDeviceAuthorization,
+			Details:     map[string]string{"client_id": auth.Client_id, "scope": auth.Scope},
+		})
+
+		data.Message = "Request denied. You can close this window."
+		if approve {
+			data.Message = "Device approved. You can return to your device."
+		}
+		renderDevicePage(c, http.StatusOK, data)
+	}
+}
+
+// devicePageData returns the page state for the browser's session. In browser
+// mode a logged-in user is recognised by the access token cookie, anyone else
+// has to enter their email and password on the page.
+func (h *Handler) devicePageData(c *gin.Context) devicePageData {
+	data := devicePageData{NeedsLogin: true}
+	if !h.Cookies.Enabled {
+		return data
+	}
+	token, err := c.Cookie(helpers.AccessTokenCookie)
+	if err != nil {
+		return data
+	}
+	claims, err := h.Tokens.ValidateToken(requestContext(c), token)
+	if err != nil || !claims.IsAccessToken() || claims.Uid == "" || h.Accounts.CheckAccountActive(requestContext(c), claims.Uid, claims.IssuedAt.Unix()) != nil {
+		return data
+	}
+	data.NeedsLogin = false
+	data.Email = claims.Email
+	data.CSRFToken, _ = c.Cookie(helpers.CSRFTokenCookie)
+	return data
+}
+
+// deviceUser identifies the user deciding on a device request, by the session
+// cookie and the form's CSRF token or by the email and password in the form
+func (h *Handler) deviceUser(ctx context.Context, c *gin.Context, needsLogin bool) (*models.User, error) {
+	if !needsLogin {
+		if !h.Cookies.CheckCSRFToken(c, c.PostForm("csrf_token")) {
+			return nil, errors.New("Your session has changed, reload the page and try again")
+		}
+		token, _ := c.Cookie(helpers.AccessTokenCookie)
+		claims, err := h.Tokens.ValidateToken(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		if !claims.IsAccessToken() || claims.Uid == "" {
+			return nil, errors.New("Your session has expired, log in again")
+		}
+		return h.Store.Users.GetByID(ctx, claims.Uid)
+	}
+
+	invalid := errors.New("Email or password is incorrect")
+	user, err := h.Store.Users.GetByEmail(ctx, c.PostForm("email"))
+	if err != nil || user.Password == nil {
+		h.auditLogin(c, nil, "unknown email", map[string]string{"email": c.PostForm("email"), "method": "device"})
+		return nil, invalid
+	}
+	if ok, _ := h.verifyPassword(ctx, c.PostForm("password"), *user.Password); !ok {
+		h.auditLogin(c, user, "wrong password", map[string]string{"method": "device"})
+		return nil, invalid
+	}
+	if models.UserStatus(*user) != models.StatusActive {
+		return nil, errors.New("Account is not active, log in to restore it first")
+	}
+	return user, nil
+}
+
+func renderDevicePage(c *gin.Context, status int, data devicePageData) {
+	c.Header("Cache-Control", "no-store")
+	// The approve button must not be clickjacked from another site
+	c.Header("X-Frame-Options", "DENY")
+	c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'; frame-ancestors 'none'")
+	c.Render(status, render.HTML{Template: devicePage, Name: "device", Data: data})
+}
+
+var devicePage = template.Must(template.New("device").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Connect a device</title>
+<style>
+body { font-family: sans-serif; max-width: 28rem; margin: 3rem auto; padding: 0 1rem; }
+input { display: block; width: 100%; margin: 0.25rem 0 1rem; padding: 0.5rem; box-sizing: border-box; }
+button { padding: 0.5rem 1rem; margin-right: 0.5rem; }
+.error { color: #b00020; }
+</style>
+</head>
+<body>
+<h1>Connect a device</h1>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+{{if .Message}}
+<p>{{.Message}}</p>
+{{else if .UserCode}}
+<p><strong>{{.Client}}</strong> is asking for access to your account{{if .Scope}} with the scopes <code>{{.Scope}}</code>{{end}}.</p>
+<p>Only approve if the code shown on your device is <strong>{{.UserCode}}</strong>.</p>
+<form method="post" action="/device">
+<input type="hidden" name="user_code" value="{{.UserCode}}">
+{{if .NeedsLogin}}
+<label>Email <input type="email" name="email" autocomplete="username" required></label>
+<label>Password <input type="password" name="password" autocomplete="current-password" required></label>
+{{else}}
+<input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+<p>Signed in as {{.Email}}.</p>
+{{end}}
+<button type="submit" name="action" value="approve">Approve</button>
+<button type="submit" name="action" value="deny">Deny</button>
+</form>
+{{else}}
+<form method="get" action="/device">
+<label>Enter the code shown on your device <input name="user_code" autocomplete="off" autofocus required></label>
+<button type="submit">Continue</button>
+</form>
+{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,47 @@
+package controllers
+
+import (
+	"html/template"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+)
+
+// redocScript is the pinned release of Redoc that renders the docs page
+const redocScript = "https://cdn.redoc.ly/redoc/v2.1.5/bundles/redoc.standalone.js"
+
+// OpenAPI serves the OpenAPI document of the API
+func (h *Handler) OpenAPI() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, h.OpenAPIDocument)
+	}
+}
+
+// Docs serves a page that renders the OpenAPI document for people
+func (h *Handler) Docs() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=300")
+		c.Render(http.StatusOK, render.HTML{Template: docsPage, Name: "docs", Data: gin.H{
+			"Title":  h.OpenAPIDocument.Info.Title,
+			"Script": redocScript,
+		}})
+	}
+}
+
+// The document is loaded relative to the page, so the docs keep working behind a path prefix
+var docsPage = template.Must(template.New("docs").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}} API</title>
+<style>body { margin: 0; padding: 0; }</style>
+</head>
+<body>
+<redoc spec-url="openapi.json"></redoc>
+<script src="{{.Script}}" crossorigin="anonymous"></script>
+</body>
+</html>
+`))
@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/arunprasad2002/go-jwt/audit"
+	"github.com/arunprasad2002/go-jwt/health"
+	"github.com/arunprasad2002/go-jwt/helpers"
+	"github.com/arunprasad2002/go-jwt/metrics"
+	"github.com/arunprasad2002/go-jwt/openapi"
+	"github.com/arunprasad2002/go-jwt/store"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+)
+
+// Handler holds the dependencies shared by all HTTP handlers
+type Handler struct {
+	Store    *store.Store
+	Tokens   *helpers.Tokens
+	Accounts *helpers.Accounts
+	Cookies  *helpers.Cookies
+	// Audit records security events, nothing is recorded if it is nil
+	Audit *audit.Recorder
+	// Metrics counts authentication outcomes, nothing is counted if it is nil
+	Metrics *metrics.Metrics
+	// Health runs the readiness checks
+	Health *health.Checker
+	// OpenAPIDocument describes the API, it is served with the docs page
+	OpenAPIDocument *openapi.Document
+
+	// DPoPClients are the audiences and service accounts that must use DPoP bound tokens
+	DPoPClients []string
+
+	// GoogleOAuth configures the Google login flow
+	GoogleOAuth *oauth2.Config
+	// FrontendURL is where users are sent with their tokens after Google login
+	FrontendURL string
+	// LogLevel is the level of the service's logger, changed through the admin endpoint
+	LogLevel *slog.LevelVar
+	// WebhooksAllowInsecure accepts http webhook URLs on private addresses, for development
+	WebhooksAllowInsecure bool
+}
+
+// requestContext returns a context with the request's values, such as its span,
+// that is not cancelled with the request, so work that was started is finished
+// even if the client goes away
+func requestContext(c *gin.Context) context.Context {
+	return context.WithoutCancel(c.Request.Context())
+}
@@ -0,0 +1,29 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/arunprasad2002/go-jwt/health"
+	"github.com/gin-gonic/gin"
+)
+
+// Healthz reports that the process is alive, it checks no dependencies
+func (h *Handler) Healthz() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, gin.H{"status": health.StatusOK})
+	}
+}
+
+// Readyz runs the readiness checks, it answers 503 if any fails or the service is shutting down
+func (h *Handler) Readyz() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report := h.Health.Ready(c.Request.Context())
+		status := http.StatusOK
+		if !report.OK() {
+			status = http.StatusServiceUnavailable
+		}
+		c.Header("Cache-Control", "no-store")
+		c.JSON(status, report)
+	}
+}
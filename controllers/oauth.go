@@ -5,122 +5,168 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
+	"slices"
 	"time"
 
+	"github.com/arunprasad2002/go-jwt/audit"
 	"github.com/arunprasad2002/go-jwt/helpers"
 	"github.com/arunprasad2002/go-jwt/models"
+	"github.com/arunprasad2002/go-jwt/problem"
+	"github.com/arunprasad2002/go-jwt/tracing"
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 )
 
-// Load credentials from environment variables
-var googleOauthConfig = &oauth2.Config{
-	ClientID:     os.Getenv("GOOGLE_CLIENT_ID"),
-	ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
-	RedirectURL:  os.Getenv("GOOGLE_REDIRECT_URL"),
-	Scopes:       []string{"https://www.googleapis.com/auth/userinfo.email", "https://www.googleapis.com/auth/userinfo.profile"},
-	Endpoint:     google.Endpoint,
+// GoogleOAuthConfig builds the Google OAuth client configuration
+func GoogleOAuthConfig(clientID string, clientSecret string, redirectURL string) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       []string{"https://www.googleapis.com/auth/userinfo.email", "https://www.googleapis.com/auth/userinfo.profile"},
+		Endpoint:     google.Endpoint,
+	}
 }
 
 var oauthStateString = "random-string"
 
 // GoogleLogin redirects users to Google’s authentication page
-func GoogleLogin(c *gin.Context) {
-	url := googleOauthConfig.AuthCodeURL(oauthStateString)
+func (h *Handler) GoogleLogin(c *gin.Context) {
+	url := h.GoogleOAuth.AuthCodeURL(oauthStateString)
 	c.Redirect(http.StatusFound, url)
 }
 
 // GoogleCallback handles the callback from Google after authentication
-func GoogleCallback(c *gin.Context) {
+func (h *Handler) GoogleCallback(c *gin.Context) {
 	state := c.Query("state")
 	if state != oauthStateString {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid OAuth state"})
+		problem.Write(c, problem.New(problem.CodeOAuthStateInvalid, ""))
 		return
 	}
 
+	// Calls to Google carry on the request's trace
+	googleCtx := context.WithValue(requestContext(c), oauth2.HTTPClient, &http.Client{
+		Transport: tracing.Transport(http.DefaultTransport),
+		Timeout:   30 * time.Second,
+	})
 	code := c.Query("code")
-	token, err := googleOauthConfig.Exchange(context.Background(), code)
+	token, err := h.GoogleOAuth.Exchange(googleCtx, code)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to exchange token"})
+		problem.Write(c, problem.Wrap(err, problem.CodeIdentityProvider, "Failed to exchange token"))
 		return
 	}
 
 	// Fetch user info from Google
-	client := googleOauthConfig.Client(context.Background(), token)
-	resp, err := client.Get("https://www.googleapis.com/oauth2/v2/userinfo")
+	client := h.GoogleOAuth.Client(googleCtx, token)
+	req, err := http.NewRequestWithContext(googleCtx, http.MethodGet, "https://www.googleapis.com/oauth2/v2/userinfo", nil)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user info"})
+		problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Failed to fetch user info"))
+		return
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		problem.Write(c, problem.Wrap(err, problem.CodeIdentityProvider, "Failed to fetch user info"))
 		return
 	}
 	defer resp.Body.Close()
 
 	var userInfo map[string]interface{}
 	if err := json.NewDecoder(resp.Body).Decode(&userInfo); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode user info"})
+		problem.Write(c, problem.Wrap(err, problem.CodeIdentityProvider, "Failed to decode user info"))
 		return
 	}
 
+	googleId, googleIdOk := userInfo["id"].(string)
 	email, emailOk := userInfo["email"].(string)
 	firstName, firstNameOk := userInfo["given_name"].(string)
 	lastName, lastNameOk := userInfo["family_name"].(string)
 
-	if !emailOk || !firstNameOk || !lastNameOk {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user data from Google"})
+	if !googleIdOk || !emailOk || !firstNameOk || !lastNameOk {
+		problem.Write(c, problem.New(problem.CodeIdentityProvider, "Invalid user data from Google"))
 		return
 	}
 
 	// Check if user exists in DB
-	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	var ctx, cancel = context.WithTimeout(requestContext(c), 100*time.Second)
 	defer cancel()
 
-	var foundUser models.User
-	err = userCollection.FindOne(ctx, bson.M{"email": email}).Decode(&foundUser)
+	identity := models.Identity{Provider: "google", Subject: googleId, Email: email}
+	foundUser, err := h.Store.Users.GetByEmail(ctx, email)
 
 	if err != nil {
-		// Create new user if not found
+		// Create new user if not found, already linked to the Google account
+		linked := identity
+		linked.Linked_at = time.Now()
 		newUser := models.User{
 			Email:      &email,
 			First_name: &firstName,
 			Last_name:  &lastName,
-			User_type:  stringPointer("user"), // Default user type
+			User_type:  stringPointer(models.UserTypeUser),
 			User_id:    stringPointer(primitive.NewObjectID().Hex()),
+			Identities: []models.Identity{linked},
 		}
 
-		_, err := userCollection.InsertOne(ctx, newUser)
+		err := h.createUser(ctx, &newUser, "google")
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+			problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Failed to create user"))
 			return
 		}
-		foundUser = newUser
+		foundUser = &newUser
+		h.audit(c, models.AuditEvent{
+			Action:      audit.ActionSignup,
+			Outcome:     models.AuditSuccess,
+			Actor_id:    *newUser.User_id,
+			Actor_type:  *newUser.User_type,
+			Target_id:   *newUser.User_id,
+			Target_type: audit.TargetUser,
+			Details:     map[string]string{"method": "google"},
+		})
 	}
 
-	// Generate JWT tokens
-	tokenStr, refreshToken, err := helpers.GenerateAllTokens(
-		*foundUser.Email,
-		*foundUser.First_name,
-		*foundUser.Last_name,
-		*foundUser.User_type,
-		*foundUser.User_id,
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Token generation failed"})
+	if models.UserStatus(*foundUser) == models.StatusDeactivated {
+		h.auditLogin(c, foundUser, "account is deactivated", map[string]string{"method": "google"})
+		problem.Write(c, problem.New(problem.CodeUserDeactivated, ""))
 		return
 	}
+	if models.UserStatus(*foundUser) == models.StatusPendingDeletion {
+		if _, err := h.Accounts.SetAccountStatus(ctx, *foundUser.User_id, models.StatusActive); err != nil {
+			problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Failed to restore account"))
+			return
+		}
+	}
 
-	// Update tokens in DB
-	helpers.UpdateAllTokens(tokenStr, refreshToken, foundUser.User_id)
-	// Get base URL from environment variable
-	baseURL := os.Getenv("CREATE_RESUME_BASE_URL")
-	if baseURL == "" {
-		baseURL = "https://recreate-resume.vercel.app" // Fallback if not set
+	// Link the Google account to the user
+	if err := h.Accounts.LinkIdentity(ctx, *foundUser.User_id, identity); err != nil {
+		problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Failed to link Google account"))
+		return
 	}
 
-	// Redirect user to frontend with tokens (or store in cookies)
-	redirectURL := fmt.Sprintf("%s?token=%s&refreshToken=%s", baseURL, tokenStr, refreshToken)
+	// Browsers cannot send DPoP proofs, so clients that require them cannot use Google login
+	audience, _ := h.Tokens.Audience("")
+	if slices.Contains(h.DPoPClients, audience) {
+		problem.Write(c, helpers.ErrDPoPRequired)
+		return
+	}
+
+	// Generate JWT tokens and record the session
+	tokenStr, refreshToken, err := h.issueUserTokens(ctx, c, foundUser, audience, helpers.UserScopes(*foundUser.User_type), nil)
+	if err != nil {
+		problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Token generation failed"))
+		return
+	}
+	h.auditLogin(c, foundUser, "", map[string]string{"method": "google", "audience": audience})
+	// Redirect user to frontend with tokens in cookies in browser mode, in the URL otherwise
+	if h.Cookies.Enabled {
+		if err := h.Cookies.SetAuthCookies(c, tokenStr, refreshToken); err != nil {
+			problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Failed to set cookies"))
+			return
+		}
+		c.Redirect(http.StatusFound, h.FrontendURL)
+		return
+	}
+	redirectURL := fmt.Sprintf("%s?token=%s&refreshToken=%s", h.FrontendURL, tokenStr, refreshToken)
 	c.Redirect(http.StatusFound, redirectURL)
 }
 
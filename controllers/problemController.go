@@ -0,0 +1,36 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/arunprasad2002/go-jwt/problem"
+	"github.com/gin-gonic/gin"
+)
+
+// Problems lists every error code of problem responses with its status and title
+func (h *Handler) Problems() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=3600")
+		c.JSON(http.StatusOK, gin.H{"problems": problem.Codes})
+	}
+}
+
+// ProblemType documents one error code, it is what the type of a problem response points to
+func (h *Handler) ProblemType() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		definition, ok := problem.Lookup(c.Param("code"))
+		if !ok {
+			problem.Write(c, problem.New(problem.CodeNotFound, "Unknown error code"))
+			return
+		}
+		c.Header("Cache-Control", "public, max-age=3600")
+		c.JSON(http.StatusOK, definition)
+	}
+}
+
+// NoRoute answers requests that match no route
+func (h *Handler) NoRoute() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		problem.Write(c, problem.New(problem.CodeRouteNotFound, c.Request.Method+" "+c.Request.URL.Path))
+	}
+}
@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/arunprasad2002/go-jwt/audit"
+	"github.com/arunprasad2002/go-jwt/helpers"
+	"github.com/arunprasad2002/go-jwt/models"
+	"github.com/arunprasad2002/go-jwt/problem"
+	"github.com/arunprasad2002/go-jwt/store"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CreateServiceAccount registers a service account. Its client secret is only shown in this response.
+func (h *Handler) CreateServiceAccount() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := helpers.ChekcUserType(c, "ADMIN"); err != nil {
+			problem.Write(c, err)
+			return
+		}
+		ctx, cancel := context.WithTimeout(requestContext(c), 100*time.Second)
+		defer cancel()
+
+		var request models.ServiceAccountRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			problem.Write(c, problem.Body(err))
+			return
+		}
+		if err := validate.Struct(request); err != nil {
+			problem.Write(c, err)
+			return
+		}
+		for _, scope := range request.Scopes {
+			if !helpers.HasScopes(helpers.ServiceAccountScopes(), scope) {
+				problem.Write(c, problem.New(problem.CodeScopeNotAllowed, "Scope "+scope+" cannot be given to a service account"))
+				return
+			}
+		}
+		for _, key := range request.Public_keys {
+			if _, err := key.PublicKey(); err != nil || key.Kid == "" {
+				problem.Write(c, problem.New(problem.CodeInvalidPublicKey, "Public keys must be valid JWKs with a kid"))
+				return
+			}
+		}
+
+		secret, hash, err := helpers.NewClientSecret()
+		if err != nil {
+			problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Failed to create client secret"))
+			return
+		}
+		now := time.Now()
+		account := models.ServiceAccount{
+			Client_id:   "svc_" + primitive.NewObjectID().Hex(),
+			Name:        request.Name,
+			Scopes:      request.Scopes,
+			Secret_hash: hash,
+			Public_keys: request.Public_keys,
+			Created_by:  c.GetString("uid"),
+			Created_at:  now,
+			Updated_at:  now,
+
+			Tls_client_auth_subject_dn: request.Tls_client_auth_subject_dn,
+		}
+		if err := h.Store.ServiceAccounts.Create(ctx, &account); err != nil {
+			problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Service account could not be created"))
+			return
+		}
+		h.audit(c, models.AuditEvent{
+			Action:      audit.ActionServiceAccountCreated,
+			Outcome:     models.AuditSuccess,
+			Target_id:   account.Client_id,
+			Target_type: audit.TargetServiceAccount,
+			Details:     map[string]string{"name": account.Name, "scope": strings.Join(account.Scopes, " ")},
+		})
+		c.JSON(http.StatusCreated, gin.H{"service_account": account, "client_secret": secret})
+	}
+}
+
+func (h *Handler) ListServiceAccounts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := helpers.ChekcUserType(c, "ADMIN"); err != nil {
+			problem.Write(c, err)
+			return
+		}
+		ctx, cancel := context.WithTimeout(requestContext(c), 100*time.Second)
+		defer cancel()
+
+		accounts, err := h.Store.ServiceAccounts.List(ctx)
+		if err != nil {
+			problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Failed to list service accounts"))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"service_accounts": accounts})
+	}
+}
+
+// RotateServiceAccountSecret replaces the client secret. The old secret stops working immediately.
+func (h *Handler) RotateServiceAccountSecret() gin.HandlerFunc {
+	return h.updateServiceAccount(audit.ActionServiceAccountRotated, func(account *models.ServiceAccount, response gin.H) error {
+		secret, hash, err := helpers.NewClientSecret()
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		account.Secret_hash = hash
+		account.Secret_rotated_at = &now
+		response["client_secret"] = secret
+		return nil
+	})
+}
+
+// DisableServiceAccount stops the service account from getting tokens and makes its current tokens invalid
+func (h *Handler) DisableServiceAccount() gin.HandlerFunc {
+	return h.updateServiceAccount(audit.ActionServiceAccountDisabled, func(account *models.ServiceAccount, response gin.H) error {
+		if account.Disabled_at == nil {
+			now := time.Now()
+			account.Disabled_at = &now
+		}
+		return nil
+	})
+}
+
+// updateServiceAccount applies change to the service account named in the path and stores it
+func (h *Handler) updateServiceAccount(action string, change func(account *models.ServiceAccount, response gin.H) error) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := helpers.ChekcUserType(c, "ADMIN"); err != nil {
+			problem.Write(c, err)
+			return
+		}
+		ctx, cancel := context.WithTimeout(requestContext(c), 100*time.Second)
+		defer cancel()
+
+		account, err := h.Store.ServiceAccounts.GetByClientID(ctx, c.Param("client_id"))
+		if errors.Is(err, store.ErrNotFound) {
+			problem.Write(c, problem.New(problem.CodeServiceAccountNotFound, ""))
+			return
+		}
+		if err != nil {
+			problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Failed to load service account"))
+			return
+		}
+
+		response := gin.H{}
+		if err := change(account, response); err != nil {
+			problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Failed to update service account"))
+			return
+		}
+		account.Updated_at = time.Now()
+		if err := h.Store.ServiceAccounts.Update(ctx, account); err != nil {
+			problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Failed to update service account"))
+			return
+		}
+		h.audit(c, models.AuditEvent{
+			Action:      action,
+			Outcome:     models.AuditSuccess,
+			Target_id:   account.Client_id,
+			Target_type: audit.TargetServiceAccount,
+		})
+		response["service_account"] = account
+		c.JSON(http.StatusOK, response)
+	}
+}
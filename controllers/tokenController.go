@@ -0,0 +1,274 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/arunprasad2002/go-jwt/audit"
+	"github.com/arunprasad2002/go-jwt/helpers"
+	"github.com/arunprasad2002/go-jwt/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+	tokenExchangeGrant  = "urn:ietf:params:oauth:grant-type:token-exchange"
+	accessTokenType     = "urn:ietf:params:oauth:token-type:access_token"
+	jwtTokenType        = "urn:ietf:params:oauth:token-type:jwt"
+	deviceCodeGrant     = "urn:ietf:params:oauth:grant-type:device_code"
+)
+
+var errInvalidClient = errors.New("client authentication failed")
+
+// Token is the OAuth 2.0 token endpoint. It takes form encoded requests and
+// answers with RFC 6749 style JSON responses and errors.
+func (h *Handler) Token() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "no-store")
+
+		switch grantType := c.PostForm("grant_type"); grantType {
+		case "client_credentials":
+			h.clientCredentials(c)
+		case tokenExchangeGrant:
+			h.tokenExchange(c)
+		case deviceCodeGrant:
+			h.deviceCode(c)
+		case "":
+			oauthError(c, http.StatusBadRequest, "invalid_request", "grant_type is required")
+		default:
+			oauthError(c, http.StatusBadRequest, "unsupported_grant_type", "grant type "+grantType+" is not supported")
+		}
+	}
+}
+
+// clientCredentials issues a short-lived access token to an authenticated service account
+func (h *Handler) clientCredentials(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(requestContext(c), 10*time.Second)
+	defer cancel()
+
+	account, err := h.authenticateClient(ctx, c)
+	if err != nil {
+		h.auditToken(c, "client_credentials", "", "", err.Error(), nil)
+		rejectClient(c, err)
+		return
+	}
+
+	scopes, err := helpers.GrantScopes(account.Scopes, c.PostForm("scope"))
+	if err != nil {
+		oauthError(c, http.StatusBadRequest, "invalid_scope", err.Error())
+		return
+	}
+	cnf, err := h.tokenBinding(c, account.Client_id)
+	if err != nil {
+		oauthError(c, http.StatusBadRequest, "invalid_dpop_proof", err.Error())
+		return
+	}
+	token, err := h.Tokens.GenerateServiceToken(ctx, account.Client_id, scopes, cnf)
+	if err != nil {
+		oauthError(c, http.StatusInternalServerError, "server_error", "token generation failed")
+		return
+	}
+	h.auditToken(c, "client_credentials", account.Client_id, "SERVICE", "", map[string]string{"scope": strings.Join(scopes, " ")})
+	c.JSON(http.StatusOK, tokenResponse(token, helpers.ServiceTokenLifetime, scopes, cnf))
+}
+
+// tokenExchange lets a service swap the access token of a user it is serving
+// for a short-lived token restricted to a downstream audience and fewer scopes (RFC 8693)
+func (h *Handler) tokenExchange(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(requestContext(c), 10*time.Second)
+	defer cancel()
+
+	account, err := h.authenticateClient(ctx, c)
+	if err != nil {
+		h.auditToken(c, "token_exchange", "", "", err.Error(), nil)
+		rejectClient(c, err)
+		return
+	}
+	if !helpers.HasScopes(account.Scopes, helpers.ScopeTokenExchange) {
+		oauthError(c, http.StatusBadRequest, "unauthorized_client", "client may not exchange tokens")
+		return
+	}
+
+	switch c.PostForm("subject_token_type") {
+	case accessTokenType, jwtTokenType:
+	default:
+		oauthError(c, http.StatusBadRequest, "invalid_request", "subject_token_type must be "+accessTokenType)
+		return
+	}
+	if tokenType := c.PostForm("requested_token_type"); tokenType != "" && tokenType != accessTokenType {
+		oauthError(c, http.StatusBadRequest, "invalid_request", "only access tokens can be requested")
+		return
+	}
+	if c.PostForm("audience") == "" {
+		oauthError(c, http.StatusBadRequest, "invalid_request", "audience is required")
+		return
+	}
+
+	// The subject token must be a user's access token that is still good
+	subject, err := h.Tokens.ValidateToken(ctx, c.PostForm("subject_token"))
+	if err != nil {
+		h.auditToken(c, "token_exchange", account.Client_id, "SERVICE", err.Error(), nil)
+		oauthError(c, http.StatusBadRequest, "invalid_grant", err.Error())
+		return
+	}
+	if !subject.IsAccessToken() || subject.Uid == "" {
+		oauthError(c, http.StatusBadRequest, "invalid_grant", "subject_token is not a user access token")
+		return
+	}
+	if err := h.Accounts.CheckAccountActive(ctx, subject.Uid, subject.IssuedAt.Unix()); err != nil {
+		oauthError(c, http.StatusBadRequest, "invalid_grant", err.Error())
+		return
+	}
+
+	scopes, err := helpers.GrantScopes(subject.Scopes(), c.PostForm("scope"))
+	if err != nil {
+		oauthError(c, http.StatusBadRequest, "invalid_scope", err.Error())
+		return
+	}
+	cnf, err := h.tokenBinding(c, account.Client_id)
+	if err != nil {
+		oauthError(c, http.StatusBadRequest, "invalid_dpop_proof", err.Error())
+		return
+	}
+	token, lifetime, err := h.Tokens.ExchangeToken(ctx, subject, account.Client_id, c.PostForm("audience"), scopes, cnf)
+	if errors.Is(err, helpers.ErrUnknownAudience) {
+		oauthError(c, http.StatusBadRequest, "invalid_target", err.Error())
+		return
+	}
+	if err != nil {
+		oauthError(c, http.StatusInternalServerError, "server_error", "token generation failed")
+		return
+	}
+
+	// The exchanged token acts for the user, who is the target of the event
+	h.audit(c, models.AuditEvent{
+		Action:      audit.ActionTokenIssued,
+		Outcome:     models.AuditSuccess,
+		Actor_id:    account.Client_id,
+		Actor_type:  "SERVICE",
+		Target_id:   subject.Uid,
+		Target_type: audit.TargetUser,
+		Details: map[string]string{
+			"grant_type": "token_exchange",
+			"audience":   c.PostForm("audience"),
+			"scope":      strings.Join(scopes, " "),
+		},
+	})
+	response := tokenResponse(token, lifetime, scopes, cnf)
+	response["issued_token_type"] = accessTokenType
+	c.JSON(http.StatusOK, response)
+}
+
+// authenticateClient identifies the service account calling the token endpoint by
+// HTTP Basic credentials, client_id and client_secret form fields, a private_key_jwt
+// assertion, or a TLS client certificate
+func (h *Handler) authenticateClient(ctx context.Context, c *gin.Context) (*models.ServiceAccount, error) {
+	clientId, secret, basic := c.Request.BasicAuth()
+	if basic {
+		// Basic credentials are form encoded before being base64 encoded (RFC 6749 section 2.3.1)
+		clientId, _ = url.QueryUnescape(clientId)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientId, secret = c.PostForm("client_id"), c.PostForm("client_secret")
+	}
+
+	assertion := c.PostForm("client_assertion")
+	if assertion != "" {
+		if c.PostForm("client_assertion_type") != clientAssertionType {
+			return nil, errors.New("unsupported client_assertion_type")
+		}
+		subject, err := helpers.ClientAssertionSubject(assertion)
+		if err != nil || (clientId != "" && clientId != subject) {
+			return nil, errInvalidClient
+		}
+		clientId = subject
+	}
+	if clientId == "" {
+		return nil, errInvalidClient
+	}
+
+	account, err := h.Store.ServiceAccounts.GetByClientID(ctx, clientId)
+	if err != nil || account.Disabled_at != nil {
+		return nil, errInvalidClient
+	}
+	if assertion != "" {
+		if err := h.Tokens.VerifyClientAssertion(assertion, account, tokenURL(c)); err != nil {
+			return nil, errInvalidClient
+		}
+		return account, nil
+	}
+	// tls_client_auth: the client certificate alone authenticates the client (RFC 8705)
+	if secret == "" && account.Tls_client_auth_subject_dn != "" {
+		if !helpers.CheckClientCertificate(account, helpers.ClientCertificate(c)) {
+			return nil, errInvalidClient
+		}
+		return account, nil
+	}
+	if !helpers.CheckClientSecret(account, secret) {
+		return nil, errInvalidClient
+	}
+	return account, nil
+}
+
+// rejectClient answers a request whose client authentication failed
+func rejectClient(c *gin.Context, err error) {
+	if _, _, basic := c.Request.BasicAuth(); basic {
+		c.Header("WWW-Authenticate", `Basic realm="go-jwt"`)
+	}
+	oauthError(c, http.StatusUnauthorized, "invalid_client", err.Error())
+}
+
+// tokenURL is the address of the token endpoint as the client sees it, the audience of client assertions
+func tokenURL(c *gin.Context) string {
+	return helpers.BaseURL(c) + "/oauth/token"
+}
+
+// tokenBinding returns the confirmation to bind tokens issued to clientId with:
+// the key of the request's DPoP proof and the verified TLS client certificate,
+// if there are any. DPoP proofs are optional except for the clients in DPoPClients.
+func (h *Handler) tokenBinding(c *gin.Context, clientId string) (*helpers.Confirmation, error) {
+	cnf := &helpers.Confirmation{}
+	if proof := c.GetHeader(helpers.DPoPHeader); proof != "" {
+		jkt, err := h.Tokens.VerifyDPoPProof(proof, c.Request.Method, helpers.RequestURL(c), "")
+		if err != nil {
+			return nil, err
+		}
+		cnf.JKT = jkt
+	} else if slices.Contains(h.DPoPClients, clientId) {
+		return nil, helpers.ErrDPoPRequired
+	}
+	if cert := helpers.ClientCertificate(c); cert != nil {
+		cnf.X5tS256 = helpers.CertificateThumbprint(cert)
+	}
+	if cnf.JKT == "" && cnf.X5tS256 == "" {
+		return nil, nil
+	}
+	return cnf, nil
+}
+
+// tokenType is the token_type of tokens bound by cnf
+func tokenType(cnf *helpers.Confirmation) string {
+	if cnf != nil && cnf.JKT != "" {
+		return "DPoP"
+	}
+	return "Bearer"
+}
+
+func tokenResponse(token string, lifetime time.Duration, scopes []string, cnf *helpers.Confirmation) gin.H {
+	return gin.H{
+		"access_token": token,
+		"token_type":   tokenType(cnf),
+		"expires_in":   int(lifetime.Seconds()),
+		"scope":        strings.Join(scopes, " "),
+	}
+}
+
+// oauthError writes an RFC 6749 section 5.2 error response
+func oauthError(c *gin.Context, status int, code string, description string) {
+	c.JSON(status, gin.H{"error": code, "error_description": description})
+}
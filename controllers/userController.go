@@ -2,32 +2,67 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
+	"reflect"
 	"strconv"
+	"strings"
 	"time"
 
-	"github.com/arunprasad2002/go-jwt/database"
+	"github.com/arunprasad2002/go-jwt/audit"
 	"github.com/arunprasad2002/go-jwt/helpers"
+	"github.com/arunprasad2002/go-jwt/logging"
 	"github.com/arunprasad2002/go-jwt/models"
+	"github.com/arunprasad2002/go-jwt/problem"
+	"github.com/arunprasad2002/go-jwt/store"
+	"github.com/arunprasad2002/go-jwt/tracing"
+	"github.com/arunprasad2002/go-jwt/webhook"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 	"golang.org/x/crypto/bcrypt"
 )
 
-var userCollection *mongo.Collection = database.OpenCollection(database.Client, "user")
-var validate = validator.New()
+var validate = newValidator()
 
-func HashPassword(password string) string {
+// newValidator returns a validator that names fields by their JSON name, as clients know them
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			return field.Name
+		}
+		return name
+	})
+	return v
+}
+
+func HashPassword(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
 	if err != nil {
-		log.Panic(err)
+		return "", err
 	}
-	return string(bytes)
+	return string(bytes), nil
+}
+
+// hashPassword hashes a new password, timed and traced since bcrypt is slow on purpose
+func (h *Handler) hashPassword(ctx context.Context, password string) (hash string, err error) {
+	_, span := tracing.Start(ctx, "password.hash")
+	defer func(start time.Time) {
+		h.Metrics.PasswordHashed("hash", start)
+		tracing.End(span, err)
+	}(time.Now())
+	return HashPassword(password)
+}
+
+// verifyPassword checks a provided password against the user's hash, timed and traced
+func (h *Handler) verifyPassword(ctx context.Context, provided string, hash string) (bool, string) {
+	_, span := tracing.Start(ctx, "password.verify")
+	defer span.End()
+	defer h.Metrics.PasswordHashed("verify", time.Now())
+	return helpers.VerifyPassword(provided, hash)
 }
 
 func VerifyPassword(userPassword string, providedPassword string) (bool, string) {
@@ -42,51 +77,82 @@ func VerifyPassword(userPassword string, providedPassword string) (bool, string)
 	return check, msg
 }
 
-func SignUp() gin.HandlerFunc {
+func (h *Handler) SignUp() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		ctxTimeout, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		ctxTimeout, cancel := context.WithTimeout(requestContext(ctx), 100*time.Second)
 		defer cancel() // Only once
 
-		var user models.User
+		var req models.SignUpRequest
 
-		err := ctx.BindJSON(&user)
+		err := ctx.ShouldBindJSON(&req)
 		if err != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			problem.Write(ctx, problem.Body(err))
 			return
 		}
 
-		validateErr := validate.Struct(user)
+		validateErr := validate.Struct(req)
 		if validateErr != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": validateErr.Error()})
+			problem.Write(ctx, validateErr)
 			return
 		}
 
+		user := models.User{
+			First_name: req.First_name,
+			Last_name:  req.Last_name,
+			Password:   req.Password,
+			Email:      req.Email,
+			Phone:      req.Phone,
+			User_type:  stringPointer(models.UserTypeUser),
+		}
+
 		// Check if email exists
-		userEmailCount, err := userCollection.CountDocuments(ctxTimeout, bson.M{"email": user.Email})
+		emailExists, err := h.Store.Users.EmailExists(ctxTimeout, *user.Email)
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			problem.Write(ctx, err)
 			return
 		}
 
 		// Check if phone exists
-		userPhoneCount, err := userCollection.CountDocuments(ctxTimeout, bson.M{"phone": user.Phone})
+		phoneExists, err := h.Store.Users.PhoneExists(ctxTimeout, *user.Phone)
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			problem.Write(ctx, err)
 			return
 		}
 
-		if userEmailCount > 0 {
-			ctx.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
+		if emailExists {
+			h.Metrics.Signup("password", "email already exists")
+			h.audit(ctx, models.AuditEvent{
+				Action:  audit.ActionSignup,
+				Outcome: models.AuditFailure,
+				Reason:  "email already exists",
+				Details: map[string]string{"email": *user.Email},
+			})
+			problem.Write(ctx, problem.New(problem.CodeEmailTaken, ""))
 			return
 		}
 
-		if userPhoneCount > 0 {
-			ctx.JSON(http.StatusConflict, gin.H{"error": "Phone already exists"})
+		if phoneExists {
+			h.Metrics.Signup("password", "phone already exists")
+			h.audit(ctx, models.AuditEvent{
+				Action:  audit.ActionSignup,
+				Outcome: models.AuditFailure,
+				Reason:  "phone already exists",
+				Details: map[string]string{"email": *user.Email},
+			})
+			problem.Write(ctx, problem.New(problem.CodePhoneTaken, ""))
 			return
 		}
 
 		// Hash password
-		password := HashPassword(*user.Password)
+		password, err := h.hashPassword(ctxTimeout, *user.Password)
+		if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+			problem.Write(ctx, problem.New(problem.CodePasswordTooLong, "Password must be at most 72 bytes long"))
+			return
+		}
+		if err != nil {
+			problem.Write(ctx, problem.Wrap(err, problem.CodeInternal, "Failed to create user"))
+			return
+		}
 		user.Password = &password
 
 		// Set timestamps
@@ -96,49 +162,86 @@ func SignUp() gin.HandlerFunc {
 		userID := user.ID.Hex()
 		user.User_id = &userID
 
-		// Generate JWT tokens
-		token, refreshToken, _ := helpers.GenerateAllTokens(*user.Email, *user.First_name, *user.Last_name, *user.User_type, *user.User_id)
-		user.Token = &token
-		user.Refresh_token = &refreshToken
-
-		// Insert user into DB
-		resultInsertionNumber, insertErr := userCollection.InsertOne(ctxTimeout, user)
+		// Insert user into DB. Signup issues no tokens, they come with a session at login.
+		insertErr := h.createUser(ctxTimeout, &user, "password")
 		if insertErr != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "User could not be created"})
+			problem.Write(ctx, problem.Wrap(insertErr, problem.CodeInternal, "User could not be created"))
 			return
 		}
+		h.audit(ctx, models.AuditEvent{
+			Action:      audit.ActionSignup,
+			Outcome:     models.AuditSuccess,
+			Actor_id:    *user.User_id,
+			Actor_type:  *user.User_type,
+			Target_id:   *user.User_id,
+			Target_type: audit.TargetUser,
+		})
 
-		ctx.JSON(http.StatusOK, resultInsertionNumber)
+		ctx.JSON(http.StatusOK, models.NewUserResponse(user, models.VisibilitySelf))
 	}
 }
 
-func GetUser() gin.HandlerFunc {
+// createUser stores a new user and publishes user.created in the same transaction
+func (h *Handler) createUser(ctx context.Context, user *models.User, method string) error {
+	err := h.Store.Transaction(ctx, func(ctx context.Context, tx *store.Store) error {
+		if err := tx.Users.Create(ctx, user); err != nil {
+			return err
+		}
+		data := webhook.UserData(*user)
+		data.Method = method
+		return webhook.Publish(ctx, tx.WebhookEvents, webhook.EventUserCreated, data)
+	})
+	if err != nil {
+		h.Metrics.Signup(method, err.Error())
+		return err
+	}
+	h.Metrics.Signup(method, "")
+	return nil
+}
+
+func (h *Handler) GetUser() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		userId := ctx.Param("user_id")
 		err := helpers.MatchUserToUid(ctx, userId)
 		if err != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
+			h.audit(ctx, models.AuditEvent{
+				Action:      audit.ActionUserRead,
+				Outcome:     models.AuditFailure,
+				Reason:      err.Error(),
+				Target_id:   userId,
+				Target_type: audit.TargetUser,
+			})
+			problem.Write(ctx, err)
 			return
 		}
-		var context, cancel = context.WithTimeout(context.Background(), 100*time.Second)
-		var user models.User
-		err = userCollection.FindOne(context, bson.M{"user_id": userId}).Decode(&user)
+		var context, cancel = context.WithTimeout(requestContext(ctx), 100*time.Second)
+		user, err := h.Store.Users.GetByID(context, userId)
 		defer cancel()
+		if errors.Is(err, store.ErrNotFound) {
+			problem.Write(ctx, problem.New(problem.CodeUserNotFound, ""))
+			return
+		}
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"Error": err.Error()})
+			problem.Write(ctx, err)
 			return
 		}
-		ctx.JSON(http.StatusOK, user)
+		h.audit(ctx, models.AuditEvent{
+			Action:      audit.ActionUserRead,
+			Outcome:     models.AuditSuccess,
+			Target_id:   userId,
+			Target_type: audit.TargetUser,
+		})
+		ctx.JSON(http.StatusOK, models.NewUserResponse(*user, helpers.VisibilityFor(ctx, userId)))
 	}
 }
 
-func GetUsers() gin.HandlerFunc {
+func (h *Handler) GetUsers() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if err := helpers.ChekcUserType(c, "ADMIN"); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if err := helpers.CheckAdmin(c); err != nil {
+			problem.Write(c, err)
 			return
 		}
-		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var ctx, cancel = context.WithTimeout(requestContext(c), 100*time.Second)
 
 		recordPerPage, err := strconv.Atoi(c.Query("recordPerPage"))
 		if err != nil || recordPerPage < 1 {
@@ -150,154 +253,382 @@ func GetUsers() gin.HandlerFunc {
 		}
 
 		startIndex := (page - 1) * recordPerPage
-		startIndex, err = strconv.Atoi(c.Query("startIndex"))
-
-		matchStage := bson.D{{"$match", bson.D{{}}}}
-		groupStage := bson.D{{"$group", bson.D{
-			{"_id", bson.D{{"_id", "null"}}},
-			{"total_count", bson.D{{"$sum", 1}}},
-			{"data", bson.D{{"$push", "$$ROOT"}}}}}}
-		projectStage := bson.D{
-			{"$project", bson.D{
-				{"_id", 0},
-				{"total_count", 1},
-				{"user_items", bson.D{{"$slice", []interface{}{"$data", startIndex, recordPerPage}}}}}}}
-		result, err := userCollection.Aggregate(ctx, mongo.Pipeline{
-			matchStage, groupStage, projectStage})
+		if index, err := strconv.Atoi(c.Query("startIndex")); err == nil && index >= 0 {
+			startIndex = index
+		}
+
+		users, total, err := h.Store.Users.List(ctx, startIndex, recordPerPage)
 		defer cancel()
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing user items"})
-		}
-		var allusers []bson.M
-		if err = result.All(ctx, &allusers); err != nil {
-			log.Fatal(err)
+			problem.Write(c, problem.Wrap(err, problem.CodeInternal, "error occured while listing user items"))
+			return
 		}
-		c.JSON(http.StatusOK, allusers[0])
+		h.audit(c, models.AuditEvent{
+			Action:  audit.ActionUserList,
+			Outcome: models.AuditSuccess,
+			Details: map[string]string{"offset": strconv.Itoa(startIndex), "limit": strconv.Itoa(recordPerPage)},
+		})
+		c.JSON(http.StatusOK, gin.H{
+			"total_count": total,
+			"user_items":  models.NewUserResponses(users, models.VisibilityAdmin),
+		})
 	}
 }
 
-func Login() gin.HandlerFunc {
+// issueUserTokens mints a token pair for the user, bound by cnf if set, stores it on
+// the user and records the session. Every way of logging in a user ends here.
+func (h *Handler) issueUserTokens(ctx context.Context, c *gin.Context, user *models.User, audience string, scopes []string, cnf *helpers.Confirmation) (string, string, error) {
+	audience, err := h.Tokens.Audience(audience)
+	if err != nil {
+		return "", "", err
+	}
+	session := helpers.NewSession(*user.User_id, c.ClientIP(), c.Request.UserAgent(), audience, scopes)
+	token, refreshToken, err := h.Tokens.GenerateAllTokens(
+		ctx,
+		*user.Email,
+		*user.First_name,
+		*user.Last_name,
+		*user.User_type,
+		*user.User_id,
+		audience,
+		scopes,
+		cnf,
+		session.Session_id,
+		session.Refresh_id,
+	)
+	if err != nil {
+		return "", "", err
+	}
+	if err := helpers.UpdateAllTokens(ctx, h.Store.Users, token, refreshToken, user.User_id); err != nil {
+		return "", "", err
+	}
+	if err := h.Accounts.CreateSession(ctx, session); err != nil {
+		return "", "", err
+	}
+	return token, refreshToken, nil
+}
+
+func (h *Handler) Login() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		fmt.Println("Step 1: Received Login Request")
+		logger := logging.FromContext(c)
 
-		// Ensure userCollection is initialized
-		if userCollection == nil {
-			fmt.Println("Database connection not initialized")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		// Ensure the store is initialized
+		if h.Store == nil {
+			logger.Error("login failed: store not initialized")
+			problem.Write(c, problem.New(problem.CodeInternal, "Database error"))
 			return
 		}
 
 		// Set timeout context
-		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		ctx, cancel := context.WithTimeout(requestContext(c), 100*time.Second)
 		defer cancel()
 
-		var user models.User
-		var foundUser models.User
+		var user models.LoginRequest
 
 		// Bind JSON input
-		if err := c.BindJSON(&user); err != nil {
-			fmt.Println("Error parsing request body:", err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		if err := c.ShouldBindJSON(&user); err != nil {
+			logger.Debug("login request could not be parsed", "error", err)
+			problem.Write(c, problem.Body(err))
 			return
 		}
 
 		// Check if Email is provided
 		if user.Email == nil {
-			fmt.Println("Step 2: Email is nil")
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Email is required"})
+			problem.Write(c, problem.Invalid("email", "required", "is required"))
 			return
 		}
-		fmt.Println("Step 2: Received email:", *user.Email)
 
 		// Fetch user from database
-		fmt.Println("Step 3: Searching for user in DB")
-		err := userCollection.FindOne(ctx, bson.M{"email": *user.Email}).Decode(&foundUser)
+		foundUser, err := h.Store.Users.GetByEmail(ctx, *user.Email)
 		if err != nil {
-			fmt.Println("Step 3 Error: User not found in DB", err)
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Email or password is incorrect"})
+			logger.Info("login failed: unknown email", "email", *user.Email)
+			h.auditLogin(c, nil, "unknown email", map[string]string{"email": *user.Email})
+			problem.Write(c, problem.New(problem.CodeInvalidCredentials, "Email or password is incorrect"))
 			return
 		}
-		fmt.Println("Step 3: User found in DB:", *foundUser.Email)
 
 		// Check if Password is provided
 		if user.Password == nil {
-			fmt.Println("Step 4: Password is nil")
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Password is required"})
+			problem.Write(c, problem.Invalid("password", "required", "is required"))
 			return
 		}
 
 		// Ensure foundUser.Password is not nil before verification
 		if foundUser.Password == nil {
-			fmt.Println("Step 4 Error: Stored password is nil")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "User password not set"})
+			logger.Error("login failed: stored password is missing", "uid", foundUser.User_id)
+			problem.Write(c, problem.New(problem.CodePasswordNotSet, "Log in with the identity provider the account was created with"))
 			return
 		}
 
 		// Verify the password
-		fmt.Println("Step 4: Checking password")
-		passwordIsValid, msg := helpers.VerifyPassword(*user.Password, *foundUser.Password)
+		passwordIsValid, msg := h.verifyPassword(ctx, *user.Password, *foundUser.Password)
 		if !passwordIsValid {
-			fmt.Println("Step 4 Error: Password incorrect", msg)
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Email or password is incorrect"})
+			logger.Info("login failed: wrong password", "uid", foundUser.User_id, "reason", msg)
+			h.auditLogin(c, foundUser, "wrong password", nil)
+			problem.Write(c, problem.New(problem.CodeInvalidCredentials, "Email or password is incorrect"))
 			return
 		}
-		fmt.Println("Step 4: Password verified successfully")
 
 		// Ensure user_type is not nil
 		if foundUser.User_type == nil {
-			fmt.Println("Step 5 Error: User type is nil")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "User type not found"})
+			logger.Error("login failed: user type is missing", "uid", foundUser.User_id)
+			problem.Write(c, problem.New(problem.CodeInternal, "User type not found"))
 			return
 		}
 
 		// Ensure foundUser.User_id is not nil before token generation
 		if foundUser.User_id == nil {
-			fmt.Println("Step 5 Error: User ID is nil")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "User ID not found"})
+			logger.Error("login failed: user id is missing")
+			problem.Write(c, problem.New(problem.CodeInternal, "User ID not found"))
+			return
+		}
+
+		// Deactivated accounts cannot log in; logging in during the deletion grace period restores the account
+		switch models.UserStatus(*foundUser) {
+		case models.StatusDeactivated:
+			logger.Info("login failed: account is deactivated", "uid", *foundUser.User_id)
+			h.auditLogin(c, foundUser, "account is deactivated", nil)
+			problem.Write(c, problem.New(problem.CodeUserDeactivated, ""))
+			return
+		case models.StatusPendingDeletion:
+			logger.Info("login cancelled scheduled account deletion", "uid", *foundUser.User_id)
+			if _, err := h.Accounts.SetAccountStatus(ctx, *foundUser.User_id, models.StatusActive); err != nil {
+				problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Failed to restore account"))
+				return
+			}
+		}
+
+		// Grant the requested scopes, all the user's scopes if none were requested
+		scopes, err := helpers.GrantScopes(helpers.UserScopes(*foundUser.User_type), user.Scope)
+		if err != nil {
+			problem.Write(c, err)
+			return
+		}
+
+		audience, err := h.Tokens.Audience(user.Audience)
+		if err != nil {
+			problem.Write(c, err)
+			return
+		}
+		// Bind the tokens to the client's DPoP key or certificate if it presented one
+		cnf, err := h.tokenBinding(c, audience)
+		if err != nil {
+			problem.Write(c, err)
 			return
 		}
 
 		// Generate tokens
-		fmt.Println("Step 5: Generating tokens")
-		token, refreshToken, err := helpers.GenerateAllTokens(
-			*foundUser.Email,
-			*foundUser.First_name,
-			*foundUser.Last_name,
-			*foundUser.User_type,
-			*foundUser.User_id,
-		)
+		token, refreshToken, err := h.issueUserTokens(ctx, c, foundUser, audience, scopes, cnf)
 		if err != nil {
-			fmt.Println("Step 5 Error: Token generation failed", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Token generation failed"})
+			logger.Error("login failed: token generation failed", "uid", *foundUser.User_id, "error", err)
+			problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Token generation failed"))
 			return
 		}
-		fmt.Println("Step 5: Tokens generated successfully")
 
-		// Update user tokens in DB
-		fmt.Println("Step 6: Updating tokens in DB")
-		if err := helpers.UpdateAllTokens(token, refreshToken, foundUser.User_id); err != nil {
-			fmt.Println("Step 6 Error: Failed to update tokens in DB", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tokens"})
+		// Fetch updated user from DB, the store returns no user with an error
+		uid := *foundUser.User_id
+		foundUser, err = h.Store.Users.GetByID(ctx, uid)
+		if err != nil {
+			logger.Error("login failed: user could not be reloaded", "uid", uid, "error", err)
+			problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Failed to retrieve user data"))
 			return
 		}
+		// Send success response
+		logger.Info("login succeeded", "uid", *foundUser.User_id)
+		h.auditLogin(c, foundUser, "", map[string]string{"method": "password", "audience": audience, "scope": strings.Join(scopes, " ")})
+		response := gin.H{
+			"message": "Login successful",
+			"user":    models.NewUserResponse(*foundUser, models.VisibilitySelf),
+			"scope":   strings.Join(scopes, " "),
+		}
+		if h.Cookies.Enabled {
+			if err := h.Cookies.SetAuthCookies(c, token, refreshToken); err != nil {
+				problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Failed to set cookies"))
+				return
+			}
+		} else {
+			response["token"] = token
+			response["refresh_token"] = refreshToken
+			response["token_type"] = tokenType(cnf)
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
 
-		// Fetch updated user from DB
-		err = userCollection.FindOne(ctx, bson.M{"user_id": *foundUser.User_id}).Decode(&foundUser)
+// RefreshToken exchanges a refresh token for a new token pair, optionally with fewer scopes
+func (h *Handler) RefreshToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(requestContext(c), 100*time.Second)
+		defer cancel()
+
+		var request models.RefreshRequest
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&request); err != nil {
+				problem.Write(c, problem.Body(err))
+				return
+			}
+		}
+
+		// Browsers send the refresh token as a cookie, which needs the CSRF token too
+		if request.Refresh_token == "" && h.Cookies.Enabled {
+			if cookie, err := c.Cookie(helpers.RefreshTokenCookie); err == nil {
+				if !h.Cookies.CheckCSRF(c) {
+					problem.Write(c, problem.New(problem.CodeCSRFFailed, ""))
+					return
+				}
+				request.Refresh_token = cookie
+			}
+		}
+		if request.Refresh_token == "" {
+			problem.Write(c, problem.Invalid("refresh_token", "required", "is required"))
+			return
+		}
+
+		claims, err := h.Tokens.ValidateToken(ctx, request.Refresh_token)
+		if err != nil {
+			h.auditToken(c, "refresh_token", "", "", err.Error(), nil)
+			problem.Write(c, problem.Token(err))
+			return
+		}
+		if !claims.IsRefreshToken() {
+			h.auditToken(c, "refresh_token", claims.Subject, "", "token is not a refresh token", nil)
+			problem.Write(c, problem.New(problem.CodeTokenInvalid, "token is not a refresh token"))
+			return
+		}
+		if err := h.Accounts.CheckAccountActive(ctx, claims.Subject, claims.IssuedAt.Unix()); err != nil {
+			h.auditToken(c, "refresh_token", claims.Subject, "", err.Error(), nil)
+			problem.Write(c, problem.Token(err))
+			return
+		}
+
+		// A refresh token is used once. One that was already replaced has leaked, so the
+		// session is revoked and neither its thief nor its owner can refresh it anymore.
+		session, err := h.Store.Sessions.Get(ctx, claims.Sid)
+		if errors.Is(err, store.ErrNotFound) || err == nil && session.User_id != claims.Subject {
+			h.auditToken(c, "refresh_token", claims.Subject, "", "session not found", nil)
+			problem.Write(c, problem.New(problem.CodeTokenInvalid, "session not found"))
+			return
+		}
 		if err != nil {
-			fmt.Println("Step 6 Error: Failed to retrieve updated user", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user data"})
+			problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Failed to load the session"))
+			return
+		}
+		if session.Revoked_at != nil {
+			h.auditToken(c, "refresh_token", claims.Subject, "", "session is revoked", nil)
+			problem.Write(c, problem.New(problem.CodeTokenRevoked, "session is revoked"))
+			return
+		}
+		if session.Refresh_id != claims.ID {
+			h.revokeReusedSession(c, ctx, session)
 			return
 		}
-		fmt.Println("Step 6: User updated successfully")
 
-		// Hide password before sending response
-		foundUser.Password = nil
+		user, err := h.Store.Users.GetByID(ctx, claims.Subject)
+		if err != nil {
+			problem.Write(c, problem.Wrap(err, problem.CodeTokenInvalid, "User not found"))
+			return
+		}
 
-		// Send success response
-		fmt.Println("Step 7: Login successful")
+		// New tokens never get more than the session had, or than the user may have now
+		allowed := []string{}
+		for _, scope := range session.Scopes {
+			if helpers.HasScopes(helpers.UserScopes(*user.User_type), scope) {
+				allowed = append(allowed, scope)
+			}
+		}
+		scopes, err := helpers.GrantScopes(allowed, request.Scope)
+		if err != nil {
+			problem.Write(c, err)
+			return
+		}
+
+		// A bound refresh token can only be used by a client proving it holds the same keys
+		cnf, err := h.tokenBinding(c, claims.Audience[0])
+		if err == nil {
+			err = helpers.CheckBinding(claims.Cnf, cnf)
+		}
+		if err != nil {
+			problem.Write(c, err)
+			return
+		}
+
+		refreshId := helpers.NewTokenID()
+		token, refreshToken, err := h.Tokens.GenerateAllTokens(
+			ctx,
+			*user.Email,
+			*user.First_name,
+			*user.Last_name,
+			*user.User_type,
+			*user.User_id,
+			claims.Audience[0],
+			scopes,
+			cnf,
+			session.Session_id,
+			refreshId,
+		)
+		if err != nil {
+			problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Token generation failed"))
+			return
+		}
+		// Another request refreshed with the same token in the meantime
+		err = h.Store.Sessions.Rotate(ctx, session.Session_id, claims.ID, refreshId, scopes, time.Now().Add(helpers.RefreshTokenLifetime))
+		if errors.Is(err, store.ErrNotFound) {
+			h.revokeReusedSession(c, ctx, session)
+			return
+		}
+		if err != nil {
+			problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Failed to rotate the refresh token"))
+			return
+		}
+		if err := helpers.UpdateAllTokens(ctx, h.Store.Users, token, refreshToken, user.User_id); err != nil {
+			problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Failed to update tokens"))
+			return
+		}
+		h.auditToken(c, "refresh_token", *user.User_id, *user.User_type, "", map[string]string{
+			"audience": claims.Audience[0],
+			"scope":    strings.Join(scopes, " "),
+		})
+
+		if h.Cookies.Enabled {
+			if err := h.Cookies.SetAuthCookies(c, token, refreshToken); err != nil {
+				problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Failed to set cookies"))
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"scope": strings.Join(scopes, " ")})
+			return
+		}
 		c.JSON(http.StatusOK, gin.H{
-			"message": "Login successful",
-			"user":    foundUser,
+			"token":         token,
+			"refresh_token": refreshToken,
+			"token_type":    tokenType(cnf),
+			"scope":         strings.Join(scopes, " "),
 		})
 	}
 }
+
+// revokeReusedSession revokes a session whose replaced refresh token was presented
+func (h *Handler) revokeReusedSession(c *gin.Context, ctx context.Context, session *models.Session) {
+	if err := h.Store.Sessions.Revoke(ctx, session.Session_id, time.Now()); err != nil {
+		problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Failed to revoke the session"))
+		return
+	}
+	h.auditToken(c, "refresh_token", session.User_id, "", "refresh token reused", nil)
+	h.audit(c, models.AuditEvent{
+		Action:      audit.ActionSessionRevoked,
+		Outcome:     models.AuditSuccess,
+		Reason:      "refresh token reused",
+		Actor_id:    session.User_id,
+		Target_id:   session.Session_id,
+		Target_type: audit.TargetSession,
+	})
+	problem.Write(c, problem.New(problem.CodeTokenRevoked, "refresh token was already used, the session is revoked"))
+}
+
+// Logout clears the browser mode auth cookies
+func (h *Handler) Logout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		h.Cookies.ClearAuthCookies(c)
+		h.audit(c, models.AuditEvent{Action: audit.ActionLogout, Outcome: models.AuditSuccess})
+		c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+	}
+}
@@ -0,0 +1,119 @@
+package controllers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/arunprasad2002/go-jwt/app"
+	"github.com/arunprasad2002/go-jwt/config"
+	"github.com/arunprasad2002/go-jwt/models"
+	"github.com/arunprasad2002/go-jwt/store"
+	"github.com/gin-gonic/gin"
+)
+
+func TestResponsesOmitSecrets(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	cfg := config.Default()
+	cfg.SecretKey = strings.Repeat("k", 32)
+	cfg.LogLevel = "error"
+	// In browser mode login answers with cookies, so no response body may carry a token
+	cfg.CookieMode = true
+	st := store.NewMemoryStore()
+	application, err := app.New(cfg, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer application.Close(ctx)
+
+	cookies := map[string][]*http.Cookie{}
+	var bodies []string
+	do := func(t *testing.T, method string, path string, body string, as string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		for _, cookie := range cookies[as] {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		application.Router.ServeHTTP(w, req)
+		bodies = append(bodies, w.Body.String())
+		return w
+	}
+	signUp := func(email string, phone string) string {
+		w := do(t, http.MethodPost, "/users/signup",
+			`{"first_name":"Ada","last_name":"Lovelace","password":"correct horse","email":"`+email+`","phone":"`+phone+`"}`, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("signup: %d %s", w.Code, w.Body)
+		}
+		user, err := st.Users.GetByEmail(ctx, email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return *user.User_id
+	}
+	userId := signUp("ada@example.com", "+441111111111")
+	adminId := signUp("grace@example.com", "+442222222222")
+	if _, err := application.Accounts.SetUserType(ctx, adminId, models.UserTypeAdmin); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		as         string
+		wantStatus int
+		// loggingIn is the user whose cookies a login sets
+		loggingIn string
+	}{
+		{name: "login", method: http.MethodPost, path: "/users/login", body: `{"email":"ada@example.com","password":"correct horse"}`, wantStatus: http.StatusOK, loggingIn: userId},
+		{name: "admin login", method: http.MethodPost, path: "/users/login", body: `{"email":"grace@example.com","password":"correct horse"}`, wantStatus: http.StatusOK, loggingIn: adminId},
+		{name: "own user", method: http.MethodGet, path: "/users/" + userId, as: userId, wantStatus: http.StatusOK},
+		{name: "user read by an admin", method: http.MethodGet, path: "/users/" + userId, as: adminId, wantStatus: http.StatusOK},
+		{name: "admin read by the user", method: http.MethodGet, path: "/users/" + adminId, as: userId, wantStatus: http.StatusForbidden},
+		{name: "user list", method: http.MethodGet, path: "/users", as: adminId, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(t, tt.method, tt.path, tt.body, tt.as)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.loggingIn != "" {
+				cookies[tt.loggingIn] = w.Result().Cookies()
+			}
+		})
+	}
+
+	// Every secret stored once all the requests were made
+	secrets := []string{"correct horse"}
+	for _, id := range []string{userId, adminId} {
+		user, err := st.Users.GetByID(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, secret := range []*string{user.Password, user.Token, user.Refresh_token} {
+			if secret == nil || *secret == "" {
+				t.Fatalf("user %s lacks a stored secret, the test would prove nothing", id)
+			}
+			secrets = append(secrets, *secret)
+		}
+	}
+	for i, body := range bodies {
+		for _, secret := range secrets {
+			if strings.Contains(body, secret) {
+				t.Errorf("response %d contains a stored secret: %s", i+1, body)
+			}
+		}
+		for _, field := range []string{`"password"`, `"token"`, `"refresh_token"`} {
+			if strings.Contains(body, field) {
+				t.Errorf("response %d has field %s: %s", i+1, field, body)
+			}
+		}
+	}
+}
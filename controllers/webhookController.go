@@ -0,0 +1,211 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arunprasad2002/go-jwt/audit"
+	"github.com/arunprasad2002/go-jwt/helpers"
+	"github.com/arunprasad2002/go-jwt/models"
+	"github.com/arunprasad2002/go-jwt/problem"
+	"github.com/arunprasad2002/go-jwt/store"
+	"github.com/arunprasad2002/go-jwt/webhook"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultDeliveryPageSize = 100
+	maxDeliveryPageSize     = 1000
+)
+
+// CreateWebhook subscribes a URL to events. The signing secret is only shown in this response.
+func (h *Handler) CreateWebhook() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := helpers.ChekcUserType(c, "ADMIN"); err != nil {
+			problem.Write(c, err)
+			return
+		}
+		ctx, cancel := context.WithTimeout(requestContext(c), 100*time.Second)
+		defer cancel()
+
+		var request models.WebhookSubscriptionRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			problem.Write(c, problem.Body(err))
+			return
+		}
+		if err := validate.Struct(request); err != nil {
+			problem.Write(c, err)
+			return
+		}
+		if err := webhook.CheckURL(request.Url, h.WebhooksAllowInsecure); err != nil {
+			problem.Write(c, problem.New(problem.CodeWebhookInvalidURL, err.Error()))
+			return
+		}
+		for _, eventType := range request.Events {
+			if !webhook.IsEventType(eventType) {
+				problem.Write(c, problem.New(problem.CodeWebhookUnknownEvent, "Unknown event type "+eventType))
+				return
+			}
+		}
+
+		secret, err := webhook.NewSecret()
+		if err != nil {
+			problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Failed to create signing secret"))
+			return
+		}
+		subscription := models.WebhookSubscription{
+			Subscription_id: "whs_" + primitive.NewObjectID().Hex(),
+			Url:             request.Url,
+			Events:          request.Events,
+			Description:     request.Description,
+			Secret:          secret,
+			Created_by:      c.GetString("uid"),
+			Created_at:      time.Now(),
+		}
+		if err := h.Store.WebhookSubscriptions.Create(ctx, &subscription); err != nil {
+			problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Webhook could not be created"))
+			return
+		}
+		h.audit(c, models.AuditEvent{
+			Action:      audit.ActionWebhookCreated,
+			Outcome:     models.AuditSuccess,
+			Target_id:   subscription.Subscription_id,
+			Target_type: audit.TargetWebhook,
+			Details:     map[string]string{"url": subscription.Url, "events": strings.Join(subscription.Events, " ")},
+		})
+		c.JSON(http.StatusCreated, gin.H{"webhook": subscription, "secret": secret})
+	}
+}
+
+func (h *Handler) ListWebhooks() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := helpers.ChekcUserType(c, "ADMIN"); err != nil {
+			problem.Write(c, err)
+			return
+		}
+		ctx, cancel := context.WithTimeout(requestContext(c), 100*time.Second)
+		defer cancel()
+
+		subscriptions, err := h.Store.WebhookSubscriptions.List(ctx)
+		if err != nil {
+			problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Failed to list webhooks"))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"webhooks": subscriptions, "event_types": webhook.EventTypes})
+	}
+}
+
+// DeleteWebhook removes a subscription. Its pending deliveries become DEAD.
+func (h *Handler) DeleteWebhook() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := helpers.ChekcUserType(c, "ADMIN"); err != nil {
+			problem.Write(c, err)
+			return
+		}
+		ctx, cancel := context.WithTimeout(requestContext(c), 100*time.Second)
+		defer cancel()
+
+		subscriptionId := c.Param("subscription_id")
+		err := h.Store.WebhookSubscriptions.Delete(ctx, subscriptionId)
+		if errors.Is(err, store.ErrNotFound) {
+			problem.Write(c, problem.New(problem.CodeWebhookNotFound, ""))
+			return
+		}
+		if err != nil {
+			problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Failed to delete webhook"))
+			return
+		}
+		h.audit(c, models.AuditEvent{
+			Action:      audit.ActionWebhookDeleted,
+			Outcome:     models.AuditSuccess,
+			Target_id:   subscriptionId,
+			Target_type: audit.TargetWebhook,
+		})
+		c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted"})
+	}
+}
+
+// ListWebhookDeliveries returns deliveries newest first, filtered by status and
+// subscription_id. ?status=DEAD lists the dead letters.
+func (h *Handler) ListWebhookDeliveries() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := helpers.ChekcUserType(c, "ADMIN"); err != nil {
+			problem.Write(c, err)
+			return
+		}
+		ctx, cancel := context.WithTimeout(requestContext(c), 100*time.Second)
+		defer cancel()
+
+		status := strings.ToUpper(c.Query("status"))
+		switch status {
+		case "", models.WebhookPending, models.WebhookDelivered, models.WebhookDead:
+		default:
+			problem.Write(c, problem.Invalid("status", "oneof", "must be PENDING, DELIVERED or DEAD"))
+			return
+		}
+		limit := defaultDeliveryPageSize
+		if value := c.Query("limit"); value != "" {
+			var err error
+			if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > maxDeliveryPageSize {
+				problem.Write(c, problem.Invalid("limit", "range", "must be between 1 and "+strconv.Itoa(maxDeliveryPageSize)))
+				return
+			}
+		}
+
+		deliveries, err := h.Store.WebhookDeliveries.List(ctx, status, c.Query("subscription_id"), limit)
+		if err != nil {
+			problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Failed to list webhook deliveries"))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+	}
+}
+
+// RedeliverWebhook queues a delivery to be sent again right away with a fresh
+// set of attempts, typically to retry a dead letter once the receiver is fixed.
+func (h *Handler) RedeliverWebhook() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := helpers.ChekcUserType(c, "ADMIN"); err != nil {
+			problem.Write(c, err)
+			return
+		}
+		ctx, cancel := context.WithTimeout(requestContext(c), 100*time.Second)
+		defer cancel()
+
+		delivery, err := h.Store.WebhookDeliveries.Get(ctx, c.Param("delivery_id"))
+		if errors.Is(err, store.ErrNotFound) {
+			problem.Write(c, problem.New(problem.CodeDeliveryNotFound, ""))
+			return
+		}
+		if err != nil {
+			problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Failed to load delivery"))
+			return
+		}
+		if _, err := h.Store.WebhookSubscriptions.Get(ctx, delivery.Subscription_id); errors.Is(err, store.ErrNotFound) {
+			problem.Write(c, problem.New(problem.CodeWebhookSubscriptionGone, ""))
+			return
+		}
+
+		delivery.Status = models.WebhookPending
+		delivery.Attempts = 0
+		delivery.Next_attempt_at = time.Now()
+		delivery.Delivered_at = nil
+		if err := h.Store.WebhookDeliveries.Update(ctx, delivery); err != nil {
+			problem.Write(c, problem.Wrap(err, problem.CodeInternal, "Failed to redeliver"))
+			return
+		}
+		h.audit(c, models.AuditEvent{
+			Action:      audit.ActionWebhookRedelivered,
+			Outcome:     models.AuditSuccess,
+			Target_id:   delivery.Delivery_id,
+			Target_type: audit.TargetWebhookDelivery,
+			Details:     map[string]string{"subscription_id": delivery.Subscription_id, "event_id": delivery.Event_id},
+		})
+		c.JSON(http.StatusAccepted, gin.H{"delivery": delivery})
+	}
+}
@@ -3,68 +3,103 @@ package database
 import (
 	"context"
 	"fmt"
-	"log"
-	"os"
+	"log/slog"
 	"time"
 
-	"github.com/joho/godotenv"
+	"github.com/arunprasad2002/go-jwt/config"
+	"github.com/arunprasad2002/go-jwt/store"
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func DBInstance() *mongo.Client {
-	// More robust environment handling
-	// Try to load .env, but don't fail if it doesn't exist
-	isRailway := os.Getenv("RAILWAY_ENVIRONMENT") != "" || os.Getenv("RAILWAY_STATIC_URL") != ""
-
-	if !isRailway {
-		err := godotenv.Load(".env")
-		if err != nil {
-			log.Println("Warning: .env file not found, using system environment variables")
-		}
-	} else {
-		log.Println("Running in Railway environment, using Railway environment variables")
-	}
-
-	// Get MongoDB URL from environment
-	MongoDB := os.Getenv("MONGODB_URL")
-	if MongoDB == "" {
-		log.Fatal("Error: MONGODB_URL environment variable not set")
-	}
-
-	// Create MongoDB client
-	client, err := mongo.NewClient(options.Client().ApplyURI(MongoDB))
-	if err != nil {
-		log.Fatal(err)
+// DBInstance connects to MongoDB at url and verifies the connection. monitor, if
+// set, is told about every command the client runs.
+func DBInstance(ctx context.Context, url string, monitor *event.CommandMonitor) (*mongo.Client, error) {
+	if url == "" {
+		return nil, fmt.Errorf("MONGODB_URL is not set")
 	}
 
 	// Connect to MongoDB with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
-	err = client.Connect(ctx)
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(url).SetMonitor(monitor))
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	// Verify connection
 	err = client.Ping(ctx, nil)
 	if err != nil {
-		log.Fatal("Failed to connect to MongoDB: ", err)
+		client.Disconnect(context.Background())
+		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
 	}
 
-	fmt.Println("Connected to MongoDB")
-	return client
+	slog.Info("connected to MongoDB")
+	return client, nil
 }
 
-var Client *mongo.Client = DBInstance()
-
-func OpenCollection(client *mongo.Client, collectionName string) *mongo.Collection {
-	// Get database name from environment or use default
-	dbName := os.Getenv("MONGODB_DATABASE")
-	if dbName == "" {
-		dbName = "cluster0" // fallback to your default
+// OpenStore opens the storage backend selected by cfg.StoreBackend. monitor only
+// applies to MongoDB.
+func OpenStore(ctx context.Context, cfg config.Config, monitor *event.CommandMonitor) (*store.Store, error) {
+	switch cfg.StoreBackend {
+	case "mongo":
+		client, err := DBInstance(ctx, cfg.MongoURL, monitor)
+		if err != nil {
+			return nil, err
+		}
+		if err := store.MigrateMongo(ctx, client, cfg.MongoDatabase); err != nil {
+			client.Disconnect(ctx)
+			return nil, fmt.Errorf("failed to migrate mongo store: %w", err)
+		}
+		return store.NewMongoStore(client, cfg.MongoDatabase), nil
+	case "postgres", "sqlite":
+		if cfg.DatabaseURL == "" {
+			return nil, fmt.Errorf("DATABASE_URL is not set")
+		}
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		open := store.OpenPostgres
+		if cfg.StoreBackend == "sqlite" {
+			open = store.OpenSQLite
+		}
+		s, err := open(ctx, cfg.DatabaseURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s store: %w", cfg.StoreBackend, err)
+		}
+		slog.Info("connected to store", "backend", cfg.StoreBackend)
+		return s, nil
+	case "memory":
+		slog.Warn("using in-memory store, data is lost on restart")
+		return store.NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown store backend %q", cfg.StoreBackend)
 	}
+}
 
-	var collection *mongo.Collection = client.Database(dbName).Collection(collectionName)
-	return collection
+// CombineMonitors returns a monitor that passes every command event to each of monitors.
+func CombineMonitors(monitors ...*event.CommandMonitor) *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			for _, m := range monitors {
+				if m.Started != nil {
+					m.Started(ctx, e)
+				}
+			}
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			for _, m := range monitors {
+				if m.Succeeded != nil {
+					m.Succeeded(ctx, e)
+				}
+			}
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			for _, m := range monitors {
+				if m.Failed != nil {
+					m.Failed(ctx, e)
+				}
+			}
+		},
+	}
 }
@@ -0,0 +1,175 @@
+// Package dpop verifies DPoP proofs (RFC 9449). The service and package
+// verifier both check proofs with it, so it only depends on net/http.
+package dpop
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arunprasad2002/go-jwt/jwk"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Algorithms are the signing algorithms accepted for DPoP proofs.
+var Algorithms = []string{"ES256", "RS256"}
+
+// proofWindow is how long after its iat a DPoP proof is accepted. Its jti
+// is remembered for as long, so a proof cannot be replayed.
+const proofWindow = time.Minute
+
+var ErrInvalidProof = errors.New("invalid DPoP proof")
+
+type claims struct {
+	HTM string `json:"htm"`
+	HTU string `json:"htu"`
+	// ATH is the hash of the access token the proof is sent with
+	ATH string `json:"ath,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Verifier checks DPoP proofs and remembers the ones it accepted.
+type Verifier struct {
+	leeway time.Duration
+	replay *replayCache
+}
+
+// NewVerifier creates a Verifier. leeway tolerates clock skew between the server and its clients.
+func NewVerifier(leeway time.Duration) *Verifier {
+	return &Verifier{
+		leeway: leeway,
+		replay: &replayCache{expires: map[string]time.Time{}},
+	}
+}
+
+// Verify checks a DPoP proof made for a request with method to requestURL and
+// returns the thumbprint of the key it was signed with. When the proof comes
+// with an access token, accessToken must be that token. Errors wrap
+// ErrInvalidProof.
+func (v *Verifier) Verify(proof string, method string, requestURL string, accessToken string) (string, error) {
+	parser := jwt.NewParser(
+		jwt.WithValidMethods(Algorithms),
+		jwt.WithLeeway(v.leeway),
+		jwt.WithIssuedAt(),
+	)
+	var key jwk.Key
+	proofClaims := &claims{}
+	_, err := parser.ParseWithClaims(proof, proofClaims, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != "dpop+jwt" {
+			return nil, errors.New("typ must be dpop+jwt")
+		}
+		raw, ok := token.Header["jwk"].(map[string]interface{})
+		if !ok {
+			return nil, errors.New("no jwk header")
+		}
+		if _, private := raw["d"]; private {
+			return nil, errors.New("jwk header contains a private key")
+		}
+		encoded, err := json.Marshal(raw)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(encoded, &key); err != nil {
+			return nil, err
+		}
+		return key.PublicKey()
+	})
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidProof, err)
+	}
+
+	if proofClaims.IssuedAt == nil || time.Since(proofClaims.IssuedAt.Time) > proofWindow+v.leeway {
+		return "", fmt.Errorf("%w: iat is missing or too old", ErrInvalidProof)
+	}
+	if proofClaims.ID == "" {
+		return "", fmt.Errorf("%w: jti is required", ErrInvalidProof)
+	}
+	if proofClaims.HTM != method {
+		return "", fmt.Errorf("%w: htm does not match the request method", ErrInvalidProof)
+	}
+	if !sameResource(proofClaims.HTU, requestURL) {
+		return "", fmt.Errorf("%w: htu does not match the request URL", ErrInvalidProof)
+	}
+	if accessToken != "" {
+		sum := sha256.Sum256([]byte(accessToken))
+		if proofClaims.ATH != base64.RawURLEncoding.EncodeToString(sum[:]) {
+			return "", fmt.Errorf("%w: ath does not match the access token", ErrInvalidProof)
+		}
+	}
+
+	thumbprint, err := key.Thumbprint()
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidProof, err)
+	}
+	if v.replay.seen(thumbprint+" "+proofClaims.ID, proofClaims.IssuedAt.Add(proofWindow+v.leeway)) {
+		return "", fmt.Errorf("%w: proof has already been used", ErrInvalidProof)
+	}
+	return thumbprint, nil
+}
+
+// sameResource compares a proof's htu with the request URL, ignoring the query
+// and fragment and the case of the scheme and host (RFC 9449 section 4.3)
+func sameResource(htu string, requestURL string) bool {
+	a, err := url.Parse(htu)
+	if err != nil {
+		return false
+	}
+	b, err := url.Parse(requestURL)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(a.Scheme, b.Scheme) && strings.EqualFold(a.Host, b.Host) && a.EscapedPath() == b.EscapedPath()
+}
+
+// BaseURL is the scheme and host the client used to reach the server.
+func BaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host
+}
+
+// RequestURL is the URL of the request as the client sees it, without the query.
+func RequestURL(r *http.Request) string {
+	return BaseURL(r) + r.URL.EscapedPath()
+}
+
+// replayCache remembers the DPoP proofs seen until they expire. It is kept in
+// memory, so each instance of a service rejects replays on its own.
+type replayCache struct {
+	mu      sync.Mutex
+	expires map[string]time.Time
+	swept   time.Time
+}
+
+// seen records id until expires and reports whether it had already been recorded
+func (r *replayCache) seen(id string, expires time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(r.swept) > time.Minute {
+		for key, at := range r.expires {
+			if now.After(at) {
+				delete(r.expires, key)
+			}
+		}
+		r.swept = now
+	}
+	if at, ok := r.expires[id]; ok && now.Before(at) {
+		return true
+	}
+	r.expires[id] = expires
+	return false
+}
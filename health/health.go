@@ -0,0 +1,157 @@
+// Package health tells an orchestrator whether the service is alive and
+// whether it should receive traffic.
+//
+// Liveness only says the process is serving requests. Readiness runs every
+// registered check, such as pinging the store, and fails when any of them
+// fails or when the service is shutting down, so it is taken out of rotation
+// before it stops.
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultTimeout is how long a check may take before it counts as failed.
+const DefaultTimeout = 2 * time.Second
+
+// Statuses of a report and its checks.
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// ErrShuttingDown fails readiness once shutdown has started.
+var ErrShuttingDown = errors.New("service is shutting down")
+
+// Check reports whether a dependency is usable. It should give up when ctx is done.
+type Check func(ctx context.Context) error
+
+// Result is the outcome of one check.
+type Result struct {
+	Name        string  `json:"name"`
+	Status      string  `json:"status"`
+	Duration_ms float64 `json:"duration_ms"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// Report is the outcome of all checks, it is OK only if every check is.
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+// OK reports whether the service is ready.
+func (r Report) OK() bool {
+	return r.Status == StatusOK
+}
+
+// Checker holds the readiness checks. It is safe for concurrent use, checks
+// can be registered while the service is running.
+type Checker struct {
+	// Timeout bounds each check, DefaultTimeout if it is zero
+	Timeout time.Duration
+
+	mu           sync.RWMutex
+	names        []string
+	checks       map[string]Check
+	shuttingDown atomic.Bool
+}
+
+// NewChecker returns a Checker without checks.
+func NewChecker() *Checker {
+	return &Checker{Timeout: DefaultTimeout, checks: map[string]Check{}}
+}
+
+// Register adds a readiness check, or replaces the check of the same name.
+func (c *Checker) Register(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.checks[name]; !ok {
+		c.names = append(c.names, name)
+	}
+	c.checks[name] = check
+}
+
+// SetShuttingDown makes readiness fail from now on.
+func (c *Checker) SetShuttingDown() {
+	c.shuttingDown.Store(true)
+}
+
+// ShuttingDown reports whether SetShuttingDown was called.
+func (c *Checker) ShuttingDown() bool {
+	return c.shuttingDown.Load()
+}
+
+// Ready runs the checks concurrently and reports their results in the order
+// they were registered. Once shutting down, no checks are run.
+func (c *Checker) Ready(ctx context.Context) Report {
+	if c.ShuttingDown() {
+		return Report{
+			Status: StatusFail,
+			Checks: []Result{{Name: "shutdown", Status: StatusFail, Error: ErrShuttingDown.Error()}},
+		}
+	}
+
+	c.mu.RLock()
+	names := append([]string(nil), c.names...)
+	checks := make([]Check, len(names))
+	for i, name := range names {
+		checks[i] = c.checks[name]
+	}
+	c.mu.RUnlock()
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	report := Report{Status: StatusOK, Checks: make([]Result, len(names))}
+	var wg sync.WaitGroup
+	for i := range names {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			report.Checks[i] = run(ctx, names[i], checks[i], timeout)
+		}(i)
+	}
+	wg.Wait()
+	for _, result := range report.Checks {
+		if result.Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+	return report
+}
+
+// run runs one check within timeout
+func run(ctx context.Context, name string, check Check, timeout time.Duration) Result {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- check(ctx)
+	}()
+	var err error
+	// A check that ignores ctx must not hold up the report
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := Result{
+		Name:        name,
+		Status:      StatusOK,
+		Duration_ms: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+	return result
+}
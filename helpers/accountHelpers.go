@@ -0,0 +1,307 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/arunprasad2002/go-jwt/models"
+	"github.com/arunprasad2002/go-jwt/store"
+	"github.com/arunprasad2002/go-jwt/webhook"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrAccountDeactivated     = errors.New("account is deactivated")
+	ErrAccountPendingDeletion = errors.New("account is scheduled for deletion")
+	ErrSessionRevoked         = errors.New("session has been revoked")
+)
+
+// Accounts manages account status and sessions
+type Accounts struct {
+	Store *store.Store
+	// DeletionGracePeriod is how long a deleted account can still be restored before it is purged
+	DeletionGracePeriod time.Duration
+}
+
+func NewAccounts(st *store.Store, deletionGracePeriod time.Duration) *Accounts {
+	return &Accounts{Store: st, DeletionGracePeriod: deletionGracePeriod}
+}
+
+// CheckAccountActive rejects tokens of deactivated or deleted users and tokens
+// issued before the user's sessions were last revoked
+func (a *Accounts) CheckAccountActive(ctx context.Context, uid string, issuedAt int64) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	user, err := a.Store.Users.GetByID(ctx, uid)
+	if err != nil {
+		return err
+	}
+	if err := checkStatus(user); err != nil {
+		return err
+	}
+
+	if user.Tokens_valid_after != nil && issuedAt < user.Tokens_valid_after.Unix() {
+		return ErrSessionRevoked
+	}
+	return nil
+}
+
+// checkStatus rejects users whose account is deactivated or scheduled for deletion
+func checkStatus(user *models.User) error {
+	switch models.UserStatus(*user) {
+	case models.StatusDeactivated:
+		return ErrAccountDeactivated
+	case models.StatusPendingDeletion:
+		return ErrAccountPendingDeletion
+	}
+	return nil
+}
+
+// NewSession starts a session of the user for tokens issued for audience with
+// scopes. Its tokens are issued with its Session_id and Refresh_id, then it is created.
+func NewSession(userId string, ip string, userAgent string, audience string, scopes []string) *models.Session {
+	now := time.Now()
+	return &models.Session{
+		Session_id: primitive.NewObjectID().Hex(),
+		User_id:    userId,
+		Ip:         ip,
+		User_agent: userAgent,
+		Audience:   audience,
+		Scopes:     scopes,
+		Refresh_id: NewTokenID(),
+		Created_at: now,
+		Expires_at: now.Add(RefreshTokenLifetime),
+	}
+}
+
+// CreateSession records a session whose token pair was issued
+func (a *Accounts) CreateSession(ctx context.Context, session *models.Session) error {
+	return a.Store.Sessions.Create(ctx, session)
+}
+
+// RevokeSessions invalidates every token and API key issued to the user so far
+func (a *Accounts) RevokeSessions(ctx context.Context, userId string) error {
+	return revokeSessions(ctx, a.Store, userId)
+}
+
+func revokeSessions(ctx context.Context, st *store.Store, userId string) error {
+	now := time.Now()
+	if err := st.Sessions.RevokeByUser(ctx, userId, now); err != nil {
+		return err
+	}
+
+	user, err := st.Users.GetByID(ctx, userId)
+	if err != nil {
+		return err
+	}
+	user.Token = nil
+	user.Refresh_token = nil
+	user.Tokens_valid_after = &now
+	user.Updated_at = now
+	return st.Users.Update(ctx, user)
+}
+
+// statusEvents are the webhook events sent when an account gets a status
+var statusEvents = map[string]string{
+	models.StatusActive:          webhook.EventUserReactivated,
+	models.StatusDeactivated:     webhook.EventUserDeactivated,
+	models.StatusPendingDeletion: webhook.EventUserDeletionScheduled,
+}
+
+// SetAccountStatus changes the user's status and revokes their sessions unless the account becomes active
+func (a *Accounts) SetAccountStatus(ctx context.Context, userId string, status string) (*models.User, error) {
+	var user *models.User
+	err := a.Store.Transaction(ctx, func(ctx context.Context, tx *store.Store) error {
+		var err error
+		user, err = tx.Users.GetByID(ctx, userId)
+		if err != nil {
+			return err
+		}
+		previous := models.UserStatus(*user)
+
+		now := time.Now()
+		user.Status = &status
+		user.Updated_at = now
+		switch status {
+		case models.StatusActive:
+			user.Deactivated_at = nil
+			user.Delete_after = nil
+		case models.StatusDeactivated:
+			user.Deactivated_at = &now
+		case models.StatusPendingDeletion:
+			deleteAfter := now.Add(a.DeletionGracePeriod)
+			user.Delete_after = &deleteAfter
+		}
+		if err := tx.Users.Update(ctx, user); err != nil {
+			return err
+		}
+
+		if status != models.StatusActive {
+			if err := revokeSessions(ctx, tx, userId); err != nil {
+				return err
+			}
+		}
+		user, err = tx.Users.GetByID(ctx, userId)
+		if err != nil || previous == status {
+			return err
+		}
+		return webhook.Publish(ctx, tx.WebhookEvents, statusEvents[status], webhook.UserData(*user))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// SetUserType changes the type of the user. Their sessions are revoked, so the
+// scopes of their tokens are those of the new type once they log in again.
+func (a *Accounts) SetUserType(ctx context.Context, userId string, userType string) (*models.User, error) {
+	var user *models.User
+	err := a.Store.Transaction(ctx, func(ctx context.Context, tx *store.Store) error {
+		var err error
+		user, err = tx.Users.GetByID(ctx, userId)
+		if err != nil || *user.User_type == userType {
+			return err
+		}
+		user.User_type = &userType
+		user.Updated_at = time.Now()
+		if err := tx.Users.Update(ctx, user); err != nil {
+			return err
+		}
+		if err := revokeSessions(ctx, tx, userId); err != nil {
+			return err
+		}
+		user, err = tx.Users.GetByID(ctx, userId)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// LinkIdentity records an external identity on the user if it is not linked yet
+func (a *Accounts) LinkIdentity(ctx context.Context, userId string, identity models.Identity) error {
+	return a.Store.Transaction(ctx, func(ctx context.Context, tx *store.Store) error {
+		user, err := tx.Users.GetByID(ctx, userId)
+		if err != nil {
+			return err
+		}
+		for _, linked := range user.Identities {
+			if linked.Provider == identity.Provider && linked.Subject == identity.Subject {
+				return nil
+			}
+		}
+		identity.Linked_at = time.Now()
+		user.Identities = append(user.Identities, identity)
+		if err := tx.Users.Update(ctx, user); err != nil {
+			return err
+		}
+		data := webhook.UserData(*user)
+		data.Method = identity.Provider
+		return webhook.Publish(ctx, tx.WebhookEvents, webhook.EventUserIdentityLinked, data)
+	})
+}
+
+// ChangeEmail gives the user a new email address and revokes their sessions,
+// tokens carry the email so the current ones are stale
+func (a *Accounts) ChangeEmail(ctx context.Context, userId string, email string) (*models.User, error) {
+	var user *models.User
+	err := a.Store.Transaction(ctx, func(ctx context.Context, tx *store.Store) error {
+		var err error
+		user, err = tx.Users.GetByID(ctx, userId)
+		if err != nil {
+			return err
+		}
+		previous := ""
+		if user.Email != nil {
+			previous = *user.Email
+		}
+		user.Email = &email
+		user.Updated_at = time.Now()
+		if err := tx.Users.Update(ctx, user); err != nil {
+			return err
+		}
+		if err := revokeSessions(ctx, tx, userId); err != nil {
+			return err
+		}
+
+		user, err = tx.Users.GetByID(ctx, userId)
+		if err != nil {
+			return err
+		}
+		data := webhook.UserData(*user)
+		data.Previous_email = previous
+		return webhook.Publish(ctx, tx.WebhookEvents, webhook.EventUserEmailChanged, data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// PurgeDeletedUsers hard deletes users whose deletion grace period has ended, along with their sessions and API keys.
+// Users who logged in again since they were listed are kept.
+func (a *Accounts) PurgeDeletedUsers(ctx context.Context) (int, error) {
+	now := time.Now()
+	users, err := a.Store.Users.ListPendingDeletion(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, user := range users {
+		if user.User_id == nil {
+			continue
+		}
+		err := a.Store.Transaction(ctx, func(ctx context.Context, tx *store.Store) error {
+			// Only deleted if still pending deletion, the user may have reactivated the account meanwhile
+			if err := tx.Users.DeletePendingDeletion(ctx, *user.User_id, now); err != nil {
+				return err
+			}
+			if err := tx.Sessions.DeleteByUser(ctx, *user.User_id); err != nil {
+				return err
+			}
+			if err := tx.APIKeys.DeleteByUser(ctx, *user.User_id); err != nil {
+				return err
+			}
+			return webhook.Publish(ctx, tx.WebhookEvents, webhook.EventUserDeleted, webhook.UserData(user))
+		})
+		if errors.Is(err, store.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// RunPurgeJob purges deleted users and expired device authorizations every interval until ctx is cancelled
+func (a *Accounts) RunPurgeJob(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purgeCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+			purged, err := a.PurgeDeletedUsers(purgeCtx)
+			cancel()
+			if err != nil {
+				slog.Error("failed to purge deleted users", "error", err)
+			} else if purged > 0 {
+				slog.Info("purged deleted users", "count", purged)
+			}
+			if err := a.Store.DeviceAuthorizations.DeleteExpired(ctx, time.Now()); err != nil {
+				slog.Error("failed to delete expired device authorizations", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package helpers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/arunprasad2002/go-jwt/models"
+	"github.com/arunprasad2002/go-jwt/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// APIKeyPrefix starts every API key so they are recognisable, e.g. by secret scanners
+	APIKeyPrefix = "gjk_"
+	// MaxAPIKeysPerUser caps the number of usable keys a user can have at once
+	MaxAPIKeysPerUser = 10
+
+	// lookupBytes is the number of random bytes in the part of a key stored in
+	// the clear, written as hex after APIKeyPrefix. Keys created before it was
+	// raised to 8 have 4.
+	lookupBytes = 8
+	// createAttempts bounds the retries when a new key's lookup is already taken
+	createAttempts = 3
+)
+
+var (
+	ErrInvalidAPIKey  = errors.New("API key is invalid")
+	ErrAPIKeyExpired  = errors.New("API key has expired")
+	ErrAPIKeyRevoked  = errors.New("API key has been revoked")
+	ErrTooManyAPIKeys = errors.New("too many API keys")
+)
+
+// IsAPIKey reports whether a presented credential is an API key rather than a JWT
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
+
+// APIKeyUsable reports whether a key is neither revoked nor expired
+func APIKeyUsable(key models.APIKey, now time.Time) bool {
+	return key.Revoked_at == nil && (key.Expires_at == nil || now.Before(*key.Expires_at))
+}
+
+// CreateAPIKey creates an API key for the user and returns it along with its
+// stored record. The key itself is not stored and cannot be shown again.
+func (a *Accounts) CreateAPIKey(ctx context.Context, userId string, name string, scopes []string, expiresAt *time.Time) (string, *models.APIKey, error) {
+	now := time.Now()
+	existing, err := a.Store.APIKeys.ListByUser(ctx, userId)
+	if err != nil {
+		return "", nil, err
+	}
+	usable := 0
+	for _, key := range existing {
+		if APIKeyUsable(key, now) {
+			usable++
+		}
+	}
+	if usable >= MaxAPIKeysPerUser {
+		return "", nil, ErrTooManyAPIKeys
+	}
+
+	secret, err := randomToken()
+	if err != nil {
+		return "", nil, err
+	}
+	for attempt := 1; ; attempt++ {
+		lookup := make([]byte, lookupBytes)
+		if _, err := rand.Read(lookup); err != nil {
+			return "", nil, err
+		}
+		prefix := APIKeyPrefix + hex.EncodeToString(lookup)
+		plain := prefix + "_" + secret
+
+		key := &models.APIKey{
+			Key_id:     primitive.NewObjectID().Hex(),
+			User_id:    userId,
+			Name:       name,
+			Prefix:     prefix,
+			Key_hash:   hashSecret(plain),
+			Scopes:     scopes,
+			Created_at: now,
+			Expires_at: expiresAt,
+		}
+		err := a.Store.APIKeys.Create(ctx, key)
+		if errors.Is(err, store.ErrConflict) && attempt < createAttempts {
+			continue
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		return plain, key, nil
+	}
+}
+
+// AuthenticateAPIKey returns the user and key for a presented API key and records its use
+func (a *Accounts) AuthenticateAPIKey(ctx context.Context, plain string, ip string) (*models.User, *models.APIKey, error) {
+	// The stored part ends at the underscore after the hex digits
+	lookup, _, found := strings.Cut(strings.TrimPrefix(plain, APIKeyPrefix), "_")
+	if !IsAPIKey(plain) || !found || lookup == "" {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	key, err := a.Store.APIKeys.GetByPrefix(ctx, APIKeyPrefix+lookup)
+	if err != nil {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	if subtle.ConstantTimeCompare([]byte(key.Key_hash), []byte(hashSecret(plain))) != 1 {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	now := time.Now()
+	if key.Revoked_at != nil {
+		return nil, nil, ErrAPIKeyRevoked
+	}
+	if !APIKeyUsable(*key, now) {
+		return nil, nil, ErrAPIKeyExpired
+	}
+
+	user, err := a.Store.Users.GetByID(ctx, key.User_id)
+	if err != nil {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	if err := checkStatus(user); err != nil {
+		return nil, nil, err
+	}
+	// Revoking the user's sessions revokes the keys they had as well
+	if user.Tokens_valid_after != nil && key.Created_at.Before(*user.Tokens_valid_after) {
+		return nil, nil, ErrAPIKeyRevoked
+	}
+
+	if err := a.Store.APIKeys.RecordUse(ctx, key.Key_id, now, ip); err != nil {
+		slog.Warn("failed to record API key use", "key_id", key.Key_id, "error", err)
+	}
+	return user, key, nil
+}
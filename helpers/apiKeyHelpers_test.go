@@ -0,0 +1,72 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/arunprasad2002/go-jwt/models"
+	"github.com/arunprasad2002/go-jwt/store"
+)
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	ctx := context.Background()
+	accounts := NewAccounts(store.NewMemoryStore(), time.Hour)
+	userId := "u1"
+	if err := accounts.Store.Users.Create(ctx, &models.User{User_id: &userId}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Keys created before prefixes were lengthened have 8 hex digits
+	legacy := APIKeyPrefix + "0123abcd_secret"
+	err := accounts.Store.APIKeys.Create(ctx, &models.APIKey{
+		Key_id:     "legacy",
+		User_id:    userId,
+		Prefix:     APIKeyPrefix + "0123abcd",
+		Key_hash:   hashSecret(legacy),
+		Created_at: time.Now().Add(-time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, _, err := accounts.CreateAPIKey(ctx, userId, "ci", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		key     string
+		revoke  bool
+		wantErr error
+	}{
+		{name: "legacy key", key: legacy},
+		{name: "current key", key: current},
+		{name: "wrong secret", key: current + "x", wantErr: ErrInvalidAPIKey},
+		{name: "no lookup", key: APIKeyPrefix + "_secret", wantErr: ErrInvalidAPIKey},
+		{name: "key from before sessions were revoked", key: current, revoke: true, wantErr: ErrAPIKeyRevoked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.revoke {
+				if err := accounts.RevokeSessions(ctx, userId); err != nil {
+					t.Fatal(err)
+				}
+			}
+			_, _, err := accounts.AuthenticateAPIKey(ctx, tt.key, "203.0.113.1")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("AuthenticateAPIKey() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// Keys created after the revocation work
+	key, _, err := accounts.CreateAPIKey(ctx, userId, "ci", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := accounts.AuthenticateAPIKey(ctx, key, "203.0.113.1"); err != nil {
+		t.Fatalf("AuthenticateAPIKey() of a new key = %v", err)
+	}
+}
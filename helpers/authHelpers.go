@@ -3,16 +3,20 @@ package helpers
 import (
 	"errors"
 
+	"github.com/arunprasad2002/go-jwt/models"
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// ErrForbidden is returned when the caller may not access a resource
+var ErrForbidden = errors.New("not allowed to access this resource")
+
 func ChekcUserType(ctx *gin.Context, role string) (err error) {
 	userType := ctx.GetString("user_type")
 	err = nil
 
 	if userType != role {
-		err = errors.New("Unauthorize to access this resource")
+		err = ErrForbidden
 		return err
 	}
 
@@ -23,13 +27,33 @@ func MatchUserToUid(ctx *gin.Context, userId string) (err error) {
 	userType := ctx.GetString("user_type")
 	uid := ctx.GetString("uid")
 	if userType == "USER" && uid != userId {
-		err = errors.New("Unauthorize to access this resource")
+		err = ErrForbidden
 		return err
 	}
 	err = ChekcUserType(ctx, userType)
 	return err
 }
 
+// CheckAdmin allows admins and service accounts. What a service account may
+// do is limited by the scopes of its token instead.
+func CheckAdmin(ctx *gin.Context) error {
+	if ctx.GetString("client_id") != "" {
+		return nil
+	}
+	return ChekcUserType(ctx, "ADMIN")
+}
+
+// VisibilityFor returns how much of the user identified by userId the caller may see
+func VisibilityFor(ctx *gin.Context, userId string) models.Visibility {
+	if ctx.GetString("user_type") == "ADMIN" || ctx.GetString("client_id") != "" {
+		return models.VisibilityAdmin
+	}
+	if ctx.GetString("uid") == userId {
+		return models.VisibilitySelf
+	}
+	return models.VisibilityPublic
+}
+
 // VerifyPassword checks if the provided password matches the hashed password
 func VerifyPassword(providedPassword, storedHashedPassword string) (bool, string) {
 	// Compare the hashed password with the provided password
@@ -0,0 +1,177 @@
+package helpers
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/arunprasad2002/go-jwt/models"
+	"github.com/arunprasad2002/go-jwt/store"
+)
+
+const (
+	// DeviceCodeLifetime is how long a device has to get its user code approved
+	DeviceCodeLifetime = 10 * time.Minute
+	// DevicePollInterval is the minimum number of seconds between polls of the token endpoint
+	DevicePollInterval = 5
+)
+
+// userCodeAlphabet has no vowels, so user codes cannot spell words, and no
+// characters that are easily confused with each other (RFC 8628 section 6.1)
+const userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+// Polling errors, each maps to the RFC 8628 error code of the same name
+var (
+	ErrAuthorizationPending = errors.New("authorization_pending")
+	ErrSlowDown             = errors.New("slow_down")
+	ErrDeviceCodeExpired    = errors.New("expired_token")
+	ErrAccessDenied         = errors.New("access_denied")
+)
+
+var (
+	ErrInvalidDeviceCode = errors.New("device code is invalid")
+	ErrInvalidUserCode   = errors.New("code is invalid or has expired")
+)
+
+// StartDeviceAuthorization records a new device authorization for clientId and
+// returns the device code the device polls with. Only its hash is stored.
+func (a *Accounts) StartDeviceAuthorization(ctx context.Context, clientId string, scope string) (string, *models.DeviceAuthorization, error) {
+	deviceCode, err := randomToken()
+	if err != nil {
+		return "", nil, err
+	}
+	userCode, err := newUserCode()
+	if err != nil {
+		return "", nil, err
+	}
+	now := time.Now()
+	auth := models.DeviceAuthorization{
+		Device_code_hash: hashSecret(deviceCode),
+		User_code:        userCode,
+		Client_id:        clientId,
+		Scope:            scope,
+		Status:           models.DeviceStatusPending,
+		Interval:         DevicePollInterval,
+		Created_at:       now,
+		Expires_at:       now.Add(DeviceCodeLifetime),
+	}
+	if err := a.Store.DeviceAuthorizations.Create(ctx, &auth); err != nil {
+		return "", nil, err
+	}
+	return deviceCode, &auth, nil
+}
+
+// PollDeviceAuthorization answers clientId polling with deviceCode. It returns
+// the authorization once approved, removing it so it can be redeemed only once,
+// and one of the polling errors otherwise.
+func (a *Accounts) PollDeviceAuthorization(ctx context.Context, deviceCode string, clientId string) (*models.DeviceAuthorization, error) {
+	hash := hashSecret(deviceCode)
+	auth, err := a.Store.DeviceAuthorizations.GetByDeviceCode(ctx, hash)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && auth.Client_id != clientId) {
+		return nil, ErrInvalidDeviceCode
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if now.After(auth.Expires_at) {
+		a.Store.DeviceAuthorizations.Delete(ctx, hash)
+		return nil, ErrDeviceCodeExpired
+	}
+
+	switch auth.Status {
+	case models.DeviceStatusApproved:
+		if err := a.Store.DeviceAuthorizations.Delete(ctx, hash); err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				return nil, ErrInvalidDeviceCode
+			}
+			return nil, err
+		}
+		return auth, nil
+	case models.DeviceStatusDenied:
+		a.Store.DeviceAuthorizations.Delete(ctx, hash)
+		return nil, ErrAccessDenied
+	}
+
+	// Devices polling faster than their interval must back off by 5 seconds (RFC 8628 section 3.5)
+	pollErr := ErrAuthorizationPending
+	if auth.Last_polled_at != nil && now.Sub(*auth.Last_polled_at) < time.Duration(auth.Interval)*time.Second {
+		auth.Interval += 5
+		pollErr = ErrSlowDown
+	}
+	// Only the poll is recorded, so a decision made meanwhile is kept
+	err = a.Store.DeviceAuthorizations.RecordPoll(ctx, hash, now, auth.Interval)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrInvalidDeviceCode
+	}
+	if err != nil {
+		return nil, err
+	}
+	return nil, pollErr
+}
+
+// FindDeviceAuthorization returns the pending authorization with userCode
+func (a *Accounts) FindDeviceAuthorization(ctx context.Context, userCode string) (*models.DeviceAuthorization, error) {
+	auth, err := a.Store.DeviceAuthorizations.GetByUserCode(ctx, NormalizeUserCode(userCode))
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrInvalidUserCode
+	}
+	if err != nil {
+		return nil, err
+	}
+	if auth.Status != models.DeviceStatusPending || time.Now().After(auth.Expires_at) {
+		return nil, ErrInvalidUserCode
+	}
+	return auth, nil
+}
+
+// DecideDeviceAuthorization approves or denies the pending authorization with
+// userCode for the user. It fails with ErrInvalidUserCode if the authorization
+// was decided in the meantime.
+func (a *Accounts) DecideDeviceAuthorization(ctx context.Context, userCode string, userId string, approve bool) error {
+	auth, err := a.FindDeviceAuthorization(ctx, userCode)
+	if err != nil {
+		return err
+	}
+	status := models.DeviceStatusDenied
+	if approve {
+		status = models.DeviceStatusApproved
+	} else {
+		userId = ""
+	}
+	err = a.Store.DeviceAuthorizations.Decide(ctx, auth.Device_code_hash, status, userId)
+	if errors.Is(err, store.ErrNotFound) {
+		return ErrInvalidUserCode
+	}
+	return err
+}
+
+// NormalizeUserCode undoes the formatting users add or drop when typing a user code
+func NormalizeUserCode(userCode string) string {
+	userCode = strings.ToUpper(userCode)
+	userCode = strings.NewReplacer("-", "", " ", "").Replace(userCode)
+	if len(userCode) == 8 {
+		userCode = userCode[:4] + "-" + userCode[4:]
+	}
+	return userCode
+}
+
+// newUserCode returns a random user code formatted as XXXX-XXXX
+func newUserCode() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := make([]byte, 0, 9)
+	for i, v := range b {
+		if i == 4 {
+			code = append(code, '-')
+		}
+		// 256 is not a multiple of 20, the slight bias does not matter for a short-lived code
+		code = append(code, userCodeAlphabet[int(v)%len(userCodeAlphabet)])
+	}
+	return string(code), nil
+}
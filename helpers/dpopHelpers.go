@@ -0,0 +1,42 @@
+package helpers
+
+import (
+	"errors"
+
+	"github.com/arunprasad2002/go-jwt/dpop"
+	"github.com/gin-gonic/gin"
+)
+
+// DPoPHeader carries the DPoP proof of a request (RFC 9449)
+const DPoPHeader = "DPoP"
+
+// DPoPAlgorithms are the signing algorithms accepted for DPoP proofs
+var DPoPAlgorithms = dpop.Algorithms
+
+var (
+	ErrInvalidDPoPProof = dpop.ErrInvalidProof
+	ErrDPoPRequired     = errors.New("a DPoP proof is required")
+	ErrDPoPKeyMismatch  = errors.New("DPoP proof is not signed with the key the token is bound to")
+)
+
+// DPoPBound reports whether the token may only be used with a DPoP proof
+func (d *SignedDetails) DPoPBound() bool {
+	return d.Cnf != nil && d.Cnf.JKT != ""
+}
+
+// VerifyDPoPProof checks a DPoP proof made for a request with method to
+// requestURL and returns the thumbprint of the key it was signed with. When
+// the proof comes with an access token, accessToken must be that token.
+func (t *Tokens) VerifyDPoPProof(proof string, method string, requestURL string, accessToken string) (string, error) {
+	return t.dpop.Verify(proof, method, requestURL, accessToken)
+}
+
+// BaseURL is the scheme and host the client used to reach us
+func BaseURL(c *gin.Context) string {
+	return dpop.BaseURL(c.Request)
+}
+
+// RequestURL is the URL of the request as the client sees it, without the query
+func RequestURL(c *gin.Context) string {
+	return dpop.RequestURL(c.Request)
+}
@@ -0,0 +1,58 @@
+package helpers
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+
+	"github.com/arunprasad2002/go-jwt/models"
+	"github.com/gin-gonic/gin"
+)
+
+var ErrCertificateMismatch = errors.New("token is bound to a client certificate that was not presented")
+
+// CertificateBound reports whether the token may only be used over a TLS
+// connection authenticated with the client certificate it is bound to
+func (d *SignedDetails) CertificateBound() bool {
+	return d.Cnf != nil && d.Cnf.X5tS256 != ""
+}
+
+// ClientCertificate returns the client certificate of the request if the
+// server verified it against the client CA, nil otherwise
+func ClientCertificate(c *gin.Context) *x509.Certificate {
+	if c.Request.TLS == nil || len(c.Request.TLS.VerifiedChains) == 0 || len(c.Request.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return c.Request.TLS.VerifiedChains[0][0]
+}
+
+// CertificateThumbprint returns the base64url SHA-256 thumbprint of cert, the x5t#S256 of RFC 8705
+func CertificateThumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// CheckClientCertificate reports whether cert authenticates the service account
+// with tls_client_auth, that is whether it has the account's subject DN
+func CheckClientCertificate(account *models.ServiceAccount, cert *x509.Certificate) bool {
+	if account.Tls_client_auth_subject_dn == "" || cert == nil {
+		return false
+	}
+	return cert.Subject.String() == account.Tls_client_auth_subject_dn
+}
+
+// CheckBinding makes sure a token bound by bound is only renewed by a request
+// proving possession of the same keys, as found by presented
+func CheckBinding(bound *Confirmation, presented *Confirmation) error {
+	if bound == nil {
+		return nil
+	}
+	if bound.JKT != "" && (presented == nil || presented.JKT != bound.JKT) {
+		return ErrDPoPKeyMismatch
+	}
+	if bound.X5tS256 != "" && (presented == nil || presented.X5tS256 != bound.X5tS256) {
+		return ErrCertificateMismatch
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Scopes limit what an access token may be used for. Routes declare the
+// scopes they need with middleware.RequireScopes.
+const (
+	ScopeUsersRead    = "users:read"
+	ScopeAccountRead  = "account:read"
+	ScopeAccountWrite = "account:write"
+	ScopeUsersManage  = "users:manage"
+
+	ScopeServiceAccountsManage = "service_accounts:manage"
+	ScopeLoggingManage         = "logging:manage"
+	ScopeAuditRead             = "audit:read"
+	ScopeWebhooksManage        = "webhooks:manage"
+	// ScopeTokenExchange lets a service account exchange user tokens for delegated ones
+	ScopeTokenExchange = "token:exchange"
+)
+
+var ErrInvalidScope = errors.New("invalid scope")
+
+// userScopes are the scopes each user type may be granted
+var userScopes = map[string][]string{
+	"USER":  {ScopeUsersRead, ScopeAccountRead, ScopeAccountWrite},
+	"ADMIN": {ScopeUsersRead, ScopeAccountRead, ScopeAccountWrite, ScopeUsersManage, ScopeServiceAccountsManage, ScopeLoggingManage, ScopeAuditRead, ScopeWebhooksManage},
+}
+
+// GrantScopes returns the scopes to issue for a space separated request.
+// An empty request is granted everything allowed, a request for anything
+// outside allowed fails with ErrInvalidScope.
+func GrantScopes(allowed []string, requested string) ([]string, error) {
+	if strings.TrimSpace(requested) == "" {
+		return allowed, nil
+	}
+	granted := []string{}
+	for _, scope := range strings.Fields(requested) {
+		if !HasScopes(allowed, scope) {
+			return nil, fmt.Errorf("%w %q", ErrInvalidScope, scope)
+		}
+		if !HasScopes(granted, scope) {
+			granted = append(granted, scope)
+		}
+	}
+	return granted, nil
+}
+
+// UserScopes returns every scope a user of userType may be granted
+func UserScopes(userType string) []string {
+	return userScopes[userType]
+}
+
+// IsUserScope reports whether scope may be granted to users of some type
+func IsUserScope(scope string) bool {
+	for _, scopes := range userScopes {
+		if HasScopes(scopes, scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScopes reports whether granted contains every one of required
+func HasScopes(granted []string, required ...string) bool {
+	for _, scope := range required {
+		found := false
+		for _, g := range granted {
+			if g == scope {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
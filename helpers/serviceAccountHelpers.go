@@ -0,0 +1,71 @@
+package helpers
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/arunprasad2002/go-jwt/models"
+)
+
+// ServiceTokenLifetime is how long access tokens issued to service accounts last
+const ServiceTokenLifetime = 15 * time.Minute
+
+var ErrServiceAccountDisabled = errors.New("service account is disabled")
+
+// serviceAccountScopes are the scopes a service account may be given. Account
+// scopes only make sense for users, and service accounts never manage other
+// service accounts.
+var serviceAccountScopes = []string{ScopeUsersRead, ScopeUsersManage, ScopeTokenExchange}
+
+// ServiceAccountScopes returns every scope a service account may be granted
+func ServiceAccountScopes() []string {
+	return serviceAccountScopes
+}
+
+// NewClientSecret returns a new client secret and the hash to store for it
+func NewClientSecret() (secret string, hash string, err error) {
+	secret, err = randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	return secret, HashClientSecret(secret), nil
+}
+
+// HashClientSecret hashes a client secret for storage
+func HashClientSecret(secret string) string {
+	return hashSecret(secret)
+}
+
+// hashSecret hashes a generated credential. They are random, so unlike
+// passwords they need no salt or slow hash.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// CheckClientSecret reports whether secret is the service account's current secret
+func CheckClientSecret(account *models.ServiceAccount, secret string) bool {
+	if account.Secret_hash == "" || secret == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(account.Secret_hash), []byte(HashClientSecret(secret))) == 1
+}
+
+// CheckServiceAccountActive rejects tokens of service accounts that have been disabled
+func (a *Accounts) CheckServiceAccountActive(ctx context.Context, clientId string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	account, err := a.Store.ServiceAccounts.GetByClientID(ctx, clientId)
+	if err != nil {
+		return err
+	}
+	if account.Disabled_at != nil {
+		return ErrServiceAccountDisabled
+	}
+	return nil
+}
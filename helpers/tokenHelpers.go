@@ -2,108 +2,410 @@ package helpers
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"strings"
 	"time"
 
-	"github.com/arunprasad2002/go-jwt/database"
-	"github.com/dgrijalva/jwt-go"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"github.com/arunprasad2002/go-jwt/dpop"
+	"github.com/arunprasad2002/go-jwt/jwk"
+	"github.com/arunprasad2002/go-jwt/keyring"
+	"github.com/arunprasad2002/go-jwt/models"
+	"github.com/arunprasad2002/go-jwt/store"
+	"github.com/arunprasad2002/go-jwt/tracing"
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-type SingnedDetails struct {
-	Email      string
-	First_name string
-	Last_name  string
-	Uid        string
-	User_type  string
-	jwt.StandardClaims
-}
+var (
+	ErrTokenMalformed        = errors.New("token is malformed")
+	ErrTokenSignatureInvalid = errors.New("token signature is invalid")
+	ErrTokenExpired          = errors.New("token is expired")
+	ErrTokenNotValidYet      = errors.New("token is not valid yet")
+	ErrTokenInvalidIssuer    = errors.New("token has an invalid issuer")
+	ErrTokenInvalidAudience  = errors.New("token has an invalid audience")
+	ErrUnknownAudience       = errors.New("unknown audience")
+)
 
-var userCollection *mongo.Collection = database.OpenCollection(database.Client, "user")
+// allowedAlgorithms are the only signing algorithms accepted. HS256 is used
+// with the secret key, RS256 and ES256 with the key ring; none is never accepted.
+var allowedAlgorithms = []string{"HS256", "RS256", "ES256"}
+
+// Values of the token_use claim, which keeps refresh tokens from being used as access tokens
+const (
+	TokenUseAccess  = "access"
+	TokenUseRefresh = "refresh"
+)
 
 type SignedDetails struct {
-	Email      string `json:"email"`
-	First_name string `json:"first_name"`
-	Last_name  string `json:"last_name"`
-	Uid        string `json:"uid"`
-	User_type  string `json:"user_type"`
-	jwt.StandardClaims
+	// Token_use is TokenUseAccess or TokenUseRefresh
+	Token_use  string `json:"token_use"`
+	Email      string `json:"email,omitempty"`
+	First_name string `json:"first_name,omitempty"`
+	Last_name  string `json:"last_name,omitempty"`
+	Uid        string `json:"uid,omitempty"`
+	User_type  string `json:"user_type,omitempty"`
+	// Client_id identifies the service account of a client credentials token
+	Client_id string `json:"client_id,omitempty"`
+	// Scope is the space separated list of scopes granted to the token
+	Scope string `json:"scope,omitempty"`
+	// Act identifies the service acting on behalf of the user in an exchanged token
+	Act *Actor `json:"act,omitempty"`
+	// Cnf binds the token to a key of the client, see DPoPBound and CertificateBound
+	Cnf *Confirmation `json:"cnf,omitempty"`
+	// Sid identifies the session a refresh token belongs to
+	Sid string `json:"sid,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Actor is an RFC 8693 act claim. Act holds the previous actor when a
+// delegated token is exchanged again.
+type Actor struct {
+	Subject string `json:"sub"`
+	Act     *Actor `json:"act,omitempty"`
+}
+
+// Confirmation is a cnf claim (RFC 7800), binding a token to a key its holder must prove possession of
+type Confirmation struct {
+	// JKT is the JWK thumbprint of the client's DPoP key
+	JKT string `json:"jkt,omitempty"`
+	// X5tS256 is the thumbprint of the client's TLS certificate (RFC 8705)
+	X5tS256 string `json:"x5t#S256,omitempty"`
+}
+
+// Scopes returns the scopes granted to the token
+func (d *SignedDetails) Scopes() []string {
+	return strings.Fields(d.Scope)
+}
+
+// IsAccessToken reports whether the claims are those of an access token
+func (d *SignedDetails) IsAccessToken() bool {
+	return d.Token_use == TokenUseAccess
+}
+
+// IsRefreshToken reports whether the claims are those of a refresh token, which carry no user details
+func (d *SignedDetails) IsRefreshToken() bool {
+	return d.Token_use == TokenUseRefresh && d.Subject != ""
+}
+
+// Tokens signs and validates the service's JWTs. Tokens are signed with the
+// key ring's signing key when it has one and with the HMAC secret otherwise;
+// both kinds are accepted when validating.
+type Tokens struct {
+	secretKey []byte
+	ring      *keyring.Ring
+	issuer    string
+	// audiences are the clients tokens may be issued for, the first one is the default
+	audiences []string
+	leeway    time.Duration
+	parser    *jwt.Parser
+	// dpop checks DPoP proofs and holds the ones already used
+	dpop *dpop.Verifier
+}
+
+// NewTokens creates the token issuer. leeway tolerates clock skew between the service and its clients.
+func NewTokens(secretKey string, ring *keyring.Ring, issuer string, audiences []string, leeway time.Duration) *Tokens {
+	return &Tokens{
+		secretKey: []byte(secretKey),
+		ring:      ring,
+		issuer:    issuer,
+		audiences: audiences,
+		leeway:    leeway,
+		parser: jwt.NewParser(
+			jwt.WithValidMethods(allowedAlgorithms),
+			jwt.WithIssuer(issuer),
+			jwt.WithLeeway(leeway),
+			jwt.WithExpirationRequired(),
+			jwt.WithIssuedAt(),
+		),
+		dpop: dpop.NewVerifier(leeway),
+	}
 }
 
-var SECRET_KEY = "your-secret-key" // Replace with a strong secret key
+// KeyRing returns the keys published in the JWK Set
+func (t *Tokens) KeyRing() *keyring.Ring {
+	return t.ring
+}
+
+func (t *Tokens) sign(ctx context.Context, claims jwt.Claims) (signed string, err error) {
+	_, span := tracing.Start(ctx, "token.sign")
+	defer func() { tracing.End(span, err) }()
+
+	if key, ok := t.ring.Signing(); ok {
+		span.SetAttributes(attribute.String("jwt.alg", key.Algorithm))
+		token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+		token.Header["kid"] = key.ID
+		return token.SignedString(key.Private)
+	}
+	span.SetAttributes(attribute.String("jwt.alg", jwt.SigningMethodHS256.Alg()))
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(t.secretKey)
+}
+
+// key picks the verification key for a token, refusing any algorithm other
+// than the key's own so a public key can never be used as an HMAC secret
+func (t *Tokens) key(token *jwt.Token) (interface{}, error) {
+	if rawKid, ok := token.Header["kid"]; ok {
+		kid, _ := rawKid.(string)
+		key, found := t.ring.Lookup(kid)
+		if !found {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		if token.Method.Alg() != key.Algorithm {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+		return key.Public, nil
+	}
+	if token.Method.Alg() != jwt.SigningMethodHS256.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return t.secretKey, nil
+}
+
+// Audience resolves the audience requested by a client, the default one if empty
+func (t *Tokens) Audience(requested string) (string, error) {
+	if requested == "" && len(t.audiences) > 0 {
+		return t.audiences[0], nil
+	}
+	for _, audience := range t.audiences {
+		if audience == requested {
+			return audience, nil
+		}
+	}
+	return "", fmt.Errorf("%w %q", ErrUnknownAudience, requested)
+}
+
+// registeredClaims returns the standard claims of a new token for the user
+func (t *Tokens) registeredClaims(uid string, audience string, lifetime time.Duration) jwt.RegisteredClaims {
+	now := time.Now()
+	return jwt.RegisteredClaims{
+		ID:        NewTokenID(),
+		Issuer:    t.issuer,
+		Subject:   uid,
+		Audience:  jwt.ClaimStrings{audience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(lifetime)),
+	}
+}
+
+// AccessTokenLifetime is how long access tokens issued to users last
+const AccessTokenLifetime = 24 * time.Hour
+
+// RefreshTokenLifetime is how long refresh tokens last, each refresh starts it again
+const RefreshTokenLifetime = 168 * time.Hour
+
+// NewTokenID returns a new unique token identifier (jti)
+func NewTokenID() string {
+	return primitive.NewObjectID().Hex()
+}
+
+// GenerateAllTokens issues an access and a refresh token for audience, the
+// default audience if empty. Both are limited to scopes and bound by cnf if set.
+// The refresh token belongs to the session sessionId and has refreshId as its jti.
+func (t *Tokens) GenerateAllTokens(ctx context.Context, email string, firstName string, lastName string, userType string, uid string, audience string, scopes []string, cnf *Confirmation, sessionId string, refreshId string) (signedToken string, signedRefreshToken string, err error) {
+	audience, err = t.Audience(audience)
+	if err != nil {
+		return "", "", err
+	}
 
-func GenerateAllTokens(email string, firstName string, lastName string, userType string, uid string) (signedToken string, signedRefreshToken string, err error) {
 	claims := &SignedDetails{
-		Email:      email,
-		First_name: firstName,
-		Last_name:  lastName,
-		Uid:        uid,
-		User_type:  userType,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(24 * time.Hour).Unix(), // Token expires in 24 hours
-		},
+		Token_use:        TokenUseAccess,
+		Email:            email,
+		First_name:       firstName,
+		Last_name:        lastName,
+		Uid:              uid,
+		User_type:        userType,
+		Scope:            strings.Join(scopes, " "),
+		Cnf:              cnf,
+		RegisteredClaims: t.registeredClaims(uid, audience, AccessTokenLifetime), // Token expires in 24 hours
 	}
 
+	// The scopes stay with the session, a refresh token grants nothing by itself
 	refreshClaims := &SignedDetails{
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(168 * time.Hour).Unix(), // Refresh token expires in 7 days
-		},
+		Token_use:        TokenUseRefresh,
+		Cnf:              cnf,
+		Sid:              sessionId,
+		RegisteredClaims: t.registeredClaims(uid, audience, RefreshTokenLifetime),
 	}
+	refreshClaims.ID = refreshId
 
 	// Create access token
-	token, tokenErr := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(SECRET_KEY))
+	token, tokenErr := t.sign(ctx, claims)
 	if tokenErr != nil {
-		log.Panic(tokenErr)
 		return "", "", tokenErr
 	}
 
 	// Create refresh token
-	refreshToken, refreshErr := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims).SignedString([]byte(SECRET_KEY))
+	refreshToken, refreshErr := t.sign(ctx, refreshClaims)
 	if refreshErr != nil {
-		log.Panic(refreshErr)
 		return "", "", refreshErr
 	}
 
 	return token, refreshToken, nil
 }
 
-func ValidateToken(singedToken string) (claims *SingnedDetails, msg string) {
+// GenerateServiceToken issues a short-lived access token to a service account, bound by cnf if set.
+// No refresh token is issued.
+func (t *Tokens) GenerateServiceToken(ctx context.Context, clientId string, scopes []string, cnf *Confirmation) (string, error) {
+	audience, err := t.Audience("")
+	if err != nil {
+		return "", err
+	}
+	claims := &SignedDetails{
+		Token_use:        TokenUseAccess,
+		Client_id:        clientId,
+		Scope:            strings.Join(scopes, " "),
+		Cnf:              cnf,
+		RegisteredClaims: t.registeredClaims(clientId, audience, ServiceTokenLifetime),
+	}
+	return t.sign(ctx, claims)
+}
 
-	token, err := jwt.ParseWithClaims(
-		singedToken,
-		&SingnedDetails{},
-		func(t *jwt.Token) (interface{}, error) {
-			return []byte(""), nil
-		},
-	)
+// ClientAssertionSubject returns the client a client assertion claims to be
+// from, without verifying it. Verify it with VerifyClientAssertion.
+func ClientAssertionSubject(assertion string) (string, error) {
+	claims := &jwt.RegisteredClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(assertion, claims); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrTokenMalformed, err)
+	}
+	return claims.Subject, nil
+}
+
+// ExchangedTokenLifetime caps how long tokens issued by token exchange last
+const ExchangedTokenLifetime = 5 * time.Minute
 
+// ExchangeToken issues a delegated access token for the user of subject to
+// the actor service (RFC 8693). The token is restricted to audience and
+// scopes, carries the actor in its act claim, and never outlives subject. It is bound
+// by cnf, the actor's key, if set.
+func (t *Tokens) ExchangeToken(ctx context.Context, subject *SignedDetails, actor string, audience string, scopes []string, cnf *Confirmation) (string, time.Duration, error) {
+	audience, err := t.Audience(audience)
 	if err != nil {
-		msg = err.Error()
-		return
+		return "", 0, err
 	}
+	lifetime := ExchangedTokenLifetime
+	if remaining := time.Until(subject.ExpiresAt.Time); remaining < lifetime {
+		lifetime = remaining
+	}
+	lifetime = lifetime.Truncate(time.Second)
 
-	claims, ok := token.Claims.(*SingnedDetails)
+	claims := &SignedDetails{
+		Token_use:        TokenUseAccess,
+		Email:            subject.Email,
+		First_name:       subject.First_name,
+		Last_name:        subject.Last_name,
+		Uid:              subject.Uid,
+		User_type:        subject.User_type,
+		Scope:            strings.Join(scopes, " "),
+		Act:              &Actor{Subject: actor, Act: subject.Act},
+		Cnf:              cnf,
+		RegisteredClaims: t.registeredClaims(subject.Uid, audience, lifetime),
+	}
+	token, err := t.sign(ctx, claims)
+	return token, lifetime, err
+}
 
-	if !ok {
-		msg = fmt.Sprintf("the token is invalid")
-		msg = err.Error()
-		return
+// maxAssertionLifetime bounds how far in the future a client assertion may expire
+const maxAssertionLifetime = 5 * time.Minute
+
+// VerifyClientAssertion checks a private_key_jwt client assertion (RFC 7523):
+// it must be signed by one of the service account's public keys, name the
+// account as issuer and subject, be meant for us, and be short-lived.
+func (t *Tokens) VerifyClientAssertion(assertion string, account *models.ServiceAccount, tokenURL string) error {
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{"RS256", "ES256"}),
+		jwt.WithIssuer(account.Client_id),
+		jwt.WithSubject(account.Client_id),
+		jwt.WithLeeway(t.leeway),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	keys := jwk.Set{Keys: account.Public_keys}
+	claims := &jwt.RegisteredClaims{}
+	_, err := parser.ParseWithClaims(assertion, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, found := keys.Find(kid)
+		if kid == "" && len(keys.Keys) == 1 {
+			key, found = keys.Keys[0], true
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown client key %q", kid)
+		}
+		if key.Alg != "" && key.Alg != token.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+		return key.PublicKey()
+	})
+	if err != nil {
+		return tokenError(err)
+	}
+
+	audienceOK := false
+	for _, audience := range claims.Audience {
+		if audience == tokenURL || audience == t.issuer {
+			audienceOK = true
+		}
+	}
+	if !audienceOK {
+		return ErrTokenInvalidAudience
+	}
+	if claims.ExpiresAt.After(time.Now().Add(maxAssertionLifetime + t.leeway)) {
+		return fmt.Errorf("%w: client assertion lives too long", ErrTokenMalformed)
+	}
+	return nil
+}
+
+// ValidateToken checks the signature and registered claims of a token. Errors
+// wrap one of the ErrToken values so callers can tell why a token was refused.
+func (t *Tokens) ValidateToken(ctx context.Context, signedToken string) (_ *SignedDetails, err error) {
+	_, span := tracing.Start(ctx, "token.validate")
+	defer func() { tracing.End(span, err) }()
+
+	claims := &SignedDetails{}
+	if _, err := t.parser.ParseWithClaims(signedToken, claims, t.key); err != nil {
+		return nil, tokenError(err)
+	}
+	if claims.IssuedAt == nil {
+		return nil, fmt.Errorf("%w: no issued-at time", ErrTokenMalformed)
+	}
+	if !t.allowsAudience(claims.Audience) {
+		return nil, ErrTokenInvalidAudience
 	}
+	return claims, nil
+}
 
-	if claims.ExpiresAt < time.Now().Local().Unix() {
-		msg = fmt.Sprintf("token is expired")
-		msg = err.Error()
-		return
+// allowsAudience reports whether the token is meant for one of the configured audiences
+func (t *Tokens) allowsAudience(audiences jwt.ClaimStrings) bool {
+	for _, audience := range audiences {
+		if _, err := t.Audience(audience); audience != "" && err == nil {
+			return true
+		}
 	}
+	return false
+}
 
-	return claims, msg
+// tokenError translates a parser error into one of the ErrToken values
+func tokenError(err error) error {
+	switch {
+	case errors.Is(err, jwt.ErrTokenMalformed), errors.Is(err, jwt.ErrTokenRequiredClaimMissing):
+		return fmt.Errorf("%w: %v", ErrTokenMalformed, err)
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return ErrTokenExpired
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		return ErrTokenNotValidYet
+	case errors.Is(err, jwt.ErrTokenInvalidIssuer):
+		return ErrTokenInvalidIssuer
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid) && !errors.Is(err, jwt.ErrTokenUnverifiable):
+		return ErrTokenSignatureInvalid
+	default:
+		return fmt.Errorf("%w: %v", ErrTokenSignatureInvalid, err)
+	}
 }
 
-func UpdateAllTokens(signedToken string, signedRefreshToken string, userId *string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+func UpdateAllTokens(ctx context.Context, users store.UserStore, signedToken string, signedRefreshToken string, userId *string) error {
+	ctx, cancel := context.WithTimeout(ctx, 100*time.Second)
 	defer cancel()
 
 	// Ensure userId is not nil
@@ -111,19 +413,9 @@ func UpdateAllTokens(signedToken string, signedRefreshToken string, userId *stri
 		return fmt.Errorf("user ID cannot be nil")
 	}
 
-	updateObj := bson.D{
-		{"token", signedToken},
-		{"refresh_token", signedRefreshToken},
-		{"updated_at", time.Now()},
-	}
-
-	upsert := true
-	filter := bson.M{"user_id": *userId}
-	opt := options.UpdateOptions{Upsert: &upsert}
-
-	_, err := userCollection.UpdateOne(ctx, filter, bson.D{{"$set", updateObj}}, &opt)
+	err := users.UpdateTokens(ctx, *userId, signedToken, signedRefreshToken)
 	if err != nil {
-		log.Println("Failed to update tokens:", err)
+		slog.Error("failed to update tokens", "uid", *userId, "error", err)
 		return err
 	}
 
@@ -0,0 +1,243 @@
+package helpers
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arunprasad2002/go-jwt/keyring"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testSecret   = "0123456789abcdef0123456789abcdef"
+	testIssuer   = "go-jwt"
+	testAudience = "go-jwt"
+)
+
+func TestValidateTokenRejectsMaliciousTokens(t *testing.T) {
+	signing, err := keyring.Generate("RS256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ring, err := keyring.New(signing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := ring.Signing()
+	tokens := NewTokens(testSecret, ring, testIssuer, []string{testAudience}, 0)
+
+	other, err := keyring.Generate("RS256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicPEM := pemPublicKey(t, key.Public)
+
+	tests := []struct {
+		name  string
+		token func(t *testing.T) string
+		// want is the error ValidateToken wraps, nil if the token is accepted
+		want error
+	}{
+		{
+			name:  "signed with the ring's key",
+			token: func(t *testing.T) string { return sign(t, jwt.SigningMethodRS256, key.ID, validClaims(), signing) },
+		},
+		{
+			name: "signed with the HMAC secret",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodHS256, "", validClaims(), []byte(testSecret))
+			},
+		},
+		{
+			name: "alg none",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodNone, "", validClaims(), jwt.UnsafeAllowNoneSignatureType)
+			},
+			want: ErrTokenSignatureInvalid,
+		},
+		{
+			name: "alg none with the ring's kid",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodNone, key.ID, validClaims(), jwt.UnsafeAllowNoneSignatureType)
+			},
+			want: ErrTokenSignatureInvalid,
+		},
+		{
+			name: "alg none with a stripped signature",
+			token: func(t *testing.T) string {
+				signed := sign(t, jwt.SigningMethodRS256, key.ID, validClaims(), signing)
+				parts := strings.Split(signed, ".")
+				header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+				return header + "." + parts[1] + "."
+			},
+			want: ErrTokenSignatureInvalid,
+		},
+		{
+			name: "HMAC keyed with the public key and the ring's kid",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodHS256, key.ID, validClaims(), publicPEM)
+			},
+			want: ErrTokenSignatureInvalid,
+		},
+		{
+			name: "HMAC keyed with the public key without kid",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodHS256, "", validClaims(), publicPEM)
+			},
+			want: ErrTokenSignatureInvalid,
+		},
+		{
+			name: "RSA without kid",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodRS256, "", validClaims(), signing)
+			},
+			want: ErrTokenSignatureInvalid,
+		},
+		{
+			name:  "unknown kid",
+			token: func(t *testing.T) string { return sign(t, jwt.SigningMethodRS256, "unknown", validClaims(), signing) },
+			want:  ErrTokenSignatureInvalid,
+		},
+		{
+			name:  "another key with the ring's kid",
+			token: func(t *testing.T) string { return sign(t, jwt.SigningMethodRS256, key.ID, validClaims(), other) },
+			want:  ErrTokenSignatureInvalid,
+		},
+		{
+			name: "algorithm outside the allowlist",
+			token: func(t *testing.T) string {
+				return sign(t, jwt.SigningMethodHS512, "", validClaims(), []byte(testSecret))
+			},
+			want: ErrTokenSignatureInvalid,
+		},
+		{
+			name: "tampered payload",
+			token: func(t *testing.T) string {
+				signed := sign(t, jwt.SigningMethodRS256, key.ID, validClaims(), signing)
+				claims := validClaims()
+				claims.User_type = "ADMIN"
+				forged := sign(t, jwt.SigningMethodRS256, key.ID, claims, other)
+				parts, forgedParts := strings.Split(signed, "."), strings.Split(forged, ".")
+				return parts[0] + "." + forgedParts[1] + "." + parts[2]
+			},
+			want: ErrTokenSignatureInvalid,
+		},
+		{
+			name: "expired",
+			token: func(t *testing.T) string {
+				claims := validClaims()
+				claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+				return sign(t, jwt.SigningMethodRS256, key.ID, claims, signing)
+			},
+			want: ErrTokenExpired,
+		},
+		{
+			name: "without expiry",
+			token: func(t *testing.T) string {
+				claims := validClaims()
+				claims.ExpiresAt = nil
+				return sign(t, jwt.SigningMethodRS256, key.ID, claims, signing)
+			},
+			want: ErrTokenMalformed,
+		},
+		{
+			name: "not valid yet",
+			token: func(t *testing.T) string {
+				claims := validClaims()
+				claims.NotBefore = jwt.NewNumericDate(time.Now().Add(time.Hour))
+				return sign(t, jwt.SigningMethodRS256, key.ID, claims, signing)
+			},
+			want: ErrTokenNotValidYet,
+		},
+		{
+			name: "another issuer",
+			token: func(t *testing.T) string {
+				claims := validClaims()
+				claims.Issuer = "evil"
+				return sign(t, jwt.SigningMethodRS256, key.ID, claims, signing)
+			},
+			want: ErrTokenInvalidIssuer,
+		},
+		{
+			name: "another audience",
+			token: func(t *testing.T) string {
+				claims := validClaims()
+				claims.Audience = jwt.ClaimStrings{"evil"}
+				return sign(t, jwt.SigningMethodRS256, key.ID, claims, signing)
+			},
+			want: ErrTokenInvalidAudience,
+		},
+		{
+			name:  "not a JWT",
+			token: func(t *testing.T) string { return "not.a.jwt" },
+			want:  ErrTokenMalformed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := tokens.ValidateToken(context.Background(), tt.token(t))
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("ValidateToken() = %v, want the token accepted", err)
+				}
+				if claims.Uid != "u1" {
+					t.Errorf("uid = %q, want u1", claims.Uid)
+				}
+				return
+			}
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("ValidateToken() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// validClaims are the claims of an access token the service would accept
+func validClaims() *SignedDetails {
+	now := time.Now()
+	return &SignedDetails{
+		Token_use: TokenUseAccess,
+		Uid:       "u1",
+		User_type: "USER",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        NewTokenID(),
+			Issuer:    testIssuer,
+			Subject:   "u1",
+			Audience:  jwt.ClaimStrings{testAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		},
+	}
+}
+
+// sign signs claims with method and key, setting kid if it is not empty
+func sign(t *testing.T, method jwt.SigningMethod, kid string, claims *SignedDetails, key interface{}) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// pemPublicKey encodes pub as an attacker would find it in a JWK Set or certificate
+func pemPublicKey(t *testing.T, pub crypto.PublicKey) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
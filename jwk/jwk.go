@@ -0,0 +1,154 @@
+// Package jwk encodes and decodes public keys as JSON Web Keys (RFC 7517).
+package jwk
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Key is a public JSON Web Key. Only RSA and EC P-256 keys are supported.
+type Key struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// EC
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// Set is a JWK Set as served from a jwks_uri.
+type Set struct {
+	Keys []Key `json:"keys"`
+}
+
+// Find returns the key with the given kid.
+func (s Set) Find(kid string) (Key, bool) {
+	for _, k := range s.Keys {
+		if k.Kid == kid {
+			return k, true
+		}
+	}
+	return Key{}, false
+}
+
+var b64 = base64.RawURLEncoding
+
+// New encodes pub as a JWK. The kid defaults to the key's RFC 7638 thumbprint.
+func New(pub crypto.PublicKey, kid string, alg string) (Key, error) {
+	var k Key
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		k = Key{
+			Kty: "RSA",
+			N:   b64.EncodeToString(pub.N.Bytes()),
+			E:   b64.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return Key{}, errors.New("jwk: only P-256 EC keys are supported")
+		}
+		k = Key{
+			Kty: "EC",
+			Crv: "P-256",
+			X:   b64.EncodeToString(pub.X.FillBytes(make([]byte, 32))),
+			Y:   b64.EncodeToString(pub.Y.FillBytes(make([]byte, 32))),
+		}
+	default:
+		return Key{}, fmt.Errorf("jwk: unsupported key type %T", pub)
+	}
+
+	k.Use = "sig"
+	k.Alg = alg
+	k.Kid = kid
+	if k.Kid == "" {
+		thumbprint, err := k.Thumbprint()
+		if err != nil {
+			return Key{}, err
+		}
+		k.Kid = thumbprint
+	}
+	return k, nil
+}
+
+// PublicKey decodes the key.
+func (k Key) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := b64.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("jwk: bad n: %w", err)
+		}
+		e, err := b64.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("jwk: bad e: %w", err)
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if len(n) == 0 || !exponent.IsInt64() || exponent.Int64() < 3 {
+			return nil, errors.New("jwk: invalid RSA key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("jwk: unsupported curve %q", k.Crv)
+		}
+		x, err := b64.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("jwk: bad x: %w", err)
+		}
+		y, err := b64.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("jwk: bad y: %w", err)
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("jwk: point is not on the curve")
+		}
+		return pub, nil
+	default:
+		return nil, fmt.Errorf("jwk: unsupported key type %q", k.Kty)
+	}
+}
+
+// Thumbprint returns the base64url SHA-256 JWK thumbprint of the key (RFC 7638).
+func (k Key) Thumbprint() (string, error) {
+	// The required members, in lexicographic order, without whitespace
+	var members interface{}
+	switch k.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{k.E, k.Kty, k.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{k.Crv, k.Kty, k.X, k.Y}
+	default:
+		return "", fmt.Errorf("jwk: unsupported key type %q", k.Kty)
+	}
+	encoded, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(encoded)
+	return b64.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,125 @@
+package jwk
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		pub  crypto.PublicKey
+		alg  string
+	}{
+		{name: "RSA", pub: &rsaKey.PublicKey, alg: "RS256"},
+		{name: "EC", pub: &ecKey.PublicKey, alg: "ES256"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := New(tt.pub, "", tt.alg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			thumbprint, err := key.Thumbprint()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if key.Kid != thumbprint {
+				t.Errorf("Kid = %q, want the thumbprint %q", key.Kid, thumbprint)
+			}
+
+			// Keys travel as JSON in a JWK Set
+			encoded, err := json.Marshal(Set{Keys: []Key{key}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var set Set
+			if err := json.Unmarshal(encoded, &set); err != nil {
+				t.Fatal(err)
+			}
+			decoded, ok := set.Find(key.Kid)
+			if !ok {
+				t.Fatalf("Find(%q) found no key", key.Kid)
+			}
+			pub, err := decoded.PublicKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !pub.(interface{ Equal(crypto.PublicKey) bool }).Equal(tt.pub) {
+				t.Error("decoded key differs from the encoded one")
+			}
+		})
+	}
+}
+
+func TestThumbprintIgnoresOptionalMembers(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := New(&ecKey.PublicKey, "", "ES256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	named, err := New(&ecKey.PublicKey, "named", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := key.Thumbprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := named.Thumbprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != b {
+		t.Errorf("thumbprints differ: %q and %q", a, b)
+	}
+}
+
+func TestPublicKeyRejectsInvalidKeys(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid, err := New(&ecKey.PublicKey, "", "ES256")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(k *Key)
+	}{
+		{name: "unsupported key type", mutate: func(k *Key) { k.Kty = "oct" }},
+		{name: "unsupported curve", mutate: func(k *Key) { k.Crv = "P-384" }},
+		{name: "point not on the curve", mutate: func(k *Key) { k.X, k.Y = k.Y, k.X }},
+		{name: "bad encoding", mutate: func(k *Key) { k.X = "not base64!" }},
+		{name: "RSA without modulus", mutate: func(k *Key) { *k = Key{Kty: "RSA", E: "AQAB"} }},
+		{name: "RSA exponent of one", mutate: func(k *Key) { *k = Key{Kty: "RSA", N: "AQAB", E: "AQ"} }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := valid
+			tt.mutate(&key)
+			if _, err := key.PublicKey(); err == nil {
+				t.Error("PublicKey() succeeded")
+			}
+		})
+	}
+}
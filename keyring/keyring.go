@@ -0,0 +1,202 @@
+// Package keyring holds the asymmetric keys the service signs tokens with and
+// publishes as a JWK Set.
+package keyring
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/arunprasad2002/go-jwt/jwk"
+)
+
+// Key is one key of the ring. Private is nil for keys that only verify
+// tokens issued before a rotation.
+type Key struct {
+	ID        string
+	Algorithm string
+	Private   crypto.Signer
+	Public    crypto.PublicKey
+}
+
+// Ring is the current signing key plus older keys still accepted for verification.
+type Ring struct {
+	signing *Key
+	keys    map[string]*Key
+	order   []string
+}
+
+// New builds a ring that signs with signing and also verifies tokens of the
+// verification keys. signing may be nil for a verification-only ring.
+func New(signing crypto.Signer, verification ...crypto.PublicKey) (*Ring, error) {
+	r := &Ring{keys: map[string]*Key{}}
+	if signing != nil {
+		key, err := newKey(signing.Public())
+		if err != nil {
+			return nil, err
+		}
+		key.Private = signing
+		r.signing = key
+		r.add(key)
+	}
+	for _, pub := range verification {
+		key, err := newKey(pub)
+		if err != nil {
+			return nil, err
+		}
+		r.add(key)
+	}
+	return r, nil
+}
+
+// Load reads a PEM signing key and PEM verification keys from files. Any of them may be omitted.
+func Load(signingKeyFile string, verificationKeyFiles []string) (*Ring, error) {
+	var signing crypto.Signer
+	if signingKeyFile != "" {
+		key, err := readPEM(signingKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		if signing, ok = key.(crypto.Signer); !ok {
+			return nil, fmt.Errorf("%s: not a private key", signingKeyFile)
+		}
+	}
+
+	var verification []crypto.PublicKey
+	for _, file := range verificationKeyFiles {
+		key, err := readPEM(file)
+		if err != nil {
+			return nil, err
+		}
+		if signer, ok := key.(crypto.Signer); ok {
+			key = signer.Public()
+		}
+		verification = append(verification, key)
+	}
+	return New(signing, verification...)
+}
+
+func (r *Ring) add(key *Key) {
+	if _, exists := r.keys[key.ID]; exists {
+		return
+	}
+	r.keys[key.ID] = key
+	r.order = append(r.order, key.ID)
+}
+
+// Signing returns the key new tokens are signed with.
+func (r *Ring) Signing() (*Key, bool) {
+	return r.signing, r.signing != nil
+}
+
+// Lookup returns the key with the given kid.
+func (r *Ring) Lookup(kid string) (*Key, bool) {
+	key, ok := r.keys[kid]
+	return key, ok
+}
+
+// Len returns the number of keys in the ring.
+func (r *Ring) Len() int {
+	return len(r.keys)
+}
+
+// JWKS returns the public keys of the ring as a JWK Set.
+func (r *Ring) JWKS() jwk.Set {
+	set := jwk.Set{Keys: []jwk.Key{}}
+	for _, kid := range r.order {
+		key := r.keys[kid]
+		encoded, err := jwk.New(key.Public, key.ID, key.Algorithm)
+		if err != nil {
+			continue
+		}
+		set.Keys = append(set.Keys, encoded)
+	}
+	return set
+}
+
+func newKey(pub crypto.PublicKey) (*Key, error) {
+	alg, err := algorithmFor(pub)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := jwk.New(pub, "", alg)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{ID: encoded.Kid, Algorithm: alg, Public: pub}, nil
+}
+
+func algorithmFor(pub crypto.PublicKey) (string, error) {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < 2048 {
+			return "", errors.New("keyring: RSA keys must be at least 2048 bits")
+		}
+		return "RS256", nil
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return "", errors.New("keyring: only P-256 EC keys are supported")
+		}
+		return "ES256", nil
+	default:
+		return "", fmt.Errorf("keyring: unsupported key type %T", pub)
+	}
+}
+
+func readPEM(path string) (interface{}, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block found", path)
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
+
+// Generate creates a new signing key for alg, either RS256 or ES256.
+func Generate(alg string) (crypto.Signer, error) {
+	switch alg {
+	case "RS256":
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case "ES256":
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	default:
+		return nil, fmt.Errorf("keyring: unsupported algorithm %q", alg)
+	}
+}
+
+// EncodePEM encodes a private key as a PKCS #8 PEM block.
+func EncodePEM(key crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
@@ -0,0 +1,152 @@
+package keyring
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	weakRSA, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		signing crypto.Signer
+		wantErr bool
+	}{
+		{name: "RS256", signing: generate(t, "RS256")},
+		{name: "ES256", signing: generate(t, "ES256")},
+		{name: "RSA key under 2048 bits", signing: weakRSA, wantErr: true},
+		{name: "P-384 key", signing: p384, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ring, err := New(tt.signing)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			key, ok := ring.Signing()
+			if !ok || key.Algorithm != tt.name || key.Private != tt.signing {
+				t.Fatalf("Signing() = %+v, %v", key, ok)
+			}
+		})
+	}
+}
+
+func TestJWKSPublishesEveryKey(t *testing.T) {
+	current := generate(t, "ES256")
+	previous := generate(t, "RS256")
+	// A verification key listed twice is published once
+	ring, err := New(current, previous.Public(), previous.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ring.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", ring.Len())
+	}
+
+	set := ring.JWKS()
+	if len(set.Keys) != 2 {
+		t.Fatalf("JWKS() has %d keys, want 2", len(set.Keys))
+	}
+	signing, _ := ring.Signing()
+	if set.Keys[0].Kid != signing.ID {
+		t.Errorf("first key = %q, want the signing key %q", set.Keys[0].Kid, signing.ID)
+	}
+	for _, published := range set.Keys {
+		key, ok := ring.Lookup(published.Kid)
+		if !ok {
+			t.Fatalf("Lookup(%q) found no key", published.Kid)
+		}
+		if published.Alg != key.Algorithm || published.Use != "sig" {
+			t.Errorf("key %q published with alg %q and use %q", published.Kid, published.Alg, published.Use)
+		}
+		if key.ID != signing.ID && key.Private != nil {
+			t.Errorf("verification key %q has a private key", key.ID)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	signing := generate(t, "ES256")
+	encoded, err := EncodePEM(signing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingFile := writeFile(t, dir, "signing.pem", encoded)
+
+	// Verification keys may be given as public keys or as the old private key
+	previous := generate(t, "RS256")
+	der, err := x509.MarshalPKIXPublicKey(previous.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicFile := writeFile(t, dir, "previous.pub", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	encoded, err = EncodePEM(generate(t, "ES256"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateFile := writeFile(t, dir, "older.pem", encoded)
+
+	ring, err := Load(signingFile, []string{publicFile, privateFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ring.Len() != 3 {
+		t.Errorf("Len() = %d, want 3", ring.Len())
+	}
+	key, ok := ring.Signing()
+	if !ok || !key.Public.(*ecdsa.PublicKey).Equal(signing.Public()) {
+		t.Error("the signing key was not loaded")
+	}
+
+	tests := []struct {
+		name string
+		file string
+	}{
+		{name: "missing file", file: filepath.Join(dir, "missing.pem")},
+		{name: "not PEM", file: writeFile(t, dir, "garbage.pem", []byte("garbage"))},
+		{name: "public key as signing key", file: publicFile},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load(tt.file, nil); err == nil {
+				t.Error("Load() succeeded")
+			}
+		})
+	}
+}
+
+func generate(t *testing.T, alg string) crypto.Signer {
+	key, err := Generate(alg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func writeFile(t *testing.T, dir string, name string, content []byte) string {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
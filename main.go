@@ -1,57 +1,294 @@
 package main
 
 import (
-	"log"
+	"context"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
 
-	"github.com/arunprasad2002/go-jwt/routes"
-	"github.com/gin-contrib/cors"
+	"github.com/arunprasad2002/go-jwt/app"
+	"github.com/arunprasad2002/go-jwt/config"
+	"github.com/arunprasad2002/go-jwt/database"
+	"github.com/arunprasad2002/go-jwt/helpers"
+	"github.com/arunprasad2002/go-jwt/keyring"
+	"github.com/arunprasad2002/go-jwt/logging"
+	"github.com/arunprasad2002/go-jwt/models"
+	"github.com/arunprasad2002/go-jwt/pki"
+	"github.com/arunprasad2002/go-jwt/store"
+	"github.com/arunprasad2002/go-jwt/tracing"
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
+	"go.opentelemetry.io/otel"
 )
 
 func main() {
-	// Check if running on Railway
-	isRailway := os.Getenv("RAILWAY_ENVIRONMENT") != "" || os.Getenv("RAILWAY_STATIC_URL") != ""
-
-	// Load .env in local development
-	if !isRailway {
-		err := godotenv.Load(".env")
-		if err != nil {
-			log.Println("No .env file found, using system environment variables")
-		}
-	} else {
-		log.Println("Running in Railway environment, using Railway variables")
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(configCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "keys" {
+		os.Exit(keysCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "certs" {
+		os.Exit(certsCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "openapi" {
+		os.Exit(openapiCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "users" {
+		os.Exit(usersCommand(os.Args[2:]))
 	}
 
-	// Get PORT from environment (Railway sets this automatically)
-	PORT := os.Getenv("PORT")
-	if PORT == "" {
-		PORT = "8080"
-		log.Println("PORT not found in environment, defaulting to 8080")
+	// Log as JSON from the start, the configured level applies once the app is open
+	slog.SetDefault(logging.New(os.Stdout, nil))
+
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fatal("failed to load configuration", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		fatal("invalid configuration", err)
 	}
 
 	// Set Gin mode based on environment
-	if os.Getenv("GIN_MODE") == "release" {
+	if cfg.GinMode == "release" {
 		gin.SetMode(gin.ReleaseMode)
 	}
+	// Gin's debug output goes through the JSON logger too
+	gin.DebugPrintRouteFunc = func(method, path, handler string, handlers int) {
+		slog.Debug("route registered", "method", method, "path", path, "handler", handler)
+	}
+	gin.DebugPrintFunc = func(format string, values ...any) {
+		slog.Debug(strings.TrimSpace(fmt.Sprintf(format, values...)))
+	}
+
+	application, err := app.Open(context.Background(), cfg)
+	if err != nil {
+		fatal("failed to open app", err)
+	}
+	slog.SetDefault(application.Logger)
+	otel.SetTracerProvider(application.Tracing)
+	otel.SetTextMapPropagator(tracing.Propagator)
+
+	// Shut down gracefully on SIGTERM or SIGINT, a second signal stops the process at once
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	runErr := application.Run(ctx)
+	stop()
 
-	// Initialize Gin router
-	router := gin.Default()
+	closeCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := application.Close(closeCtx); err != nil {
+		slog.Error("failed to close app", "error", err)
+	}
+	if runErr != nil {
+		fatal("server stopped", runErr)
+	}
+}
 
-	// Configure CORS
-	config := cors.DefaultConfig()
-	config.AllowAllOrigins = true
-	config.AllowCredentials = true
-	config.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
-	config.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization"}
-	router.Use(cors.New(config))
+// fatal logs err and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
 
-	// Initialize routes
-	routes.AuthRoutes(router)
-	routes.UserRoutes(router)
+// configCommand implements `config print [--redacted] [flags]`, which shows the effective configuration.
+func configCommand(args []string) int {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprintln(os.Stderr, "usage: go-jwt config print [--redacted] [config flags]")
+		return 2
+	}
+
+	redacted := false
+	var rest []string
+	for _, arg := range args[1:] {
+		if arg == "--redacted" || arg == "-redacted" {
+			redacted = true
+			continue
+		}
+		rest = append(rest, arg)
+	}
+
+	cfg, err := config.Load(rest)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := cfg.Print(os.Stdout, redacted); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// openapiCommand implements `openapi print [config flags]`, which prints the OpenAPI document
+// for generating clients.
+func openapiCommand(args []string) int {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprintln(os.Stderr, "usage: go-jwt openapi print [config flags]")
+		return 2
+	}
+
+	cfg, err := config.Load(args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	// Only the document goes to stdout, the routes are registered on an in-memory app without logging
+	cfg.LogLevel = "error"
+	gin.SetMode(gin.ReleaseMode)
+	application, err := app.New(cfg, store.NewMemoryStore())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer application.Close(context.Background())
+
+	out, err := json.MarshalIndent(application.Handler.OpenAPIDocument, "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println(string(out))
+	return 0
+}
+
+// usersCommand implements `users set-type EMAIL ADMIN|USER [config flags]`, which changes the
+// type of a user in the configured store. Signup only creates users, so the first admin is made here.
+func usersCommand(args []string) int {
+	if len(args) < 3 || args[0] != "set-type" || (args[2] != models.UserTypeAdmin && args[2] != models.UserTypeUser) {
+		fmt.Fprintln(os.Stderr, "usage: go-jwt users set-type EMAIL ADMIN|USER [config flags]")
+		return 2
+	}
+
+	cfg, err := config.Load(args[3:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	ctx := context.Background()
+	st, err := database.OpenStore(ctx, cfg, nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer st.Close(ctx)
+
+	user, err := st.Users.GetByEmail(ctx, args[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "finding %s: %v\n", args[1], err)
+		return 1
+	}
+	if _, err := helpers.NewAccounts(st, cfg.DeletionGracePeriod).SetUserType(ctx, *user.User_id, args[2]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("%s is now %s\n", args[1], args[2])
+	return 0
+}
+
+// keysCommand implements `keys generate [--alg RS256|ES256]`, which prints a new PEM signing key.
+func keysCommand(args []string) int {
+	if len(args) == 0 || args[0] != "generate" {
+		fmt.Fprintln(os.Stderr, "usage: go-jwt keys generate [--alg RS256|ES256]")
+		return 2
+	}
+
+	fs := flag.NewFlagSet("keys generate", flag.ContinueOnError)
+	alg := fs.String("alg", "ES256", "signing algorithm: RS256 or ES256")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	key, err := keyring.Generate(*alg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	encoded, err := keyring.EncodePEM(key)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	os.Stdout.Write(encoded)
+	return 0
+}
+
+// certsCommand implements `certs generate [--dir DIR] [--hosts HOSTS] [--client-cn NAME]`,
+// which writes a local CA with a server and a client certificate for trying out mutual TLS.
+func certsCommand(args []string) int {
+	if len(args) == 0 || args[0] != "generate" {
+		fmt.Fprintln(os.Stderr, "usage: go-jwt certs generate [--dir DIR] [--hosts localhost,127.0.0.1] [--client-cn NAME]")
+		return 2
+	}
+
+	fs := flag.NewFlagSet("certs generate", flag.ContinueOnError)
+	dir := fs.String("dir", "certs", "directory to write the PEM files to")
+	hosts := fs.String("hosts", "localhost,127.0.0.1", "comma separated DNS names and IPs of the server certificate")
+	clientCN := fs.String("client-cn", "service-client", "common name of the client certificate")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	ca, err := pki.NewAuthority("go-jwt local CA")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	server, err := ca.IssueServer("go-jwt", strings.Split(*hosts, ","))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	client, err := ca.IssueClient(pkix.Name{CommonName: *clientCN})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	caKey, err := ca.KeyPEM()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	files := []struct {
+		name string
+		data []byte
+		mode os.FileMode
+	}{
+		{"ca.pem", ca.CertPEM(), 0o644},
+		{"ca-key.pem", caKey, 0o600},
+		{"server.pem", server.CertPEM, 0o644},
+		{"server-key.pem", server.KeyPEM, 0o600},
+		{"client.pem", client.CertPEM, 0o644},
+		{"client-key.pem", client.KeyPEM, 0o600},
+	}
+	for _, file := range files {
+		if err := os.WriteFile(filepath.Join(*dir, file.name), file.data, file.mode); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
 
-	// Start server
-	log.Printf("Server running on port %s", PORT)
-	log.Fatal(router.Run(":" + PORT))
+	fmt.Printf("Wrote a CA, server and client certificate to %s\n", *dir)
+	fmt.Printf("Serve with TLS_CERT_FILE=%s TLS_KEY_FILE=%s TLS_CLIENT_CA_FILE=%s\n",
+		filepath.Join(*dir, "server.pem"), filepath.Join(*dir, "server-key.pem"), filepath.Join(*dir, "ca.pem"))
+	fmt.Printf("Client certificate subject (tls_client_auth_subject_dn): %s\n", client.Cert.Subject.String())
+	return 0
 }
@@ -0,0 +1,234 @@
+// Package metrics exposes Prometheus metrics about authentication and the
+// service's dependencies.
+//
+// Every label takes values from a small fixed set, so the number of series
+// does not grow with users, tokens or URLs. Free form values such as error
+// messages are mapped to one of the known values or to "other".
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+const namespace = "gojwt"
+
+// Results of token validation.
+const (
+	TokenValid     = "valid"
+	TokenExpired   = "expired"
+	TokenInvalid   = "invalid"
+	TokenRevoked   = "revoked"
+	TokenMalformed = "malformed"
+)
+
+// The label values that are passed through, anything else is counted as "other"
+var (
+	loginMethods  = []string{"password", "google", "device"}
+	loginReasons  = []string{"unknown email", "wrong password", "account is deactivated"}
+	signupReasons = []string{"email already exists", "phone already exists"}
+	grantTypes    = []string{"password", "google", "refresh_token", "client_credentials", "token_exchange", "device_code"}
+	httpMethods   = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+)
+
+// Metrics holds the collectors of one App. A nil *Metrics records nothing.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	logins           *prometheus.CounterVec
+	signups          *prometheus.CounterVec
+	tokensIssued     *prometheus.CounterVec
+	tokenValidations *prometheus.CounterVec
+	passwordHashing  *prometheus.HistogramVec
+	mongoCommands    *prometheus.HistogramVec
+	httpRequests     *prometheus.CounterVec
+	httpDuration     *prometheus.HistogramVec
+
+	// mongoStarted maps running Mongo commands to their collection
+	mongoStarted sync.Map
+}
+
+// New returns Metrics registered in a new registry, along with Go runtime and process metrics.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "logins_total",
+			Help:      "Login attempts by method, result and failure reason.",
+		}, []string{"method", "result", "reason"}),
+		signups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "signups_total",
+			Help:      "Sign ups by method, result and failure reason.",
+		}, []string{"method", "result", "reason"}),
+		tokensIssued: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "tokens_issued_total",
+			Help:      "Token requests at the token endpoints by grant type and result.",
+		}, []string{"grant_type", "result"}),
+		tokenValidations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "token_validations_total",
+			Help:      "Credentials presented to authenticated routes by kind and result.",
+		}, []string{"kind", "result"}),
+		passwordHashing: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "password_hash_duration_seconds",
+			Help:      "Time spent hashing and verifying passwords.",
+			Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 1.5, 2, 3, 5},
+		}, []string{"operation"}),
+		mongoCommands: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "mongo_command_duration_seconds",
+			Help:      "Latency of MongoDB commands by command, collection and result.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"command", "collection", "result"}),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by method, route and status code.",
+		}, []string{"method", "route", "code"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by method and route.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.logins, m.signups, m.tokensIssued, m.tokenValidations,
+		m.passwordHashing, m.mongoCommands, m.httpRequests, m.httpDuration,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// Login counts a login attempt. An empty reason is a successful login.
+func (m *Metrics) Login(method string, reason string) {
+	if m == nil {
+		return
+	}
+	m.logins.WithLabelValues(known(loginMethods, method), result(reason), label(loginReasons, reason)).Inc()
+}
+
+// Signup counts a sign up. An empty reason is a successful sign up.
+func (m *Metrics) Signup(method string, reason string) {
+	if m == nil {
+		return
+	}
+	m.signups.WithLabelValues(known(loginMethods, method), result(reason), label(signupReasons, reason)).Inc()
+}
+
+// TokenIssued counts a token request of grantType, refused if reason is set.
+func (m *Metrics) TokenIssued(grantType string, reason string) {
+	if m == nil {
+		return
+	}
+	m.tokensIssued.WithLabelValues(known(grantTypes, grantType), result(reason)).Inc()
+}
+
+// TokenValidated counts a credential presented to an authenticated route. kind
+// is "token" or "api_key", outcome one of the Token results.
+func (m *Metrics) TokenValidated(kind string, outcome string) {
+	if m == nil {
+		return
+	}
+	m.tokenValidations.WithLabelValues(kind, outcome).Inc()
+}
+
+// PasswordHashed records how long operation, "hash" or "verify", took since start.
+func (m *Metrics) PasswordHashed(operation string, start time.Time) {
+	if m == nil {
+		return
+	}
+	m.passwordHashing.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+// HTTPRequest records a served request. route is the route pattern, never the raw path.
+func (m *Metrics) HTTPRequest(method string, route string, code int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	method = known(httpMethods, method)
+	m.httpRequests.WithLabelValues(method, route, statusCode(code)).Inc()
+	m.httpDuration.WithLabelValues(method, route).Observe(duration.Seconds())
+}
+
+// MongoMonitor returns a command monitor that records the latency of every MongoDB command.
+func (m *Metrics) MongoMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			collection := "none"
+			if len(e.Command) > 0 {
+				// The first element names the command and holds its collection
+				if value, ok := e.Command.Index(0).Value().StringValueOK(); ok {
+					collection = value
+				}
+			}
+			m.mongoStarted.Store(e.RequestID, collection)
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			m.mongoFinished(e.CommandFinishedEvent, "success")
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			m.mongoFinished(e.CommandFinishedEvent, "failure")
+		},
+	}
+}
+
+func (m *Metrics) mongoFinished(e event.CommandFinishedEvent, result string) {
+	collection, ok := m.mongoStarted.LoadAndDelete(e.RequestID)
+	if !ok {
+		collection = "none"
+	}
+	m.mongoCommands.WithLabelValues(strings.ToLower(e.CommandName), collection.(string), result).Observe(e.Duration.Seconds())
+}
+
+func result(reason string) string {
+	if reason == "" {
+		return "success"
+	}
+	return "failure"
+}
+
+// label turns a failure reason into a label value, empty for successes
+func label(reasons []string, reason string) string {
+	if reason == "" {
+		return ""
+	}
+	return strings.ReplaceAll(known(reasons, reason), " ", "_")
+}
+
+func known(values []string, value string) string {
+	for _, v := range values {
+		if v == value {
+			return value
+		}
+	}
+	return "other"
+}
+
+// statusCode returns the status code as a label, unusual codes are grouped by class
+func statusCode(code int) string {
+	switch code {
+	case 200, 201, 202, 204, 302, 304, 400, 401, 403, 404, 409, 429, 500, 502, 503:
+		return strconv.Itoa(code)
+	}
+	return strconv.Itoa(code/100) + "xx"
+}
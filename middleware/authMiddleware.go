@@ -1,32 +1,264 @@
 package middleware
 
 import (
-	"net/http"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/arunprasad2002/go-jwt/helpers"
+	"github.com/arunprasad2002/go-jwt/metrics"
+	"github.com/arunprasad2002/go-jwt/problem"
 	"github.com/gin-gonic/gin"
 )
 
-func Authenticate() gin.HandlerFunc {
+const realm = "go-jwt"
+
+// Authenticate accepts a token from the Authorization: Bearer header (RFC 6750),
+// the legacy token header, or, in browser mode, the access token cookie.
+// Personal API keys are accepted in place of a token, also in an X-API-Key header.
+// DPoP bound tokens (RFC 9449) are sent as Authorization: DPoP and need a proof,
+// certificate bound tokens (RFC 8705) need the TLS client certificate they are bound to.
+// The outcome of every presented credential is counted in m.
+func Authenticate(tokens *helpers.Tokens, accounts *helpers.Accounts, cookies *helpers.Cookies, m *metrics.Metrics) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		clientToken := ctx.Request.Header.Get("token")
+		clientToken, scheme, fromCookie := requestToken(ctx, cookies)
 		if clientToken == "" {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "No Authorization header provided"})
-			ctx.Abort()
+			challenge(ctx, "", problem.New(problem.CodeTokenMissing, "No Authorization header provided"))
+			return
+		}
+		if fromCookie && !cookies.CheckCSRF(ctx) {
+			problem.Write(ctx, problem.New(problem.CodeCSRFFailed, ""))
+			return
+		}
+
+		if helpers.IsAPIKey(clientToken) && !fromCookie {
+			authenticateAPIKey(ctx, accounts, m, clientToken)
 			return
 		}
-		claims, err := helpers.ValidateToken(clientToken)
 
-		if err != "" {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err})
-			ctx.Abort()
+		reject := func(err error) {
+			m.TokenValidated("token", validationResult(err))
+			rejectToken(ctx, err)
+		}
+		claims, err := tokens.ValidateToken(ctx.Request.Context(), clientToken)
+		if err != nil {
+			reject(err)
+			return
+		}
+		// Refresh tokens cannot be used as access tokens
+		if !claims.IsAccessToken() {
+			m.TokenValidated("token", metrics.TokenInvalid)
+			challenge(ctx, "invalid_token", problem.New(problem.CodeTokenInvalid, "token is not an access token"))
+			return
+		}
+		if err := checkBinding(ctx, tokens, claims, clientToken, scheme); err != nil {
+			reject(err)
+			return
+		}
+		// Service account tokens act for the service account, not for a user
+		if claims.Client_id != "" {
+			if err := accounts.CheckServiceAccountActive(ctx.Request.Context(), claims.Client_id); err != nil {
+				reject(err)
+				return
+			}
+			m.TokenValidated("token", metrics.TokenValid)
+			ctx.Set("client_id", claims.Client_id)
+			ctx.Set("user_type", "SERVICE")
+			ctx.Set("scopes", claims.Scopes())
+			ctx.Next()
+			return
+		}
+		if err := accounts.CheckAccountActive(ctx.Request.Context(), claims.Uid, claims.IssuedAt.Unix()); err != nil {
+			reject(err)
 			return
 		}
+		m.TokenValidated("token", metrics.TokenValid)
 		ctx.Set("email", claims.Email)
 		ctx.Set("first_name", claims.First_name)
 		ctx.Set("last_name", claims.Last_name)
 		ctx.Set("user_type", claims.User_type)
 		ctx.Set("uid", claims.Uid)
+		ctx.Set("scopes", claims.Scopes())
+		if claims.Act != nil {
+			ctx.Set("actor", claims.Act.Subject)
+		}
 		ctx.Next()
 	}
 }
+
+// authenticateAPIKey authenticates a request made with a personal API key. The
+// key's scopes are limited to what its owner may currently be granted.
+func authenticateAPIKey(ctx *gin.Context, accounts *helpers.Accounts, m *metrics.Metrics, key string) {
+	reqCtx, cancel := context.WithTimeout(ctx.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	user, apiKey, err := accounts.AuthenticateAPIKey(reqCtx, key, ctx.ClientIP())
+	if err != nil {
+		m.TokenValidated("api_key", validationResult(err))
+		rejectToken(ctx, err)
+		return
+	}
+	m.TokenValidated("api_key", metrics.TokenValid)
+	scopes := []string{}
+	for _, scope := range apiKey.Scopes {
+		if helpers.HasScopes(helpers.UserScopes(*user.User_type), scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	ctx.Set("email", *user.Email)
+	ctx.Set("first_name", *user.First_name)
+	ctx.Set("last_name", *user.Last_name)
+	ctx.Set("user_type", *user.User_type)
+	ctx.Set("uid", *user.User_id)
+	ctx.Set("scopes", scopes)
+	ctx.Set("api_key_id", apiKey.Key_id)
+	ctx.Next()
+}
+
+// validationResult classifies why a credential was rejected for the metrics
+func validationResult(err error) string {
+	switch {
+	case errors.Is(err, helpers.ErrTokenMalformed):
+		return metrics.TokenMalformed
+	case errors.Is(err, helpers.ErrTokenExpired), errors.Is(err, helpers.ErrAPIKeyExpired):
+		return metrics.TokenExpired
+	case errors.Is(err, helpers.ErrSessionRevoked),
+		errors.Is(err, helpers.ErrAccountDeactivated),
+		errors.Is(err, helpers.ErrAccountPendingDeletion),
+		errors.Is(err, helpers.ErrServiceAccountDisabled),
+		errors.Is(err, helpers.ErrAPIKeyRevoked):
+		return metrics.TokenRevoked
+	default:
+		return metrics.TokenInvalid
+	}
+}
+
+// RequireScopes rejects requests whose access token was not granted every one of scopes.
+// It must run after Authenticate.
+func RequireScopes(scopes ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if helpers.HasScopes(ctx.GetStringSlice("scopes"), scopes...) {
+			ctx.Next()
+			return
+		}
+		header := fmt.Sprintf("Bearer realm=%q, error=%q, scope=%q", realm, "insufficient_scope", strings.Join(scopes, " "))
+		ctx.Header("WWW-Authenticate", header)
+		problem.Write(ctx, problem.New(problem.CodeInsufficientScope, "Token lacks the required scope: "+strings.Join(scopes, " ")))
+	}
+}
+
+// checkBinding makes sure a certificate bound token comes over a connection
+// authenticated with its certificate, that a DPoP bound token comes with a
+// proof from its key, and that only DPoP bound tokens use the DPoP scheme
+func checkBinding(ctx *gin.Context, tokens *helpers.Tokens, claims *helpers.SignedDetails, token string, scheme string) error {
+	if claims.CertificateBound() {
+		cert := helpers.ClientCertificate(ctx)
+		if cert == nil || helpers.CertificateThumbprint(cert) != claims.Cnf.X5tS256 {
+			return helpers.ErrCertificateMismatch
+		}
+	}
+	if !claims.DPoPBound() {
+		if scheme == "DPoP" {
+			return fmt.Errorf("%w: token is not DPoP bound", helpers.ErrInvalidDPoPProof)
+		}
+		return nil
+	}
+	// Sending a bound token as a bearer token would skip the proof
+	if scheme == "Bearer" {
+		return errDPoPScheme
+	}
+	proof := ctx.GetHeader(helpers.DPoPHeader)
+	if proof == "" {
+		return helpers.ErrDPoPRequired
+	}
+	jkt, err := tokens.VerifyDPoPProof(proof, ctx.Request.Method, helpers.RequestURL(ctx), token)
+	if err != nil {
+		return err
+	}
+	if jkt != claims.Cnf.JKT {
+		return helpers.ErrDPoPKeyMismatch
+	}
+	return nil
+}
+
+var errDPoPScheme = errors.New("DPoP bound tokens must be sent with the DPoP authorization scheme")
+
+// requestToken returns the presented token, its Authorization scheme if it came
+// in that header, and whether it came from a cookie
+func requestToken(ctx *gin.Context, cookies *helpers.Cookies) (string, string, bool) {
+	if header := ctx.GetHeader("Authorization"); header != "" {
+		scheme, token, found := strings.Cut(header, " ")
+		if found && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token), "Bearer", false
+		}
+		if found && strings.EqualFold(scheme, "DPoP") {
+			return strings.TrimSpace(token), "DPoP", false
+		}
+		return "", "", false
+	}
+	if token := ctx.GetHeader("token"); token != "" {
+		return token, "", false
+	}
+	if key := ctx.GetHeader("X-API-Key"); key != "" {
+		return key, "", false
+	}
+	if cookies != nil && cookies.Enabled {
+		if token, err := ctx.Cookie(helpers.AccessTokenCookie); err == nil {
+			return token, "", true
+		}
+	}
+	return "", "", false
+}
+
+// rejectToken maps a token validation error to its response: 400 for
+// malformed tokens, 401 with a specific description for everything else
+func rejectToken(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, helpers.ErrTokenMalformed):
+		header := fmt.Sprintf("Bearer realm=%q, error=%q, error_description=%q", realm, "invalid_request", "token is malformed")
+		ctx.Header("WWW-Authenticate", header)
+		problem.Write(ctx, problem.Wrap(err, problem.CodeTokenMalformed, "token is malformed"))
+	case errors.Is(err, helpers.ErrInvalidDPoPProof),
+		errors.Is(err, helpers.ErrDPoPRequired),
+		errors.Is(err, helpers.ErrDPoPKeyMismatch):
+		dpopChallenge(ctx, "invalid_dpop_proof", problem.Wrap(err, problem.CodeDPoPInvalid, err.Error()))
+	case errors.Is(err, errDPoPScheme):
+		dpopChallenge(ctx, "invalid_token", problem.Wrap(err, problem.CodeTokenInvalid, err.Error()))
+	case errors.Is(err, helpers.ErrTokenSignatureInvalid):
+		challenge(ctx, "invalid_token", problem.Wrap(err, problem.CodeTokenInvalid, helpers.ErrTokenSignatureInvalid.Error()))
+	case errors.Is(err, helpers.ErrTokenExpired),
+		errors.Is(err, helpers.ErrTokenNotValidYet),
+		errors.Is(err, helpers.ErrTokenInvalidIssuer),
+		errors.Is(err, helpers.ErrTokenInvalidAudience),
+		errors.Is(err, helpers.ErrSessionRevoked),
+		errors.Is(err, helpers.ErrAccountDeactivated),
+		errors.Is(err, helpers.ErrAccountPendingDeletion),
+		errors.Is(err, helpers.ErrServiceAccountDisabled),
+		errors.Is(err, helpers.ErrCertificateMismatch),
+		errors.Is(err, helpers.ErrInvalidAPIKey),
+		errors.Is(err, helpers.ErrAPIKeyExpired),
+		errors.Is(err, helpers.ErrAPIKeyRevoked):
+		challenge(ctx, "invalid_token", problem.Token(err))
+	default:
+		challenge(ctx, "invalid_token", problem.Wrap(err, problem.CodeTokenInvalid, "token is invalid"))
+	}
+}
+
+// challenge rejects the request with p, a 401 problem, and a Bearer WWW-Authenticate challenge
+func challenge(ctx *gin.Context, code string, p *problem.Problem) {
+	header := fmt.Sprintf("Bearer realm=%q", realm)
+	if code != "" {
+		header += fmt.Sprintf(", error=%q, error_description=%q", code, p.Detail)
+	}
+	ctx.Header("WWW-Authenticate", header)
+	problem.Write(ctx, p)
+}
+
+// dpopChallenge rejects the request with p and a DPoP WWW-Authenticate challenge (RFC 9449 section 7.1)
+func dpopChallenge(ctx *gin.Context, code string, p *problem.Problem) {
+	header := fmt.Sprintf("DPoP algs=%q, error=%q, error_description=%q", strings.Join(helpers.DPoPAlgorithms, " "), code, p.Detail)
+	ctx.Header("WWW-Authenticate", header)
+	problem.Write(ctx, p)
+}
@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/arunprasad2002/go-jwt/logging"
+	"github.com/arunprasad2002/go-jwt/metrics"
+	"github.com/arunprasad2002/go-jwt/problem"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries the ID that ties a request to its log lines
+const RequestIDHeader = "X-Request-ID"
+
+// RequestLogger gives every request an ID, the caller's X-Request-ID if it sent
+// a usable one, and a logger tagged with it, and with the trace of the request's
+// span, for handlers to get with logging.FromContext. The request is logged
+// once it has been handled.
+func RequestLogger(logger *slog.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		requestId := ctx.GetHeader(RequestIDHeader)
+		if !validRequestID(requestId) {
+			requestId = newRequestID()
+		}
+		ctx.Header(RequestIDHeader, requestId)
+		ctx.Set("request_id", requestId)
+		requestLogger := logger.With("request_id", requestId)
+		if span := trace.SpanContextFromContext(ctx.Request.Context()); span.IsValid() {
+			requestLogger = requestLogger.With("trace_id", span.TraceID().String())
+		}
+		ctx.Set(logging.ContextKey, requestLogger)
+
+		ctx.Next()
+
+		status := ctx.Writer.Status()
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		// The query is left out, it can hold codes and tokens
+		attrs := []any{
+			"method", ctx.Request.Method,
+			"path", ctx.Request.URL.Path,
+			"status", status,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"client_ip", ctx.ClientIP(),
+		}
+		if uid := ctx.GetString("uid"); uid != "" {
+			attrs = append(attrs, "uid", uid)
+		}
+		if clientId := ctx.GetString("client_id"); clientId != "" {
+			attrs = append(attrs, "client_id", clientId)
+		}
+		if len(ctx.Errors) > 0 {
+			attrs = append(attrs, "errors", ctx.Errors.String())
+		}
+		requestLogger.Log(ctx, level, "request handled", attrs...)
+	}
+}
+
+// Metrics records the method, route and status of every request. Requests that
+// match no route are counted under "unmatched" so random paths add no series.
+func Metrics(m *metrics.Metrics) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		ctx.Next()
+
+		route := ctx.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		m.HTTPRequest(ctx.Request.Method, route, ctx.Writer.Status(), time.Since(start))
+	}
+}
+
+// Recovery answers 500 to requests whose handler panicked and logs the panic with the request's logger
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(ctx *gin.Context, err any) {
+		logging.FromContext(ctx).Error("panic while handling request", "error", fmt.Sprint(err), "stack", string(debug.Stack()))
+		problem.Write(ctx, problem.New(problem.CodeInternal, ""))
+	})
+}
+
+// validRequestID accepts short IDs of characters that are safe to log and echo back
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
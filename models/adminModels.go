@@ -0,0 +1,6 @@
+package models
+
+// LogLevelRequest is the body accepted when changing the log level.
+type LogLevelRequest struct {
+	Level string `json:"level"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+)
+
+// APIKey is a long-lived personal credential a user creates for scripts. Only
+// a hash of the key is stored; Prefix is kept in the clear to look keys up
+// and to let users tell their keys apart.
+type APIKey struct {
+	Key_id       string     `json:"key_id"`
+	User_id      string     `json:"user_id"`
+	Name         string     `json:"name"`
+	Prefix       string     `json:"prefix"`
+	Key_hash     string     `json:"-"`
+	Scopes       []string   `json:"scopes"`
+	Created_at   time.Time  `json:"created_at"`
+	Expires_at   *time.Time `json:"expires_at,omitempty"`
+	Last_used_at *time.Time `json:"last_used_at,omitempty"`
+	Last_used_ip string     `json:"last_used_ip,omitempty"`
+	Revoked_at   *time.Time `json:"revoked_at,omitempty"`
+}
+
+// APIKeyRequest is the body accepted when creating an API key.
+type APIKeyRequest struct {
+	Name string `json:"name" validate:"required,min=2,max=100"`
+	// Scopes default to all the scopes of the token used to create the key
+	Scopes     []string   `json:"scopes"`
+	Expires_at *time.Time `json:"expires_at"`
+}
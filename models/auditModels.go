@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+)
+
+// Audit event outcomes.
+const (
+	AuditSuccess = "SUCCESS"
+	AuditFailure = "FAILURE"
+)
+
+// AuditEvent records a security relevant action: who did what to whom, whether
+// it worked, and where the request came from. Events form a hash chain, each
+// Hash covering the event and the Prev_hash of the one before it, so changing
+// or removing a stored event breaks the chain from that event on.
+type AuditEvent struct {
+	Sequence    int64             `bson:"_id" json:"sequence"`
+	Time        time.Time         `json:"time"`
+	Action      string            `json:"action"`
+	Outcome     string            `json:"outcome"`
+	Reason      string            `json:"reason,omitempty"`
+	Actor_id    string            `json:"actor_id,omitempty"`
+	Actor_type  string            `json:"actor_type,omitempty"`
+	Target_id   string            `json:"target_id,omitempty"`
+	Target_type string            `json:"target_type,omitempty"`
+	Ip          string            `json:"ip,omitempty"`
+	User_agent  string            `json:"user_agent,omitempty"`
+	Request_id  string            `json:"request_id,omitempty"`
+	Details     map[string]string `json:"details,omitempty"`
+	Prev_hash   string            `json:"prev_hash"`
+	Hash        string            `json:"hash"`
+}
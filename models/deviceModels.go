@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+)
+
+// Device authorization statuses.
+const (
+	DeviceStatusPending  = "PENDING"
+	DeviceStatusApproved = "APPROVED"
+	DeviceStatusDenied   = "DENIED"
+)
+
+// DeviceAuthorization is a pending device authorization grant (RFC 8628). The
+// device polls with its device code, of which only a hash is stored, while the
+// user approves the request in a browser by entering the user code.
+type DeviceAuthorization struct {
+	Device_code_hash string     `json:"-"`
+	User_code        string     `json:"user_code"`
+	Client_id        string     `json:"client_id"`
+	Scope            string     `json:"scope,omitempty"`
+	Status           string     `json:"status"`
+	User_id          string     `json:"user_id,omitempty"`
+	Interval         int        `json:"interval"`
+	Created_at       time.Time  `json:"created_at"`
+	Expires_at       time.Time  `json:"expires_at"`
+	Last_polled_at   *time.Time `json:"last_polled_at,omitempty"`
+}
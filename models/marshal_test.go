@@ -0,0 +1,71 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// secret is put in every field that must not be serialized
+const secret = "s3cr3t-value"
+
+func TestMarshalOmitsSecrets(t *testing.T) {
+	s := secret
+	userType := UserTypeUser
+	user := User{
+		First_name:         stringPointer("Ada"),
+		Last_name:          stringPointer("Lovelace"),
+		Password:           &s,
+		Email:              stringPointer("ada@example.com"),
+		Phone:              stringPointer("+441234567890"),
+		Token:              &s,
+		User_type:          &userType,
+		Refresh_token:      &s,
+		User_id:            stringPointer("u1"),
+		Created_at:         time.Now(),
+		Updated_at:         time.Now(),
+		Tokens_valid_after: &time.Time{},
+	}
+	tests := []struct {
+		name  string
+		value any
+		// want are fields that must still be serialized
+		want []string
+	}{
+		{name: "user", value: user, want: []string{"email", "user_type"}},
+		{name: "public user response", value: NewUserResponse(user, VisibilityPublic), want: []string{"first_name"}},
+		{name: "own user response", value: NewUserResponse(user, VisibilitySelf), want: []string{"email"}},
+		{name: "admin user response", value: NewUserResponse(user, VisibilityAdmin), want: []string{"email", "user_type"}},
+		{name: "session", value: Session{Session_id: "sid", User_id: "u1", Refresh_id: secret}, want: []string{"session_id"}},
+		{name: "api key", value: APIKey{Key_hash: secret}},
+		{name: "service account", value: ServiceAccount{Client_id: "billing", Secret_hash: secret}, want: []string{"client_id"}},
+		{name: "device authorization", value: DeviceAuthorization{Device_code_hash: secret, User_code: "ABCD-EFGH"}, want: []string{"user_code"}},
+		{name: "webhook subscription", value: WebhookSubscription{Secret: secret}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := json.Marshal(tt.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(out), secret) {
+				t.Errorf("JSON contains a secret: %s", out)
+			}
+			for _, field := range []string{"password", "token", "refresh_token", "refresh_id", "tokens_valid_after"} {
+				if strings.Contains(string(out), `"`+field+`"`) {
+					t.Errorf("JSON has field %s: %s", field, out)
+				}
+			}
+			for _, field := range tt.want {
+				if !strings.Contains(string(out), `"`+field+`"`) {
+					t.Errorf("JSON lacks field %s: %s", field, out)
+				}
+			}
+		})
+	}
+}
+
+func stringPointer(s string) *string {
+	return &s
+}
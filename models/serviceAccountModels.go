@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/arunprasad2002/go-jwt/jwk"
+)
+
+// ServiceAccount is a machine client that gets access tokens with the client
+// credentials grant, authenticating with its secret, with a JWT signed by
+// one of its public keys (private_key_jwt), or with a TLS client certificate
+// issued to Tls_client_auth_subject_dn (tls_client_auth).
+type ServiceAccount struct {
+	Client_id   string    `json:"client_id"`
+	Name        string    `json:"name"`
+	Scopes      []string  `json:"scopes"`
+	Secret_hash string    `json:"-"`
+	Public_keys []jwk.Key `json:"public_keys,omitempty"`
+	// Tls_client_auth_subject_dn is the subject of the client certificates that authenticate the account
+	Tls_client_auth_subject_dn string     `json:"tls_client_auth_subject_dn,omitempty"`
+	Created_by                 string     `json:"created_by"`
+	Created_at                 time.Time  `json:"created_at"`
+	Updated_at                 time.Time  `json:"updated_at"`
+	Secret_rotated_at          *time.Time `json:"secret_rotated_at,omitempty"`
+	Disabled_at                *time.Time `json:"disabled_at,omitempty"`
+}
+
+// ServiceAccountRequest is the body accepted when creating a service account.
+type ServiceAccountRequest struct {
+	Name        string    `json:"name" validate:"required,min=2,max=100"`
+	Scopes      []string  `json:"scopes" validate:"required,min=1"`
+	Public_keys []jwk.Key `json:"public_keys"`
+	// Tls_client_auth_subject_dn is written as Go's pkix.Name prints it, e.g. CN=billing,O=Example
+	Tls_client_auth_subject_dn string `json:"tls_client_auth_subject_dn" validate:"max=512"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+// Session records a token pair issued to a user at login. Refresh tokens are
+// rotated, only the one issued last is accepted.
+type Session struct {
+	Session_id string `json:"session_id"`
+	User_id    string `json:"user_id"`
+	Ip         string `json:"ip,omitempty"`
+	User_agent string `json:"user_agent,omitempty"`
+	// Audience and Scopes are what the tokens of the session were issued for
+	Audience string   `json:"audience,omitempty"`
+	Scopes   []string `json:"scopes,omitempty"`
+	// Refresh_id is the jti of the refresh token that may be used next
+	Refresh_id string     `json:"-"`
+	Created_at time.Time  `json:"created_at"`
+	Expires_at time.Time  `json:"expires_at"`
+	Revoked_at *time.Time `json:"revoked_at,omitempty"`
+}
@@ -6,17 +6,93 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// User is the stored user document. Password, Token and Refresh_token are
+// never serialized to JSON; responses go through UserResponse instead.
 type User struct {
-	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"-"`
 	First_name    *string            `json:"first_name" validate:"required,min=2,max=100"`
 	Last_name     *string            `json:"last_name" validate:"required,min=2,max=100"`
-	Password      *string            `json:"password" validate:"required"`
+	Password      *string            `json:"-" validate:"required"`
 	Email         *string            `json:"email" validate:"required,email"`
 	Phone         *string            `json:"phone" validate:"required"`
-	Token         *string            `json:"token,omitempty"`
+	Token         *string            `json:"-"`
 	User_type     *string            `json:"user_type" validate:"required,eq=ADMIN|eq=USER"`
-	Refresh_token *string            `json:"refresh_token,omitempty"`
+	Refresh_token *string            `json:"-"`
 	Created_at    time.Time          `json:"created_at"`
 	Updated_at    time.Time          `json:"updated_at"`
 	User_id       *string            `json:"user_id,omitempty"`
+
+	Status             *string    `json:"status,omitempty"`
+	Deactivated_at     *time.Time `json:"deactivated_at,omitempty"`
+	Delete_after       *time.Time `json:"delete_after,omitempty"`
+	Tokens_valid_after *time.Time `json:"-"`
+	Identities         []Identity `bson:"identities,omitempty" json:"identities,omitempty"`
+}
+
+// Account statuses. Users stored before statuses existed have none and count as active.
+const (
+	StatusActive          = "ACTIVE"
+	StatusDeactivated     = "DEACTIVATED"
+	StatusPendingDeletion = "PENDING_DELETION"
+)
+
+// User types. Signup creates users, only admins make other users admins.
+const (
+	UserTypeUser  = "USER"
+	UserTypeAdmin = "ADMIN"
+)
+
+// UserStatus returns the account status of user, defaulting to active.
+func UserStatus(user User) string {
+	if user.Status == nil || *user.Status == "" {
+		return StatusActive
+	}
+	return *user.Status
+}
+
+// Identity is an external identity provider account linked to a user.
+type Identity struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email,omitempty"`
+	Linked_at time.Time `json:"linked_at"`
+}
+
+// SignUpRequest is the body accepted by the signup endpoint.
+type SignUpRequest struct {
+	First_name *string `json:"first_name" validate:"required,min=2,max=100"`
+	Last_name  *string `json:"last_name" validate:"required,min=2,max=100"`
+	Password   *string `json:"password" validate:"required"`
+	Email      *string `json:"email" validate:"required,email"`
+	Phone      *string `json:"phone" validate:"required"`
+}
+
+// SetUserTypeRequest is the body accepted when an admin changes the type of a user.
+type SetUserTypeRequest struct {
+	User_type *string `json:"user_type" validate:"required,eq=ADMIN|eq=USER"`
+}
+
+// ChangeEmailRequest is the body accepted when users change their email. The
+// current password is required so a stolen token cannot take over the account.
+type ChangeEmailRequest struct {
+	Email    *string `json:"email" validate:"required,email"`
+	Password *string `json:"password" validate:"required"`
+}
+
+// LoginRequest is the body accepted by the login endpoint.
+type LoginRequest struct {
+	Email    *string `json:"email"`
+	Password *string `json:"password"`
+	// Audience is the client the tokens are for, the default audience if empty
+	Audience string `json:"audience"`
+	// Scope optionally narrows the granted scopes, space separated
+	Scope string `json:"scope"`
+}
+
+// RefreshRequest is the body accepted by the refresh endpoint. In browser
+// mode the refresh token is read from its cookie instead.
+type RefreshRequest struct {
+	Refresh_token string `json:"refresh_token"`
+	// Scope optionally narrows the scopes of the session, space separated
+	Scope string `json:"scope"`
 }
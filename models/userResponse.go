@@ -0,0 +1,87 @@
+package models
+
+import (
+	"time"
+)
+
+// Visibility decides which user fields a caller is allowed to see.
+type Visibility int
+
+const (
+	VisibilityPublic Visibility = iota
+	VisibilitySelf
+	VisibilityAdmin
+)
+
+// UserResponse is the only shape a user is ever serialized in. It has no
+// password or token fields, so they cannot leak from any endpoint.
+type UserResponse struct {
+	ID         string     `json:"id,omitempty"`
+	User_id    string     `json:"user_id"`
+	First_name string     `json:"first_name"`
+	Last_name  string     `json:"last_name"`
+	Email      string     `json:"email,omitempty"`
+	Phone      string     `json:"phone,omitempty"`
+	User_type  string     `json:"user_type,omitempty"`
+	Created_at *time.Time `json:"created_at,omitempty"`
+	Updated_at *time.Time `json:"updated_at,omitempty"`
+
+	Status         string     `json:"status,omitempty"`
+	Delete_after   *time.Time `json:"delete_after,omitempty"`
+	Deactivated_at *time.Time `json:"deactivated_at,omitempty"`
+	Identities     []Identity `json:"identities,omitempty"`
+}
+
+// NewUserResponse builds the response for user as seen with the given visibility.
+func NewUserResponse(user User, visibility Visibility) UserResponse {
+	res := UserResponse{
+		User_id:    deref(user.User_id),
+		First_name: deref(user.First_name),
+		Last_name:  deref(user.Last_name),
+	}
+	if visibility == VisibilityPublic {
+		return res
+	}
+
+	// Self and admin can see contact details
+	res.Email = deref(user.Email)
+	res.Phone = deref(user.Phone)
+	res.User_type = deref(user.User_type)
+	if !user.Created_at.IsZero() {
+		createdAt := user.Created_at
+		res.Created_at = &createdAt
+	}
+	res.Status = UserStatus(user)
+	res.Delete_after = user.Delete_after
+	res.Identities = user.Identities
+	if visibility == VisibilitySelf {
+		return res
+	}
+
+	// Admin-only fields
+	if !user.ID.IsZero() {
+		res.ID = user.ID.Hex()
+	}
+	if !user.Updated_at.IsZero() {
+		updatedAt := user.Updated_at
+		res.Updated_at = &updatedAt
+	}
+	res.Deactivated_at = user.Deactivated_at
+	return res
+}
+
+// NewUserResponses maps a list of users with the same visibility.
+func NewUserResponses(users []User, visibility Visibility) []UserResponse {
+	res := make([]UserResponse, 0, len(users))
+	for _, user := range users {
+		res = append(res, NewUserResponse(user, visibility))
+	}
+	return res
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
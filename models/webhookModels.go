@@ -0,0 +1,60 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Webhook delivery statuses. Deliveries that ran out of attempts stay DEAD
+// until an admin redelivers them.
+const (
+	WebhookPending   = "PENDING"
+	WebhookDelivered = "DELIVERED"
+	WebhookDead      = "DEAD"
+)
+
+// WebhookSubscription is an endpoint that is sent the events it subscribed to.
+// Secret signs the payloads, it is only shown when the subscription is created.
+type WebhookSubscription struct {
+	Subscription_id string    `json:"subscription_id"`
+	Url             string    `json:"url"`
+	Events          []string  `json:"events"`
+	Description     string    `json:"description,omitempty"`
+	Secret          string    `json:"-"`
+	Created_by      string    `json:"created_by,omitempty"`
+	Created_at      time.Time `json:"created_at"`
+}
+
+// WebhookSubscriptionRequest is the body accepted when creating a webhook subscription.
+type WebhookSubscriptionRequest struct {
+	Url         string   `json:"url" validate:"required,url"`
+	Events      []string `json:"events" validate:"required,min=1"`
+	Description string   `json:"description" validate:"max=200"`
+}
+
+// WebhookEvent is an entry of the webhook outbox. It is stored in the same
+// transaction as the change it describes and marshals to the payload sent to
+// subscribers.
+type WebhookEvent struct {
+	Event_id      string          `json:"id"`
+	Type          string          `json:"type"`
+	Created_at    time.Time       `json:"timestamp"`
+	Data          json.RawMessage `json:"data"`
+	Dispatched_at *time.Time      `json:"-"`
+}
+
+// WebhookDelivery tracks sending one event to one subscription.
+type WebhookDelivery struct {
+	Delivery_id      string     `json:"delivery_id"`
+	Event_id         string     `json:"event_id"`
+	Event_type       string     `json:"event_type"`
+	Subscription_id  string     `json:"subscription_id"`
+	Status           string     `json:"status"`
+	Attempts         int        `json:"attempts"`
+	Next_attempt_at  time.Time  `json:"next_attempt_at"`
+	Last_attempt_at  *time.Time `json:"last_attempt_at,omitempty"`
+	Last_status_code int        `json:"last_status_code,omitempty"`
+	Last_error       string     `json:"last_error,omitempty"`
+	Created_at       time.Time  `json:"created_at"`
+	Delivered_at     *time.Time `json:"delivered_at,omitempty"`
+}
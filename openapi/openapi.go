@@ -0,0 +1,450 @@
+// Package openapi describes the service's HTTP API as an OpenAPI 3.1 document.
+//
+// The document is built from a table of routes whose request and response
+// bodies are given as Go values. Their schemas are derived from the types by
+// reflection, following their json tags and validate rules, so they cannot
+// drift from the models. Errors are described by the problem codes a route
+// answers with. The router is registered from the same table, Check compares
+// the document with the routes it ended up with so tests catch a route that
+// was registered some other way.
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/arunprasad2002/go-jwt/problem"
+	"github.com/gin-gonic/gin"
+)
+
+// Version is the OpenAPI version of the documents.
+const Version = "3.1.0"
+
+// Names of the security schemes.
+const (
+	SchemeBearer = "bearerAuth"
+	SchemeAPIKey = "apiKey"
+	SchemeOAuth2 = "oauth2"
+)
+
+// Media types of request and response bodies.
+const (
+	JSON = "application/json"
+	Form = "application/x-www-form-urlencoded"
+	HTML = "text/html"
+	Text = "text/plain"
+)
+
+// authErrors are the problems of the authentication middleware, any route that needs a credential may answer with them
+var authErrors = []string{
+	problem.CodeTokenMissing, problem.CodeTokenMalformed, problem.CodeTokenExpired, problem.CodeTokenInvalid,
+	problem.CodeTokenRevoked, problem.CodeAccountInactive, problem.CodeDPoPInvalid, problem.CodeDPoPRequired,
+	problem.CodeCSRFFailed, problem.CodeInsufficientScope,
+}
+
+// API is what the document is built from.
+type API struct {
+	Info Info
+	// Scopes describes every scope routes may require
+	Scopes map[string]string
+	// TokenURL is the OAuth 2.0 token endpoint, relative to the service
+	TokenURL string
+	Routes   []Route
+}
+
+// Route is one method and path of the router, with the handler that serves
+// it and its documentation.
+type Route struct {
+	Method string
+	// Path is written as Gin routes are, parameters start with a colon
+	Path string
+	// ID names the operation, for clients generated from the document
+	ID          string
+	Tag         string
+	Summary     string
+	Description string
+	// Public routes need no credential, the others need one with all of Scopes
+	Public bool
+	Scopes []string
+	Query  []Param
+	// Request is a value of the body's type, there is no body if it is nil
+	Request any
+	// RequestType is the media type of the body, JSON if empty
+	RequestType string
+	// Status is the status of success, 200 if it is zero. Redirects have no body.
+	Status int
+	// Response is a value of the body's type, any JSON value if it is nil
+	Response any
+	// ResponseType is the media type of the body, JSON if empty
+	ResponseType string
+	// Downloads are further media types the body may be sent as, such as archives
+	Downloads []string
+	// Errors are the problem codes of the route, those of authentication are added for routes that are not public
+	Errors []string
+	// OAuthErrors says errors are sent as RFC 6749 requires instead of as problems
+	OAuthErrors bool
+	// Handler serves the route, it is not part of the document
+	Handler gin.HandlerFunc
+}
+
+// Param is a query parameter.
+type Param struct {
+	Name        string
+	Description string
+	// Type is the JSON type of the value, string if empty
+	Type     string
+	Required bool
+}
+
+// Document is an OpenAPI document.
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Tags       []Tag               `json:"tags,omitempty"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type Tag struct {
+	Name string `json:"name"`
+}
+
+// PathItem holds the operations of a path by lower case method.
+type PathItem map[string]*Operation
+
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name        string `json:"name"`
+	In          string `json:"in"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required"`
+	Schema      Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Headers     map[string]Header    `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type Header struct {
+	Description string `json:"description,omitempty"`
+	Schema      Schema `json:"schema"`
+}
+
+type MediaType struct {
+	Schema   Schema             `json:"schema"`
+	Examples map[string]Example `json:"examples,omitempty"`
+}
+
+type Example struct {
+	Summary string `json:"summary,omitempty"`
+	Value   any    `json:"value"`
+}
+
+type Components struct {
+	Schemas         map[string]Schema         `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type         string      `json:"type"`
+	Description  string      `json:"description,omitempty"`
+	Scheme       string      `json:"scheme,omitempty"`
+	BearerFormat string      `json:"bearerFormat,omitempty"`
+	Name         string      `json:"name,omitempty"`
+	In           string      `json:"in,omitempty"`
+	Flows        *OAuthFlows `json:"flows,omitempty"`
+}
+
+type OAuthFlows struct {
+	ClientCredentials *OAuthFlow `json:"clientCredentials,omitempty"`
+}
+
+type OAuthFlow struct {
+	TokenURL string            `json:"tokenUrl"`
+	Scopes   map[string]string `json:"scopes"`
+}
+
+// OAuthError is the body of the errors of the OAuth endpoints, RFC 6749 prescribes it.
+type OAuthError struct {
+	Error             string `json:"error"`
+	Error_description string `json:"error_description,omitempty"`
+}
+
+// Build returns the document of api. It fails if two routes share a method
+// and path or name a problem code or scope that does not exist.
+func Build(api API) (*Document, error) {
+	s := newSchemas()
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    api.Info,
+		Paths:   map[string]PathItem{},
+		Components: Components{
+			Schemas:         s.components,
+			SecuritySchemes: securitySchemes(api),
+		},
+	}
+	problemRef := s.of(reflect.TypeOf(problem.Problem{}), false)
+	oauthRef := s.of(reflect.TypeOf(OAuthError{}), false)
+
+	var tags []string
+	for _, route := range api.Routes {
+		path := Path(route.Path)
+		method := strings.ToLower(route.Method)
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = PathItem{}
+		}
+		if _, ok := doc.Paths[path][method]; ok {
+			return nil, fmt.Errorf("openapi: %s %s is documented twice", route.Method, route.Path)
+		}
+		for _, scope := range route.Scopes {
+			if _, ok := api.Scopes[scope]; !ok {
+				return nil, fmt.Errorf("openapi: %s %s requires undescribed scope %q", route.Method, route.Path, scope)
+			}
+		}
+
+		op := &Operation{
+			OperationID: route.ID,
+			Summary:     route.Summary,
+			Description: route.Description,
+			Parameters:  parameters(route),
+			Responses:   map[string]Response{},
+		}
+		if route.Tag != "" {
+			op.Tags = []string{route.Tag}
+			if !slices.Contains(tags, route.Tag) {
+				tags = append(tags, route.Tag)
+			}
+		}
+		if !route.Public {
+			op.Security = []map[string][]string{
+				{SchemeBearer: route.Scopes},
+				{SchemeAPIKey: route.Scopes},
+				{SchemeOAuth2: route.Scopes},
+			}
+		}
+		if route.Request != nil {
+			op.RequestBody = &RequestBody{
+				Required: true,
+				Content: map[string]MediaType{
+					orDefault(route.RequestType, JSON): {Schema: s.of(reflect.TypeOf(route.Request), true)},
+				},
+			}
+		}
+
+		status := route.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		op.Responses[strconv.Itoa(status)] = success(s, route, status)
+
+		if route.OAuthErrors {
+			op.Responses["400"] = Response{
+				Description: "The request was rejected, see error for why",
+				Content:     map[string]MediaType{JSON: {Schema: oauthRef}},
+			}
+			op.Responses["401"] = Response{
+				Description: "Client authentication failed",
+				Content:     map[string]MediaType{JSON: {Schema: oauthRef}},
+			}
+		}
+		codes := append([]string(nil), route.Errors...)
+		if !route.Public {
+			codes = append(codes, authErrors...)
+		}
+		codes = append(codes, problem.CodeInternal)
+		problems, err := problemResponses(codes, problemRef)
+		if err != nil {
+			return nil, fmt.Errorf("openapi: %s %s: %w", route.Method, route.Path, err)
+		}
+		for status, response := range problems {
+			if _, ok := op.Responses[status]; !ok {
+				op.Responses[status] = response
+			}
+		}
+		doc.Paths[path][method] = op
+	}
+	for _, tag := range tags {
+		doc.Tags = append(doc.Tags, Tag{Name: tag})
+	}
+	return doc, nil
+}
+
+// Check reports the routes of the router that are not in the document, and
+// the documented ones the router does not have.
+func (d *Document) Check(routes gin.RoutesInfo) error {
+	registered := map[string]bool{}
+	var undocumented []string
+	for _, route := range routes {
+		path := Path(route.Path)
+		registered[route.Method+" "+path] = true
+		if _, ok := d.Paths[path][strings.ToLower(route.Method)]; !ok {
+			undocumented = append(undocumented, route.Method+" "+route.Path)
+		}
+	}
+	var stale []string
+	for path, item := range d.Paths {
+		for method := range item {
+			if !registered[strings.ToUpper(method)+" "+path] {
+				stale = append(stale, strings.ToUpper(method)+" "+path)
+			}
+		}
+	}
+	sort.Strings(undocumented)
+	sort.Strings(stale)
+
+	var problems []string
+	if len(undocumented) > 0 {
+		problems = append(problems, "routes missing from the OpenAPI document: "+strings.Join(undocumented, ", "))
+	}
+	if len(stale) > 0 {
+		problems = append(problems, "OpenAPI document has routes that are not registered: "+strings.Join(stale, ", "))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("openapi: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Path converts a Gin path to an OpenAPI one, /users/:user_id becomes /users/{user_id}.
+func Path(ginPath string) string {
+	segments := strings.Split(ginPath, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// parameters lists the path parameters of the route followed by its query parameters
+func parameters(route Route) []Parameter {
+	var params []Parameter
+	for _, segment := range strings.Split(route.Path, "/") {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			params = append(params, Parameter{Name: segment[1:], In: "path", Required: true, Schema: Schema{"type": "string"}})
+		}
+	}
+	for _, param := range route.Query {
+		params = append(params, Parameter{
+			Name:        param.Name,
+			In:          "query",
+			Description: param.Description,
+			Required:    param.Required,
+			Schema:      Schema{"type": orDefault(param.Type, "string")},
+		})
+	}
+	return params
+}
+
+// success describes the response of a route that worked
+func success(s *schemas, route Route, status int) Response {
+	response := Response{Description: http.StatusText(status)}
+	if status >= 300 && status < 400 {
+		response.Headers = map[string]Header{
+			"Location": {Description: "Where the client is sent", Schema: Schema{"type": "string", "format": "uri"}},
+		}
+		return response
+	}
+	contentType := orDefault(route.ResponseType, JSON)
+	schema := Schema{"type": "string"}
+	if contentType == JSON {
+		schema = Schema{}
+		if route.Response != nil {
+			schema = s.of(reflect.TypeOf(route.Response), false)
+		}
+	}
+	response.Content = map[string]MediaType{contentType: {Schema: schema}}
+	for _, download := range route.Downloads {
+		response.Content[download] = MediaType{Schema: Schema{"type": "string", "contentMediaType": download}}
+	}
+	return response
+}
+
+// problemResponses groups problem codes by status, each code is an example of its response
+func problemResponses(codes []string, problemRef Schema) (map[string]Response, error) {
+	responses := map[string]Response{}
+	for _, code := range codes {
+		definition, ok := problem.Lookup(code)
+		if !ok {
+			return nil, fmt.Errorf("unknown problem code %q", code)
+		}
+		status := strconv.Itoa(definition.Status)
+		response, ok := responses[status]
+		if !ok {
+			response = Response{
+				Description: http.StatusText(definition.Status),
+				Content:     map[string]MediaType{problem.ContentType: {Schema: problemRef, Examples: map[string]Example{}}},
+			}
+		}
+		response.Content[problem.ContentType].Examples[code] = Example{
+			Summary: definition.Title,
+			Value: problem.Problem{
+				Type:   problem.TypePrefix + code,
+				Title:  definition.Title,
+				Status: definition.Status,
+				Code:   code,
+			},
+		}
+		responses[status] = response
+	}
+	return responses, nil
+}
+
+func securitySchemes(api API) map[string]SecurityScheme {
+	return map[string]SecurityScheme{
+		SchemeBearer: {
+			Type:         "http",
+			Scheme:       "bearer",
+			BearerFormat: "JWT",
+			Description:  "Access token from login, refresh or the token endpoint. DPoP bound tokens are sent with the DPoP scheme and a DPoP proof header instead.",
+		},
+		SchemeAPIKey: {
+			Type:        "apiKey",
+			Name:        "X-API-Key",
+			In:          "header",
+			Description: "Personal API key, limited to the scopes it was created with.",
+		},
+		SchemeOAuth2: {
+			Type:        "oauth2",
+			Description: "Access token of a service account.",
+			Flows: &OAuthFlows{
+				ClientCredentials: &OAuthFlow{TokenURL: api.TokenURL, Scopes: api.Scopes},
+			},
+		},
+	}
+}
+
+func orDefault(value string, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,65 @@
+package openapi
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCheck(t *testing.T) {
+	doc, err := Build(API{Routes: []Route{
+		{Method: http.MethodGet, Path: "/users/:user_id", ID: "getUser", Public: true},
+		{Method: http.MethodPost, Path: "/users/signup", ID: "signUp", Public: true},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		routes gin.RoutesInfo
+		// want are parts of the error, nil if the routes match the document
+		want []string
+	}{
+		{
+			name:   "every route documented",
+			routes: gin.RoutesInfo{{Method: http.MethodGet, Path: "/users/:user_id"}, {Method: http.MethodPost, Path: "/users/signup"}},
+		},
+		{
+			name: "undocumented route",
+			routes: gin.RoutesInfo{{Method: http.MethodGet, Path: "/users/:user_id"}, {Method: http.MethodPost, Path: "/users/signup"},
+				{Method: http.MethodDelete, Path: "/users/:user_id"}},
+			want: []string{"missing from the OpenAPI document: DELETE /users/:user_id"},
+		},
+		{
+			name:   "documented route that is not registered",
+			routes: gin.RoutesInfo{{Method: http.MethodGet, Path: "/users/:user_id"}},
+			want:   []string{"not registered: POST /users/signup"},
+		},
+		{
+			name:   "both",
+			routes: gin.RoutesInfo{{Method: http.MethodGet, Path: "/users/:user_id"}, {Method: http.MethodGet, Path: "/users"}},
+			want:   []string{"missing from the OpenAPI document: GET /users", "not registered: POST /users/signup"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := doc.Check(tt.routes)
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Check() = nil, want an error")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Check() = %v, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package openapi
+
+import (
+	"encoding/json"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Schema is a JSON Schema, which OpenAPI 3.1 uses as is.
+type Schema map[string]any
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// schemas derives schemas from Go types. Named structs become components
+// that are referred to, everything else is written inline.
+type schemas struct {
+	components map[string]Schema
+	types      map[string]reflect.Type
+}
+
+func newSchemas() *schemas {
+	return &schemas{components: map[string]Schema{}, types: map[string]reflect.Type{}}
+}
+
+// of returns the schema of t. Request fields are required when they are
+// validated as required, response fields when they are not omitted if empty.
+func (s *schemas) of(t reflect.Type, request bool) Schema {
+	switch {
+	case t == timeType:
+		return Schema{"type": "string", "format": "date-time"}
+	case t == rawMessageType:
+		return Schema{}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return s.of(t.Elem(), request)
+	case reflect.String:
+		return Schema{"type": "string"}
+	case reflect.Bool:
+		return Schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return Schema{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return Schema{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return Schema{"type": "string", "contentEncoding": "base64"}
+		}
+		return Schema{"type": "array", "items": s.of(t.Elem(), request)}
+	case reflect.Map:
+		return Schema{"type": "object", "additionalProperties": s.of(t.Elem(), request)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t, request)
+		}
+		return Schema{"$ref": "#/components/schemas/" + s.component(t, request)}
+	}
+	// Interfaces such as the values of gin.H can be anything
+	return Schema{}
+}
+
+// component registers the schema of a named struct and returns its name.
+// Types of different packages that share a name are told apart by their package.
+func (s *schemas) component(t reflect.Type, request bool) string {
+	name := exported(t.Name())
+	if existing, ok := s.types[name]; ok && existing != t {
+		name = exported(path.Base(t.PkgPath())) + name
+	}
+	if _, ok := s.types[name]; ok {
+		return name
+	}
+	// Registered before its fields, so types that refer to themselves end
+	s.types[name] = t
+	s.components[name] = Schema{}
+	s.components[name] = s.object(t, request)
+	return name
+}
+
+// object returns the schema of a struct the way encoding/json marshals it
+func (s *schemas) object(t reflect.Type, request bool) Schema {
+	properties := map[string]Schema{}
+	var required []string
+	s.fields(t, request, properties, &required)
+	schema := Schema{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func (s *schemas) fields(t reflect.Type, request bool, properties map[string]Schema, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		// Embedded structs without a name are flattened, as encoding/json does
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				s.fields(embedded, request, properties, required)
+				continue
+			}
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema := s.of(field.Type, request)
+		rules := field.Tag.Get("validate")
+		constrain(schema, field.Type, rules)
+		properties[name] = schema
+
+		omitempty := strings.Contains(","+options+",", ",omitempty,")
+		if request && hasRule(rules, "required") || !request && !omitempty {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// constrain adds the validate rules of a field that JSON Schema can express
+func constrain(schema Schema, t reflect.Type, rules string) {
+	if rules == "" || schema["$ref"] != nil {
+		return
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	for _, rule := range strings.Split(rules, ",") {
+		// Alternatives such as eq=ADMIN|eq=USER list the allowed values
+		if strings.Contains(rule, "|") {
+			var values []string
+			for _, alternative := range strings.Split(rule, "|") {
+				tag, value, _ := strings.Cut(alternative, "=")
+				if tag != "eq" {
+					values = nil
+					break
+				}
+				values = append(values, value)
+			}
+			if values != nil {
+				schema["enum"] = values
+			}
+			continue
+		}
+		tag, param, _ := strings.Cut(rule, "=")
+		switch tag {
+		case "email":
+			schema["format"] = "email"
+		case "url", "http_url":
+			schema["format"] = "uri"
+		case "oneof":
+			schema["enum"] = strings.Fields(param)
+		case "eq":
+			schema["const"] = param
+		case "min", "max", "len":
+			n, err := strconv.Atoi(param)
+			if err != nil {
+				continue
+			}
+			for _, keyword := range bounds(t.Kind(), tag) {
+				schema[keyword] = n
+			}
+		}
+	}
+}
+
+// bounds names the keywords that bound a value of kind by a min, max or len rule
+func bounds(kind reflect.Kind, tag string) []string {
+	var min, max string
+	switch kind {
+	case reflect.String:
+		min, max = "minLength", "maxLength"
+	case reflect.Slice, reflect.Array:
+		min, max = "minItems", "maxItems"
+	case reflect.Map:
+		min, max = "minProperties", "maxProperties"
+	default:
+		min, max = "minimum", "maximum"
+	}
+	switch tag {
+	case "min":
+		return []string{min}
+	case "max":
+		return []string{max}
+	}
+	return []string{min, max}
+}
+
+// exported capitalizes name, components of unexported types are named like the others
+func exported(name string) string {
+	runes := []rune(name)
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
+
+func hasRule(rules string, name string) bool {
+	for _, rule := range strings.Split(rules, ",") {
+		if rule == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package problem
+
+import "net/http"
+
+// Error codes. They are part of the API: a code is never renamed, reused or
+// given another status, new codes are only added.
+const (
+	CodeInternal         = "internal"
+	CodeRouteNotFound    = "request.route_not_found"
+	CodeInvalidRequest   = "request.invalid"
+	CodeValidationFailed = "request.validation_failed"
+	CodeInvalidScope     = "request.invalid_scope"
+	CodeInvalidAudience  = "request.invalid_audience"
+	CodeNotFound         = "resource.not_found"
+	CodeConflict         = "resource.conflict"
+
+	CodeTokenMissing       = "auth.token_missing"
+	CodeTokenMalformed     = "auth.token_malformed"
+	CodeTokenExpired       = "auth.token_expired"
+	CodeTokenInvalid       = "auth.token_invalid"
+	CodeTokenRevoked       = "auth.token_revoked"
+	CodeAccountInactive    = "auth.account_inactive"
+	CodeDPoPInvalid        = "auth.dpop_invalid"
+	CodeDPoPRequired       = "auth.dpop_required"
+	CodeCSRFFailed         = "auth.csrf_failed"
+	CodeInsufficientScope  = "auth.insufficient_scope"
+	CodeForbidden          = "auth.forbidden"
+	CodeInvalidCredentials = "auth.invalid_credentials"
+	CodeOAuthStateInvalid  = "auth.oauth_state_invalid"
+	CodeIdentityProvider   = "auth.identity_provider_failed"
+
+	CodeUserNotFound        = "user.not_found"
+	CodeEmailTaken          = "user.email_taken"
+	CodePhoneTaken          = "user.phone_taken"
+	CodeEmailUnchanged      = "user.email_unchanged"
+	CodeUserDeactivated     = "user.deactivated"
+	CodePasswordNotSet      = "user.password_not_set"
+	CodePasswordTooLong     = "user.password_too_long"
+	CodeUserTokenRequired   = "api_key.user_token_required"
+	CodeAPIKeyNotFound      = "api_key.not_found"
+	CodeAPIKeyLimitReached  = "api_key.limit_reached"
+	CodeAPIKeyScopeExceeded = "api_key.scope_exceeded"
+
+	CodeServiceAccountNotFound = "service_account.not_found"
+	CodeScopeNotAllowed        = "service_account.scope_not_allowed"
+	CodeInvalidPublicKey       = "service_account.invalid_public_key"
+
+	CodeWebhookNotFound         = "webhook.not_found"
+	CodeWebhookInvalidURL       = "webhook.invalid_url"
+	CodeWebhookUnknownEvent     = "webhook.unknown_event"
+	CodeDeliveryNotFound        = "webhook.delivery_not_found"
+	CodeWebhookSubscriptionGone = "webhook.subscription_deleted"
+)
+
+// Definition documents an error code.
+type Definition struct {
+	Code   string `json:"code"`
+	Status int    `json:"status"`
+	Title  string `json:"title"`
+}
+
+// Codes lists every error code with its status and title.
+var Codes = []Definition{
+	{CodeInternal, http.StatusInternalServerError, "Internal server error"},
+	{CodeRouteNotFound, http.StatusNotFound, "No route matches the request"},
+	{CodeInvalidRequest, http.StatusBadRequest, "Request is invalid"},
+	{CodeValidationFailed, http.StatusBadRequest, "Request failed validation"},
+	{CodeInvalidScope, http.StatusBadRequest, "Scope is invalid"},
+	{CodeInvalidAudience, http.StatusBadRequest, "Audience is unknown"},
+	{CodeNotFound, http.StatusNotFound, "Resource not found"},
+	{CodeConflict, http.StatusConflict, "Resource already exists"},
+
+	{CodeTokenMissing, http.StatusUnauthorized, "Authentication is required"},
+	{CodeTokenMalformed, http.StatusBadRequest, "Token is malformed"},
+	{CodeTokenExpired, http.StatusUnauthorized, "Token has expired"},
+	{CodeTokenInvalid, http.StatusUnauthorized, "Token is invalid"},
+	{CodeTokenRevoked, http.StatusUnauthorized, "Token has been revoked"},
+	{CodeAccountInactive, http.StatusUnauthorized, "Account of the credential is not active"},
+	{CodeDPoPInvalid, http.StatusUnauthorized, "DPoP proof is invalid"},
+	{CodeDPoPRequired, http.StatusBadRequest, "DPoP proof is required"},
+	{CodeCSRFFailed, http.StatusForbidden, "Missing or invalid CSRF token"},
+	{CodeInsufficientScope, http.StatusForbidden, "Token lacks the required scope"},
+	{CodeForbidden, http.StatusForbidden, "Not allowed to access this resource"},
+	{CodeInvalidCredentials, http.StatusUnauthorized, "Credentials are incorrect"},
+	{CodeOAuthStateInvalid, http.StatusBadRequest, "OAuth state is invalid"},
+	{CodeIdentityProvider, http.StatusBadGateway, "Identity provider request failed"},
+
+	{CodeUserNotFound, http.StatusNotFound, "User not found"},
+	{CodeEmailTaken, http.StatusConflict, "Email already exists"},
+	{CodePhoneTaken, http.StatusConflict, "Phone already exists"},
+	{CodeEmailUnchanged, http.StatusBadRequest, "Email is unchanged"},
+	{CodeUserDeactivated, http.StatusForbidden, "Account is deactivated"},
+	{CodePasswordNotSet, http.StatusBadRequest, "Account has no password"},
+	{CodePasswordTooLong, http.StatusBadRequest, "Password is too long"},
+	{CodeUserTokenRequired, http.StatusForbidden, "API keys can only be created with a user's own access token"},
+	{CodeAPIKeyNotFound, http.StatusNotFound, "API key not found"},
+	{CodeAPIKeyLimitReached, http.StatusConflict, "Maximum number of API keys reached"},
+	{CodeAPIKeyScopeExceeded, http.StatusBadRequest, "API keys cannot have scopes the current token lacks"},
+
+	{CodeServiceAccountNotFound, http.StatusNotFound, "Service account not found"},
+	{CodeScopeNotAllowed, http.StatusBadRequest, "Scope cannot be given to a service account"},
+	{CodeInvalidPublicKey, http.StatusBadRequest, "Public key is invalid"},
+
+	{CodeWebhookNotFound, http.StatusNotFound, "Webhook not found"},
+	{CodeWebhookInvalidURL, http.StatusBadRequest, "Webhook URL is invalid"},
+	{CodeWebhookUnknownEvent, http.StatusBadRequest, "Event type is unknown"},
+	{CodeDeliveryNotFound, http.StatusNotFound, "Delivery not found"},
+	{CodeWebhookSubscriptionGone, http.StatusConflict, "Webhook of the delivery was deleted"},
+}
+
+var definitions = map[string]Definition{}
+
+func init() {
+	for _, definition := range Codes {
+		definitions[definition.Code] = definition
+	}
+}
+
+// Lookup returns the definition of code.
+func Lookup(code string) (Definition, bool) {
+	definition, ok := definitions[code]
+	return definition, ok
+}
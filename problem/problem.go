@@ -0,0 +1,265 @@
+// Package problem reports errors as RFC 7807 problem details.
+//
+// Every problem carries a stable code, such as auth.token_expired, that
+// clients can rely on instead of the human readable title and detail. The
+// codes and their statuses are listed in Codes and served under /problems,
+// which is also what the type of each problem points to.
+//
+// Handlers report every error through Write. It maps the errors of the
+// service's packages to their code, translates validation errors into
+// per-field details and turns anything it does not know into an internal
+// error, so messages of the database or other dependencies never reach
+// clients. The OAuth token and device endpoints are the exception, RFC 6749
+// and RFC 8628 prescribe their error format.
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/arunprasad2002/go-jwt/helpers"
+	"github.com/arunprasad2002/go-jwt/logging"
+	"github.com/arunprasad2002/go-jwt/store"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// ContentType is the media type of problem responses.
+const ContentType = "application/problem+json"
+
+// TypePrefix is where the documentation of each code is served, relative to the service.
+const TypePrefix = "/problems/"
+
+// Problem is an RFC 7807 problem, extended with the error code, the ID of
+// the request and the fields that failed validation.
+type Problem struct {
+	Type       string       `json:"type"`
+	Title      string       `json:"title"`
+	Status     int          `json:"status"`
+	Detail     string       `json:"detail,omitempty"`
+	Instance   string       `json:"instance,omitempty"`
+	Code       string       `json:"code"`
+	Request_id string       `json:"request_id,omitempty"`
+	Errors     []FieldError `json:"errors,omitempty"`
+
+	// cause is logged for server errors but never sent
+	cause error
+}
+
+// FieldError says why one field of the request was rejected. Code is the
+// name of the failed rule, such as required or email.
+type FieldError struct {
+	Field  string `json:"field"`
+	Code   string `json:"code"`
+	Detail string `json:"detail"`
+}
+
+// New returns the problem of code. An unknown code is reported as an internal error.
+func New(code string, detail string) *Problem {
+	definition, ok := Lookup(code)
+	if !ok {
+		return &Problem{
+			Type:   TypePrefix + CodeInternal,
+			Title:  "Internal server error",
+			Status: http.StatusInternalServerError,
+			Code:   CodeInternal,
+			cause:  fmt.Errorf("unknown problem code %q: %s", code, detail),
+		}
+	}
+	return &Problem{
+		Type:   TypePrefix + code,
+		Title:  definition.Title,
+		Status: definition.Status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// Wrap returns the problem of code caused by err. The cause is logged when
+// the problem is a server error, clients only see detail.
+func Wrap(err error, code string, detail string) *Problem {
+	p := New(code, detail)
+	if p.cause == nil {
+		p.cause = err
+	}
+	return p
+}
+
+// Invalid returns a validation problem for one field that broke rule.
+func Invalid(field string, rule string, detail string) *Problem {
+	p := New(CodeValidationFailed, field+" "+detail)
+	p.Errors = []FieldError{{Field: field, Code: rule, Detail: detail}}
+	return p
+}
+
+// Body returns the problem of a request body that could not be decoded or
+// failed validation.
+func Body(err error) *Problem {
+	var validationErrs validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &validationErrs):
+		return validation(validationErrs)
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		return Invalid(typeErr.Field, "type", "must be a "+jsonType(typeErr.Type))
+	case errors.Is(err, io.EOF):
+		return Wrap(err, CodeInvalidRequest, "request body is empty")
+	default:
+		return Wrap(err, CodeInvalidRequest, "request body is not valid JSON")
+	}
+}
+
+func (p *Problem) Error() string {
+	if p.Detail == "" {
+		return p.Code
+	}
+	return p.Code + ": " + p.Detail
+}
+
+func (p *Problem) Unwrap() error {
+	return p.cause
+}
+
+// codes maps the errors of other packages to their code, the first match wins
+var codes = []struct {
+	err  error
+	code string
+}{
+	{store.ErrNotFound, CodeNotFound},
+	{store.ErrConflict, CodeConflict},
+	{helpers.ErrForbidden, CodeForbidden},
+	{helpers.ErrTokenMalformed, CodeTokenMalformed},
+	{helpers.ErrTokenExpired, CodeTokenExpired},
+	{helpers.ErrAPIKeyExpired, CodeTokenExpired},
+	{helpers.ErrTokenSignatureInvalid, CodeTokenInvalid},
+	{helpers.ErrTokenNotValidYet, CodeTokenInvalid},
+	{helpers.ErrTokenInvalidIssuer, CodeTokenInvalid},
+	{helpers.ErrTokenInvalidAudience, CodeTokenInvalid},
+	{helpers.ErrCertificateMismatch, CodeTokenInvalid},
+	{helpers.ErrInvalidAPIKey, CodeTokenInvalid},
+	{helpers.ErrSessionRevoked, CodeTokenRevoked},
+	{helpers.ErrAPIKeyRevoked, CodeTokenRevoked},
+	{helpers.ErrAccountDeactivated, CodeAccountInactive},
+	{helpers.ErrAccountPendingDeletion, CodeAccountInactive},
+	{helpers.ErrServiceAccountDisabled, CodeAccountInactive},
+	{helpers.ErrInvalidDPoPProof, CodeDPoPInvalid},
+	{helpers.ErrDPoPKeyMismatch, CodeDPoPInvalid},
+	{helpers.ErrDPoPRequired, CodeDPoPRequired},
+	{helpers.ErrInvalidScope, CodeInvalidScope},
+	{helpers.ErrUnknownAudience, CodeInvalidAudience},
+	{helpers.ErrTooManyAPIKeys, CodeAPIKeyLimitReached},
+}
+
+// From returns the problem err stands for. Errors without a code become an
+// internal error whose detail is not shown.
+func From(err error) *Problem {
+	var p *Problem
+	if errors.As(err, &p) {
+		copied := *p
+		return &copied
+	}
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		return validation(validationErrs)
+	}
+	for _, mapping := range codes {
+		if errors.Is(err, mapping.err) {
+			return Wrap(err, mapping.code, err.Error())
+		}
+	}
+	return Wrap(err, CodeInternal, "")
+}
+
+// Token returns the problem of a rejected credential. Errors without a code
+// make the token invalid, a credential that cannot be checked is never accepted.
+func Token(err error) *Problem {
+	p := From(err)
+	if p.Code == CodeInternal {
+		return Wrap(err, CodeTokenInvalid, "token is invalid")
+	}
+	return p
+}
+
+// Write sends err as a problem and aborts the request. Server errors are logged with their cause.
+func Write(c *gin.Context, err error) {
+	p := From(err)
+	if p.Status >= http.StatusInternalServerError && p.cause != nil {
+		logging.FromContext(c).Error("request failed", "code", p.Code, "error", p.cause)
+	}
+	p.Instance = c.Request.URL.Path
+	p.Request_id = c.GetString("request_id")
+	c.Header("Content-Type", ContentType)
+	c.AbortWithStatusJSON(p.Status, p)
+}
+
+// validation translates validator errors into field errors
+func validation(errs validator.ValidationErrors) *Problem {
+	p := New(CodeValidationFailed, "")
+	var details []string
+	for _, fe := range errs {
+		fieldErr := FieldError{Field: fe.Field(), Code: fe.Tag(), Detail: fieldDetail(fe)}
+		p.Errors = append(p.Errors, fieldErr)
+		details = append(details, fieldErr.Field+" "+fieldErr.Detail)
+	}
+	p.Detail = strings.Join(details, ", ")
+	return p
+}
+
+// fieldDetail says in words what rule of the field was broken
+func fieldDetail(fe validator.FieldError) string {
+	// Alternatives such as eq=ADMIN|eq=USER are reported as one tag
+	if strings.Contains(fe.Tag(), "|") {
+		var values []string
+		for _, alternative := range strings.Split(fe.Tag(), "|") {
+			_, value, _ := strings.Cut(alternative, "=")
+			values = append(values, value)
+		}
+		return "must be one of " + strings.Join(values, ", ")
+	}
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "url", "http_url":
+		return "must be a valid URL"
+	case "oneof":
+		return "must be one of " + strings.Join(strings.Fields(fe.Param()), ", ")
+	case "eq":
+		return "must be " + fe.Param()
+	case "min", "max", "len":
+		bound := map[string]string{"min": "at least ", "max": "at most ", "len": "exactly "}[fe.Tag()]
+		switch fe.Kind() {
+		case reflect.String:
+			return "must be " + bound + fe.Param() + " characters long"
+		case reflect.Slice, reflect.Map, reflect.Array:
+			return "must have " + bound + fe.Param() + " items"
+		}
+		return "must be " + bound + fe.Param()
+	}
+	return "is invalid"
+}
+
+// jsonType names a Go type the way a JSON client knows it
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Pointer:
+		return jsonType(t.Elem())
+	}
+	return "object"
+}
@@ -0,0 +1,505 @@
+package routes
+
+import (
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/arunprasad2002/go-jwt/controllers"
+	"github.com/arunprasad2002/go-jwt/health"
+	"github.com/arunprasad2002/go-jwt/helpers"
+	"github.com/arunprasad2002/go-jwt/jwk"
+	"github.com/arunprasad2002/go-jwt/models"
+	"github.com/arunprasad2002/go-jwt/openapi"
+	"github.com/arunprasad2002/go-jwt/problem"
+	"github.com/gin-gonic/gin"
+)
+
+// scopes describes the scopes routes require
+var scopes = map[string]string{
+	helpers.ScopeUsersRead:             "Read other users' profiles",
+	helpers.ScopeAccountRead:           "Read your own account, its API keys and its export",
+	helpers.ScopeAccountWrite:          "Change or delete your own account and its API keys",
+	helpers.ScopeUsersManage:           "Deactivate and reactivate users",
+	helpers.ScopeServiceAccountsManage: "Create and manage service accounts",
+	helpers.ScopeLoggingManage:         "Read and change the log level",
+	helpers.ScopeAuditRead:             "Read and verify the audit log",
+	helpers.ScopeWebhooksManage:        "Manage webhook subscriptions and deliveries",
+	helpers.ScopeTokenExchange:         "Exchange user tokens for delegated ones",
+}
+
+// Bodies that handlers build as gin.H
+type (
+	tokenResponse struct {
+		Access_token      string `json:"access_token"`
+		Token_type        string `json:"token_type"`
+		Expires_in        int    `json:"expires_in"`
+		Scope             string `json:"scope"`
+		Refresh_token     string `json:"refresh_token,omitempty"`
+		Issued_token_type string `json:"issued_token_type,omitempty"`
+	}
+	tokenRequest struct {
+		Grant_type            string `json:"grant_type" validate:"required"`
+		Scope                 string `json:"scope"`
+		Client_id             string `json:"client_id"`
+		Client_secret         string `json:"client_secret"`
+		Client_assertion_type string `json:"client_assertion_type"`
+		Client_assertion      string `json:"client_assertion"`
+		Subject_token         string `json:"subject_token"`
+		Subject_token_type    string `json:"subject_token_type"`
+		Requested_token_type  string `json:"requested_token_type"`
+		Audience              string `json:"audience"`
+		Device_code           string `json:"device_code"`
+	}
+	deviceCodeRequest struct {
+		Client_id string `json:"client_id"`
+		Scope     string `json:"scope"`
+	}
+	deviceCodeResponse struct {
+		Device_code               string `json:"device_code"`
+		User_code                 string `json:"user_code"`
+		Verification_uri          string `json:"verification_uri"`
+		Verification_uri_complete string `json:"verification_uri_complete"`
+		Expires_in                int    `json:"expires_in"`
+		Interval                  int    `json:"interval"`
+	}
+	deviceDecisionRequest struct {
+		User_code  string `json:"user_code" validate:"required"`
+		Action     string `json:"action" validate:"required,oneof=approve deny"`
+		Csrf_token string `json:"csrf_token"`
+		Email      string `json:"email"`
+		Password   string `json:"password"`
+	}
+	loginResponse struct {
+		Message       string              `json:"message"`
+		User          models.UserResponse `json:"user"`
+		Scope         string              `json:"scope"`
+		Token         string              `json:"token,omitempty"`
+		Refresh_token string              `json:"refresh_token,omitempty"`
+		Token_type    string              `json:"token_type,omitempty"`
+	}
+	refreshResponse struct {
+		Scope         string `json:"scope"`
+		Token         string `json:"token,omitempty"`
+		Refresh_token string `json:"refresh_token,omitempty"`
+		Token_type    string `json:"token_type,omitempty"`
+	}
+	messageResponse struct {
+		Message string `json:"message"`
+	}
+)
+
+// API lists every route of the router with the handler of h that serves it,
+// Register registers them and openapi.Build documents them.
+func API(h *controllers.Handler) openapi.API {
+	return openapi.API{
+		Info: openapi.Info{
+			Title:       "go-jwt",
+			Version:     version(),
+			Description: "Authentication service issuing JWT access tokens to users and service accounts. Errors are RFC 7807 problems whose code is listed under /problems.",
+		},
+		Scopes:   scopes,
+		TokenURL: "/oauth/token",
+		Routes: []openapi.Route{
+			// Users
+			{
+				Method: http.MethodPost, Path: "/users/signup", ID: "signUp", Tag: "Users", Public: true,
+				Handler:     h.SignUp(),
+				Summary:     "Create a user account",
+				Description: "No tokens are issued, the user logs in to get them.",
+				Request:     models.SignUpRequest{}, Response: models.UserResponse{},
+				Errors: []string{problem.CodeInvalidRequest, problem.CodeValidationFailed, problem.CodeEmailTaken, problem.CodePhoneTaken, problem.CodePasswordTooLong},
+			},
+			{
+				Method: http.MethodPost, Path: "/users/login", ID: "login", Tag: "Users", Public: true,
+				Handler:     h.Login(),
+				Summary:     "Log in with email and password",
+				Description: "In browser mode the tokens are set as cookies instead of being returned.",
+				Request:     models.LoginRequest{}, Response: loginResponse{},
+				Errors: []string{problem.CodeInvalidRequest, problem.CodeValidationFailed, problem.CodeInvalidCredentials, problem.CodePasswordNotSet,
+					problem.CodeUserDeactivated, problem.CodeAccountInactive, problem.CodeInvalidScope, problem.CodeInvalidAudience},
+			},
+			{
+				Method: http.MethodPost, Path: "/users/refresh", ID: "refreshToken", Tag: "Users", Public: true,
+				Handler:     h.RefreshToken(),
+				Summary:     "Exchange a refresh token for a new token pair",
+				Description: "In browser mode the refresh token is read from its cookie and the new tokens are set as cookies.",
+				Request:     models.RefreshRequest{}, Response: refreshResponse{},
+				Errors: []string{problem.CodeInvalidRequest, problem.CodeValidationFailed, problem.CodeTokenMalformed, problem.CodeTokenExpired,
+					problem.CodeTokenInvalid, problem.CodeTokenRevoked, problem.CodeAccountInactive, problem.CodeCSRFFailed, problem.CodeInvalidScope},
+			},
+			{
+				Method: http.MethodPost, Path: "/users/logout", ID: "logout", Tag: "Users",
+				Handler:  h.Logout(),
+				Summary:  "Clear the auth cookies of browser mode",
+				Response: messageResponse{},
+			},
+			{
+				Method: http.MethodGet, Path: "/users", ID: "listUsers", Tag: "Users", Scopes: []string{helpers.ScopeUsersRead},
+				Handler: h.GetUsers(),
+				Summary: "List users",
+				Query: []openapi.Param{
+					{Name: "recordPerPage", Type: "integer", Description: "Page size, 10 by default"},
+					{Name: "page", Type: "integer", Description: "Page number, starting at 1"},
+					{Name: "startIndex", Type: "integer", Description: "Offset of the first user, overrides page"},
+				},
+				Response: struct {
+					Total_count int                   `json:"total_count"`
+					User_items  []models.UserResponse `json:"user_items"`
+				}{},
+				Errors: []string{problem.CodeForbidden},
+			},
+			{
+				Method: http.MethodGet, Path: "/users/:user_id", ID: "getUser", Tag: "Users", Scopes: []string{helpers.ScopeUsersRead},
+				Handler:     h.GetUser(),
+				Summary:     "Get a user",
+				Description: "Users see the contact details of their own account only, admins see every field.",
+				Response:    models.UserResponse{},
+				Errors:      []string{problem.CodeForbidden, problem.CodeUserNotFound},
+			},
+			{
+				Method: http.MethodPost, Path: "/users/:user_id/deactivate", ID: "deactivateUser", Tag: "Users", Scopes: []string{helpers.ScopeUsersManage},
+				Handler:  h.DeactivateUser(),
+				Summary:  "Deactivate a user and revoke their tokens",
+				Response: models.UserResponse{},
+				Errors:   []string{problem.CodeForbidden, problem.CodeUserNotFound},
+			},
+			{
+				Method: http.MethodPost, Path: "/users/:user_id/reactivate", ID: "reactivateUser", Tag: "Users", Scopes: []string{helpers.ScopeUsersManage},
+				Handler:  h.ReactivateUser(),
+				Summary:  "Reactivate a user",
+				Response: models.UserResponse{},
+				Errors:   []string{problem.CodeForbidden, problem.CodeUserNotFound},
+			},
+			{
+				Method: http.MethodPut, Path: "/users/:user_id/user-type", ID: "setUserType", Tag: "Users", Scopes: []string{helpers.ScopeUsersManage},
+				Handler:     h.SetUserType(),
+				Summary:     "Make a user an admin or a regular user",
+				Description: "The user's tokens are revoked, they get the scopes of their new type when they log in again.",
+				Request:     models.SetUserTypeRequest{}, Response: models.UserResponse{},
+				Errors: []string{problem.CodeInvalidRequest, problem.CodeValidationFailed, problem.CodeForbidden, problem.CodeUserNotFound},
+			},
+
+			// Account
+			{
+				Method: http.MethodDelete, Path: "/users/me", ID: "deleteAccount", Tag: "Account", Scopes: []string{helpers.ScopeAccountWrite},
+				Handler:     h.DeleteAccount(),
+				Summary:     "Schedule your account for deletion",
+				Description: "The account is deleted once the grace period is over, logging in again before then cancels the deletion.",
+				Response: struct {
+					Message      string    `json:"message"`
+					Delete_after time.Time `json:"delete_after"`
+				}{},
+			},
+			{
+				Method: http.MethodPut, Path: "/users/me/email", ID: "changeEmail", Tag: "Account", Scopes: []string{helpers.ScopeAccountWrite},
+				Handler:     h.ChangeEmail(),
+				Summary:     "Change your email address",
+				Description: "Every session is revoked, so the user has to log in again with the new address.",
+				Request:     models.ChangeEmailRequest{}, Response: models.UserResponse{},
+				Errors: []string{problem.CodeInvalidRequest, problem.CodeValidationFailed, problem.CodeInvalidCredentials, problem.CodePasswordNotSet,
+					problem.CodeEmailUnchanged, problem.CodeEmailTaken},
+			},
+			{
+				Method: http.MethodGet, Path: "/users/me/export", ID: "exportAccount", Tag: "Account", Scopes: []string{helpers.ScopeAccountRead},
+				Handler: h.ExportAccount(),
+				Summary: "Export everything stored about your account",
+				Query: []openapi.Param{
+					{Name: "format", Description: "zip for an archive instead of JSON"},
+				},
+				Response: controllers.AccountExport{}, Downloads: []string{"application/zip"},
+				Errors: []string{problem.CodeUserNotFound},
+			},
+			{
+				Method: http.MethodGet, Path: "/users/me/api-keys", ID: "listAPIKeys", Tag: "Account", Scopes: []string{helpers.ScopeAccountRead},
+				Handler: h.ListAPIKeys(),
+				Summary: "List your API keys",
+				Response: struct {
+					API_keys []models.APIKey `json:"api_keys"`
+				}{},
+			},
+			{
+				Method: http.MethodPost, Path: "/users/me/api-keys", ID: "createAPIKey", Tag: "Account", Scopes: []string{helpers.ScopeAccountWrite},
+				Handler:     h.CreateAPIKey(),
+				Summary:     "Create an API key",
+				Description: "The key is only shown in this response.",
+				Request:     models.APIKeyRequest{}, Status: http.StatusCreated,
+				Response: struct {
+					API_key models.APIKey `json:"api_key"`
+					Key     string        `json:"key"`
+				}{},
+				Errors: []string{problem.CodeInvalidRequest, problem.CodeValidationFailed, problem.CodeUserTokenRequired,
+					problem.CodeAPIKeyScopeExceeded, problem.CodeAPIKeyLimitReached, problem.CodeInvalidScope},
+			},
+			{
+				Method: http.MethodDelete, Path: "/users/me/api-keys/:key_id", ID: "revokeAPIKey", Tag: "Account", Scopes: []string{helpers.ScopeAccountWrite},
+				Handler:  h.RevokeAPIKey(),
+				Summary:  "Revoke an API key",
+				Response: messageResponse{},
+				Errors:   []string{problem.CodeAPIKeyNotFound},
+			},
+
+			// OAuth
+			{
+				Method: http.MethodPost, Path: "/oauth/token", ID: "token", Tag: "OAuth", Public: true,
+				Handler: h.Token(),
+				Summary: "Issue an access token",
+				Description: "Supports the client_credentials, urn:ietf:params:oauth:grant-type:token-exchange and urn:ietf:params:oauth:grant-type:device_code grants. " +
+					"Clients authenticate with HTTP Basic, client_id and client_secret, a private_key_jwt assertion or a TLS client certificate.",
+				Request: tokenRequest{}, RequestType: openapi.Form, Response: tokenResponse{},
+				OAuthErrors: true,
+			},
+			{
+				Method: http.MethodPost, Path: "/oauth/device/code", ID: "deviceAuthorization", Tag: "OAuth", Public: true,
+				Handler: h.DeviceAuthorization(),
+				Summary: "Start a device authorization grant",
+				Request: deviceCodeRequest{}, RequestType: openapi.Form, Response: deviceCodeResponse{},
+				OAuthErrors: true,
+			},
+			{
+				Method: http.MethodGet, Path: "/device", ID: "devicePage", Tag: "OAuth", Public: true,
+				Handler: h.DevicePage(),
+				Summary: "Page where users enter the code shown by their device",
+				Query: []openapi.Param{
+					{Name: "user_code", Description: "Code to fill in"},
+				},
+				ResponseType: openapi.HTML,
+			},
+			{
+				Method: http.MethodPost, Path: "/device", ID: "deviceDecision", Tag: "OAuth", Public: true,
+				Handler:     h.DeviceDecision(),
+				Summary:     "Approve or deny a device",
+				Description: "Users that are not logged in in browser mode log in with email and password on the same form.",
+				Request:     deviceDecisionRequest{}, RequestType: openapi.Form, ResponseType: openapi.HTML,
+			},
+			{
+				Method: http.MethodGet, Path: "/auth/google/login", ID: "googleLogin", Tag: "OAuth", Public: true,
+				Handler: h.GoogleLogin,
+				Summary: "Log in with Google", Status: http.StatusFound,
+			},
+			{
+				Method: http.MethodGet, Path: "/auth/google/callback", ID: "googleCallback", Tag: "OAuth", Public: true,
+				Handler: h.GoogleCallback,
+				Summary: "Finish Google login and send the user to the frontend with their tokens", Status: http.StatusFound,
+				Query: []openapi.Param{
+					{Name: "state", Required: true},
+					{Name: "code", Required: true, Description: "Authorization code issued by Google"},
+				},
+				Errors: []string{problem.CodeOAuthStateInvalid, problem.CodeIdentityProvider, problem.CodeUserDeactivated},
+			},
+			{
+				Method: http.MethodGet, Path: "/.well-known/jwks.json", ID: "jwks", Tag: "OAuth", Public: true,
+				Handler:  h.JWKS(),
+				Summary:  "Public keys that verify the service's tokens",
+				Response: jwk.Set{},
+			},
+
+			// Service accounts
+			{
+				Method: http.MethodGet, Path: "/service-accounts", ID: "listServiceAccounts", Tag: "Service accounts",
+				Handler: h.ListServiceAccounts(),
+				Scopes:  []string{helpers.ScopeServiceAccountsManage},
+				Summary: "List service accounts",
+				Response: struct {
+					Service_accounts []models.ServiceAccount `json:"service_accounts"`
+				}{},
+				Errors: []string{problem.CodeForbidden},
+			},
+			{
+				Method: http.MethodPost, Path: "/service-accounts", ID: "createServiceAccount", Tag: "Service accounts",
+				Handler:     h.CreateServiceAccount(),
+				Scopes:      []string{helpers.ScopeServiceAccountsManage},
+				Summary:     "Create a service account",
+				Description: "The client secret is only shown in this response.",
+				Request:     models.ServiceAccountRequest{}, Status: http.StatusCreated,
+				Response: struct {
+					Service_account models.ServiceAccount `json:"service_account"`
+					Client_secret   string                `json:"client_secret"`
+				}{},
+				Errors: []string{problem.CodeInvalidRequest, problem.CodeValidationFailed, problem.CodeForbidden,
+					problem.CodeScopeNotAllowed, problem.CodeInvalidPublicKey},
+			},
+			{
+				Method: http.MethodPost, Path: "/service-accounts/:client_id/rotate-secret", ID: "rotateServiceAccountSecret", Tag: "Service accounts",
+				Handler: h.RotateServiceAccountSecret(),
+				Scopes:  []string{helpers.ScopeServiceAccountsManage},
+				Summary: "Replace the client secret of a service account",
+				Response: struct {
+					Service_account models.ServiceAccount `json:"service_account"`
+					Client_secret   string                `json:"client_secret"`
+				}{},
+				Errors: []string{problem.CodeForbidden, problem.CodeServiceAccountNotFound},
+			},
+			{
+				Method: http.MethodPost, Path: "/service-accounts/:client_id/disable", ID: "disableServiceAccount", Tag: "Service accounts",
+				Handler: h.DisableServiceAccount(),
+				Scopes:  []string{helpers.ScopeServiceAccountsManage},
+				Summary: "Disable a service account",
+				Response: struct {
+					Service_account models.ServiceAccount `json:"service_account"`
+				}{},
+				Errors: []string{problem.CodeForbidden, problem.CodeServiceAccountNotFound},
+			},
+
+			// Admin
+			{
+				Method: http.MethodGet, Path: "/admin/log-level", ID: "getLogLevel", Tag: "Admin", Scopes: []string{helpers.ScopeLoggingManage},
+				Handler:  h.GetLogLevel(),
+				Summary:  "Get the log level",
+				Response: models.LogLevelRequest{},
+				Errors:   []string{problem.CodeForbidden},
+			},
+			{
+				Method: http.MethodPut, Path: "/admin/log-level", ID: "setLogLevel", Tag: "Admin", Scopes: []string{helpers.ScopeLoggingManage},
+				Handler:     h.SetLogLevel(),
+				Summary:     "Change the log level",
+				Description: "The change lasts until the service restarts.",
+				Request:     models.LogLevelRequest{}, Response: models.LogLevelRequest{},
+				Errors: []string{problem.CodeInvalidRequest, problem.CodeValidationFailed, problem.CodeForbidden},
+			},
+			{
+				Method: http.MethodGet, Path: "/admin/audit-events", ID: "listAuditEvents", Tag: "Admin", Scopes: []string{helpers.ScopeAuditRead},
+				Handler: h.ListAuditEvents(),
+				Summary: "List audit events",
+				Query: []openapi.Param{
+					{Name: "actor_id"},
+					{Name: "target_id"},
+					{Name: "user_id", Description: "Events where the user is the actor or the target"},
+					{Name: "action"},
+					{Name: "outcome", Description: "SUCCESS or FAILURE"},
+					{Name: "since", Description: "RFC 3339 time"},
+					{Name: "until", Description: "RFC 3339 time"},
+					{Name: "after", Type: "integer", Description: "Sequence of the last event of the previous page"},
+					{Name: "limit", Type: "integer"},
+				},
+				Response: struct {
+					Events     []models.AuditEvent `json:"events"`
+					Next_after int64               `json:"next_after,omitempty"`
+				}{},
+				Errors: []string{problem.CodeValidationFailed, problem.CodeForbidden},
+			},
+			{
+				Method: http.MethodGet, Path: "/admin/audit-events/verify", ID: "verifyAuditLog", Tag: "Admin", Scopes: []string{helpers.ScopeAuditRead},
+				Handler: h.VerifyAuditLog(),
+				Summary: "Verify the hash chain of the audit log",
+				Response: struct {
+					Valid   bool   `json:"valid"`
+					Checked int    `json:"checked"`
+					Error   string `json:"error,omitempty"`
+				}{},
+				Errors: []string{problem.CodeForbidden},
+			},
+
+			// Webhooks
+			{
+				Method: http.MethodGet, Path: "/admin/webhooks", ID: "listWebhooks", Tag: "Webhooks", Scopes: []string{helpers.ScopeWebhooksManage},
+				Handler: h.ListWebhooks(),
+				Summary: "List webhook subscriptions and the event types they can subscribe to",
+				Response: struct {
+					Webhooks    []models.WebhookSubscription `json:"webhooks"`
+					Event_types []string                     `json:"event_types"`
+				}{},
+				Errors: []string{problem.CodeForbidden},
+			},
+			{
+				Method: http.MethodPost, Path: "/admin/webhooks", ID: "createWebhook", Tag: "Webhooks", Scopes: []string{helpers.ScopeWebhooksManage},
+				Handler:     h.CreateWebhook(),
+				Summary:     "Subscribe an endpoint to events",
+				Description: "The secret that signs the payloads is only shown in this response.",
+				Request:     models.WebhookSubscriptionRequest{}, Status: http.StatusCreated,
+				Response: struct {
+					Webhook models.WebhookSubscription `json:"webhook"`
+					Secret  string                     `json:"secret"`
+				}{},
+				Errors: []string{problem.CodeInvalidRequest, problem.CodeValidationFailed, problem.CodeForbidden,
+					problem.CodeWebhookInvalidURL, problem.CodeWebhookUnknownEvent},
+			},
+			{
+				Method: http.MethodDelete, Path: "/admin/webhooks/:subscription_id", ID: "deleteWebhook", Tag: "Webhooks", Scopes: []string{helpers.ScopeWebhooksManage},
+				Handler:  h.DeleteWebhook(),
+				Summary:  "Delete a webhook subscription",
+				Response: messageResponse{},
+				Errors:   []string{problem.CodeForbidden, problem.CodeWebhookNotFound},
+			},
+			{
+				Method: http.MethodGet, Path: "/admin/webhook-deliveries", ID: "listWebhookDeliveries", Tag: "Webhooks", Scopes: []string{helpers.ScopeWebhooksManage},
+				Handler: h.ListWebhookDeliveries(),
+				Summary: "List webhook deliveries",
+				Query: []openapi.Param{
+					{Name: "status", Description: "PENDING, DELIVERED or DEAD"},
+					{Name: "subscription_id"},
+					{Name: "limit", Type: "integer"},
+				},
+				Response: struct {
+					Deliveries []models.WebhookDelivery `json:"deliveries"`
+				}{},
+				Errors: []string{problem.CodeValidationFailed, problem.CodeForbidden},
+			},
+			{
+				Method: http.MethodPost, Path: "/admin/webhook-deliveries/:delivery_id/redeliver", ID: "redeliverWebhook", Tag: "Webhooks",
+				Handler: h.RedeliverWebhook(),
+				Scopes:  []string{helpers.ScopeWebhooksManage},
+				Summary: "Send a delivery again", Status: http.StatusAccepted,
+				Response: struct {
+					Delivery models.WebhookDelivery `json:"delivery"`
+				}{},
+				Errors: []string{problem.CodeForbidden, problem.CodeDeliveryNotFound, problem.CodeWebhookSubscriptionGone},
+			},
+
+			// Operations
+			{
+				Method: http.MethodGet, Path: "/healthz", ID: "healthz", Tag: "Operations", Public: true,
+				Handler: h.Healthz(),
+				Summary: "Liveness probe",
+				Response: struct {
+					Status string `json:"status"`
+				}{},
+			},
+			{
+				Method: http.MethodGet, Path: "/readyz", ID: "readyz", Tag: "Operations", Public: true,
+				Handler:     h.Readyz(),
+				Summary:     "Readiness probe",
+				Description: "Answers 503 with the same body when a check fails or the service is shutting down.",
+				Response:    health.Report{},
+			},
+			{
+				Method: http.MethodGet, Path: "/metrics", ID: "metrics", Tag: "Operations", Public: true,
+				Handler: gin.WrapH(h.Metrics.Handler()),
+				Summary: "Prometheus metrics", ResponseType: openapi.Text,
+			},
+			{
+				Method: http.MethodGet, Path: "/problems", ID: "listProblems", Tag: "Operations", Public: true,
+				Handler: h.Problems(),
+				Summary: "List the error codes of problem responses",
+				Response: struct {
+					Problems []problem.Definition `json:"problems"`
+				}{},
+			},
+			{
+				Method: http.MethodGet, Path: "/problems/:code", ID: "getProblem", Tag: "Operations", Public: true,
+				Handler:  h.ProblemType(),
+				Summary:  "Describe an error code",
+				Response: problem.Definition{},
+				Errors:   []string{problem.CodeNotFound},
+			},
+			{
+				Method: http.MethodGet, Path: "/openapi.json", ID: "openAPI", Tag: "Operations", Public: true,
+				Handler: h.OpenAPI(),
+				Summary: "This document",
+			},
+			{
+				Method: http.MethodGet, Path: "/docs", ID: "docs", Tag: "Operations", Public: true,
+				Handler: h.Docs(),
+				Summary: "Interactive documentation of the API", ResponseType: openapi.HTML,
+			},
+		},
+	}
+}
+
+// version is the module version the binary was built from
+func version() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "dev"
+}
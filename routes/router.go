@@ -0,0 +1,26 @@
+package routes
+
+import (
+	"github.com/arunprasad2002/go-jwt/controllers"
+	"github.com/arunprasad2002/go-jwt/middleware"
+	"github.com/arunprasad2002/go-jwt/openapi"
+	"github.com/gin-gonic/gin"
+)
+
+// Register registers the routes of api on router. Routes that are not public
+// need a token with the scopes they document. Authenticate only runs for them,
+// so requests for unknown routes get a 404 rather than a 401.
+func Register(router *gin.Engine, h *controllers.Handler, api openapi.API) {
+	authorized := router.Group("/", middleware.Authenticate(h.Tokens, h.Accounts, h.Cookies, h.Metrics))
+	for _, route := range api.Routes {
+		if route.Public {
+			router.Handle(route.Method, route.Path, route.Handler)
+			continue
+		}
+		var handlers []gin.HandlerFunc
+		if len(route.Scopes) > 0 {
+			handlers = append(handlers, middleware.RequireScopes(route.Scopes...))
+		}
+		authorized.Handle(route.Method, route.Path, append(handlers, route.Handler)...)
+	}
+}
@@ -0,0 +1,778 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/arunprasad2002/go-jwt/jwk"
+	"github.com/arunprasad2002/go-jwt/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// NewMemoryStore returns a store that keeps everything in process memory.
+// It is meant for tests and local development.
+func NewMemoryStore() *Store {
+	return &Store{
+		Users:                &memoryUsers{users: map[string]models.User{}},
+		Sessions:             &memorySessions{sessions: map[string][]models.Session{}},
+		ServiceAccounts:      &memoryServiceAccounts{accounts: map[string]models.ServiceAccount{}},
+		APIKeys:              &memoryAPIKeys{keys: map[string]models.APIKey{}},
+		DeviceAuthorizations: &memoryDeviceAuthorizations{auths: map[string]models.DeviceAuthorization{}},
+		AuditEvents:          &memoryAuditEvents{},
+		WebhookSubscriptions: &memoryWebhookSubscriptions{subscriptions: map[string]models.WebhookSubscription{}},
+		WebhookEvents:        &memoryWebhookEvents{},
+		WebhookDeliveries:    &memoryWebhookDeliveries{deliveries: map[string]models.WebhookDelivery{}},
+	}
+}
+
+type memoryUsers struct {
+	mu    sync.RWMutex
+	users map[string]models.User
+}
+
+func (m *memoryUsers) Create(ctx context.Context, user *models.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	if user.User_id == nil {
+		userId := user.ID.Hex()
+		user.User_id = &userId
+	}
+	m.users[*user.User_id] = copyUser(*user)
+	return nil
+}
+
+func (m *memoryUsers) Update(ctx context.Context, user *models.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if user.User_id == nil {
+		return ErrNotFound
+	}
+	if _, ok := m.users[*user.User_id]; !ok {
+		return ErrNotFound
+	}
+	m.users[*user.User_id] = copyUser(*user)
+	return nil
+}
+
+func (m *memoryUsers) Delete(ctx context.Context, userId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[userId]; !ok {
+		return ErrNotFound
+	}
+	delete(m.users, userId)
+	return nil
+}
+
+func (m *memoryUsers) DeletePendingDeletion(ctx context.Context, userId string, before time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userId]
+	if !ok || models.UserStatus(user) != models.StatusPendingDeletion || user.Delete_after == nil || user.Delete_after.After(before) {
+		return ErrNotFound
+	}
+	delete(m.users, userId)
+	return nil
+}
+
+func (m *memoryUsers) GetByID(ctx context.Context, userId string) (*models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[userId]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	found := copyUser(user)
+	return &found, nil
+}
+
+func (m *memoryUsers) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, user := range m.users {
+		if user.Email != nil && *user.Email == email {
+			found := copyUser(user)
+			return &found, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *memoryUsers) EmailExists(ctx context.Context, email string) (bool, error) {
+	_, err := m.GetByEmail(ctx, email)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (m *memoryUsers) PhoneExists(ctx context.Context, phone string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, user := range m.users {
+		if user.Phone != nil && *user.Phone == phone {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *memoryUsers) List(ctx context.Context, offset int, limit int) ([]models.User, int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	all := make([]models.User, 0, len(m.users))
+	for _, user := range m.users {
+		all = append(all, copyUser(user))
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Created_at.Equal(all[j].Created_at) {
+			return *all[i].User_id < *all[j].User_id
+		}
+		return all[i].Created_at.Before(all[j].Created_at)
+	})
+
+	if offset > len(all) {
+		offset = len(all)
+	}
+	end := offset + limit
+	if end > len(all) {
+		end = len(all)
+	}
+	return all[offset:end], len(all), nil
+}
+
+func (m *memoryUsers) UpdateTokens(ctx context.Context, userId string, token string, refreshToken string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userId]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Token = &token
+	user.Refresh_token = &refreshToken
+	user.Updated_at = time.Now()
+	m.users[userId] = user
+	return nil
+}
+
+func (m *memoryUsers) ListPendingDeletion(ctx context.Context, before time.Time) ([]models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	users := []models.User{}
+	for _, user := range m.users {
+		if models.UserStatus(user) == models.StatusPendingDeletion && user.Delete_after != nil && !user.Delete_after.After(before) {
+			users = append(users, copyUser(user))
+		}
+	}
+	return users, nil
+}
+
+// copyUser detaches the identities slice so callers cannot mutate stored users.
+func copyUser(user models.User) models.User {
+	if user.Identities != nil {
+		user.Identities = append([]models.Identity(nil), user.Identities...)
+	}
+	return user
+}
+
+type memorySessions struct {
+	mu       sync.RWMutex
+	sessions map[string][]models.Session
+}
+
+func (m *memorySessions) Create(ctx context.Context, session *models.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sessions[session.User_id] = append(m.sessions[session.User_id], *session)
+	return nil
+}
+
+func (m *memorySessions) Get(ctx context.Context, sessionId string) (*models.Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if session := m.find(sessionId); session != nil {
+		found := *session
+		found.Scopes = append([]string(nil), session.Scopes...)
+		return &found, nil
+	}
+	return nil, ErrNotFound
+}
+
+// find returns the stored session, callers hold the lock
+func (m *memorySessions) find(sessionId string) *models.Session {
+	for userId := range m.sessions {
+		for i := range m.sessions[userId] {
+			if m.sessions[userId][i].Session_id == sessionId {
+				return &m.sessions[userId][i]
+			}
+		}
+	}
+	return nil
+}
+
+func (m *memorySessions) ListByUser(ctx context.Context, userId string) ([]models.Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return append([]models.Session{}, m.sessions[userId]...), nil
+}
+
+func (m *memorySessions) RevokeByUser(ctx context.Context, userId string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.sessions[userId] {
+		if m.sessions[userId][i].Revoked_at == nil {
+			revokedAt := at
+			m.sessions[userId][i].Revoked_at = &revokedAt
+		}
+	}
+	return nil
+}
+
+func (m *memorySessions) Rotate(ctx context.Context, sessionId string, refreshId string, nextRefreshId string, scopes []string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session := m.find(sessionId)
+	if session == nil || session.Revoked_at != nil || session.Refresh_id != refreshId {
+		return ErrNotFound
+	}
+	session.Refresh_id = nextRefreshId
+	session.Scopes = append([]string(nil), scopes...)
+	session.Expires_at = expiresAt
+	return nil
+}
+
+func (m *memorySessions) Revoke(ctx context.Context, sessionId string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if session := m.find(sessionId); session != nil && session.Revoked_at == nil {
+		revokedAt := at
+		session.Revoked_at = &revokedAt
+	}
+	return nil
+}
+
+func (m *memorySessions) DeleteByUser(ctx context.Context, userId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, userId)
+	return nil
+}
+
+type memoryServiceAccounts struct {
+	mu       sync.RWMutex
+	accounts map[string]models.ServiceAccount
+}
+
+func (m *memoryServiceAccounts) Create(ctx context.Context, account *models.ServiceAccount) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.accounts[account.Client_id] = copyServiceAccount(*account)
+	return nil
+}
+
+func (m *memoryServiceAccounts) Update(ctx context.Context, account *models.ServiceAccount) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.accounts[account.Client_id]; !ok {
+		return ErrNotFound
+	}
+	m.accounts[account.Client_id] = copyServiceAccount(*account)
+	return nil
+}
+
+func (m *memoryServiceAccounts) GetByClientID(ctx context.Context, clientId string) (*models.ServiceAccount, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	account, ok := m.accounts[clientId]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	found := copyServiceAccount(account)
+	return &found, nil
+}
+
+func (m *memoryServiceAccounts) List(ctx context.Context) ([]models.ServiceAccount, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	accounts := make([]models.ServiceAccount, 0, len(m.accounts))
+	for _, account := range m.accounts {
+		accounts = append(accounts, copyServiceAccount(account))
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].Created_at.Before(accounts[j].Created_at)
+	})
+	return accounts, nil
+}
+
+// copyServiceAccount detaches the slices of a service account from the stored one.
+func copyServiceAccount(account models.ServiceAccount) models.ServiceAccount {
+	account.Scopes = append([]string(nil), account.Scopes...)
+	if account.Public_keys != nil {
+		account.Public_keys = append([]jwk.Key(nil), account.Public_keys...)
+	}
+	return account
+}
+
+type memoryAPIKeys struct {
+	mu   sync.RWMutex
+	keys map[string]models.APIKey
+}
+
+func (m *memoryAPIKeys) Create(ctx context.Context, key *models.APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.keys {
+		if existing.Prefix == key.Prefix {
+			return ErrConflict
+		}
+	}
+	m.keys[key.Key_id] = copyAPIKey(*key)
+	return nil
+}
+
+func (m *memoryAPIKeys) GetByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, key := range m.keys {
+		if key.Prefix == prefix {
+			found := copyAPIKey(key)
+			return &found, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *memoryAPIKeys) ListByUser(ctx context.Context, userId string) ([]models.APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := []models.APIKey{}
+	for _, key := range m.keys {
+		if key.User_id == userId {
+			keys = append(keys, copyAPIKey(key))
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Created_at.Before(keys[j].Created_at)
+	})
+	return keys, nil
+}
+
+func (m *memoryAPIKeys) Revoke(ctx context.Context, userId string, keyId string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, ok := m.keys[keyId]
+	if !ok || key.User_id != userId {
+		return ErrNotFound
+	}
+	if key.Revoked_at == nil {
+		key.Revoked_at = &at
+		m.keys[keyId] = key
+	}
+	return nil
+}
+
+func (m *memoryAPIKeys) RecordUse(ctx context.Context, keyId string, at time.Time, ip string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, ok := m.keys[keyId]
+	if !ok {
+		return ErrNotFound
+	}
+	key.Last_used_at = &at
+	key.Last_used_ip = ip
+	m.keys[keyId] = key
+	return nil
+}
+
+func (m *memoryAPIKeys) DeleteByUser(ctx context.Context, userId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for keyId, key := range m.keys {
+		if key.User_id == userId {
+			delete(m.keys, keyId)
+		}
+	}
+	return nil
+}
+
+// copyAPIKey detaches the scopes slice of a key from the stored one.
+func copyAPIKey(key models.APIKey) models.APIKey {
+	key.Scopes = append([]string(nil), key.Scopes...)
+	return key
+}
+
+type memoryDeviceAuthorizations struct {
+	mu    sync.RWMutex
+	auths map[string]models.DeviceAuthorization
+}
+
+func (m *memoryDeviceAuthorizations) Create(ctx context.Context, auth *models.DeviceAuthorization) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.auths[auth.Device_code_hash] = *auth
+	return nil
+}
+
+func (m *memoryDeviceAuthorizations) GetByDeviceCode(ctx context.Context, deviceCodeHash string) (*models.DeviceAuthorization, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	auth, ok := m.auths[deviceCodeHash]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &auth, nil
+}
+
+func (m *memoryDeviceAuthorizations) GetByUserCode(ctx context.Context, userCode string) (*models.DeviceAuthorization, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, auth := range m.auths {
+		if auth.User_code == userCode {
+			found := auth
+			return &found, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *memoryDeviceAuthorizations) RecordPoll(ctx context.Context, deviceCodeHash string, at time.Time, interval int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	auth, ok := m.auths[deviceCodeHash]
+	if !ok {
+		return ErrNotFound
+	}
+	auth.Last_polled_at = &at
+	auth.Interval = interval
+	m.auths[deviceCodeHash] = auth
+	return nil
+}
+
+func (m *memoryDeviceAuthorizations) Decide(ctx context.Context, deviceCodeHash string, status string, userId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	auth, ok := m.auths[deviceCodeHash]
+	if !ok || auth.Status != models.DeviceStatusPending {
+		return ErrNotFound
+	}
+	auth.Status = status
+	auth.User_id = userId
+	m.auths[deviceCodeHash] = auth
+	return nil
+}
+
+func (m *memoryDeviceAuthorizations) Delete(ctx context.Context, deviceCodeHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.auths[deviceCodeHash]; !ok {
+		return ErrNotFound
+	}
+	delete(m.auths, deviceCodeHash)
+	return nil
+}
+
+func (m *memoryDeviceAuthorizations) DeleteExpired(ctx context.Context, before time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for hash, auth := range m.auths {
+		if auth.Expires_at.Before(before) {
+			delete(m.auths, hash)
+		}
+	}
+	return nil
+}
+
+type memoryAuditEvents struct {
+	mu     sync.RWMutex
+	events []models.AuditEvent
+}
+
+func (m *memoryAuditEvents) Append(ctx context.Context, event *models.AuditEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if n := len(m.events); n > 0 && m.events[n-1].Sequence >= event.Sequence {
+		return ErrConflict
+	}
+	m.events = append(m.events, copyAuditEvent(*event))
+	return nil
+}
+
+func (m *memoryAuditEvents) Last(ctx context.Context) (*models.AuditEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if len(m.events) == 0 {
+		return nil, ErrNotFound
+	}
+	event := copyAuditEvent(m.events[len(m.events)-1])
+	return &event, nil
+}
+
+func (m *memoryAuditEvents) List(ctx context.Context, query AuditQuery) ([]models.AuditEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	events := []models.AuditEvent{}
+	for _, event := range m.events {
+		if query.Limit > 0 && len(events) == query.Limit {
+			break
+		}
+		if matchesAuditQuery(event, query) {
+			events = append(events, copyAuditEvent(event))
+		}
+	}
+	return events, nil
+}
+
+func matchesAuditQuery(event models.AuditEvent, query AuditQuery) bool {
+	switch {
+	case event.Sequence <= query.After,
+		query.ActorId != "" && event.Actor_id != query.ActorId,
+		query.TargetId != "" && event.Target_id != query.TargetId,
+		query.UserId != "" && event.Actor_id != query.UserId && event.Target_id != query.UserId,
+		query.Action != "" && event.Action != query.Action,
+		query.Outcome != "" && event.Outcome != query.Outcome,
+		!query.Since.IsZero() && event.Time.Before(query.Since),
+		!query.Until.IsZero() && !event.Time.Before(query.Until):
+		return false
+	}
+	return true
+}
+
+// copyAuditEvent detaches the details map of an event from the stored one.
+func copyAuditEvent(event models.AuditEvent) models.AuditEvent {
+	if event.Details != nil {
+		details := make(map[string]string, len(event.Details))
+		for key, value := range event.Details {
+			details[key] = value
+		}
+		event.Details = details
+	}
+	return event
+}
+
+type memoryWebhookSubscriptions struct {
+	mu            sync.RWMutex
+	subscriptions map[string]models.WebhookSubscription
+}
+
+func (m *memoryWebhookSubscriptions) Create(ctx context.Context, subscription *models.WebhookSubscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.subscriptions[subscription.Subscription_id] = copyWebhookSubscription(*subscription)
+	return nil
+}
+
+func (m *memoryWebhookSubscriptions) Get(ctx context.Context, subscriptionId string) (*models.WebhookSubscription, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	subscription, ok := m.subscriptions[subscriptionId]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	subscription = copyWebhookSubscription(subscription)
+	return &subscription, nil
+}
+
+func (m *memoryWebhookSubscriptions) List(ctx context.Context) ([]models.WebhookSubscription, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	subscriptions := []models.WebhookSubscription{}
+	for _, subscription := range m.subscriptions {
+		subscriptions = append(subscriptions, copyWebhookSubscription(subscription))
+	}
+	sort.Slice(subscriptions, func(i, j int) bool {
+		return subscriptions[i].Created_at.Before(subscriptions[j].Created_at)
+	})
+	return subscriptions, nil
+}
+
+func (m *memoryWebhookSubscriptions) Delete(ctx context.Context, subscriptionId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.subscriptions[subscriptionId]; !ok {
+		return ErrNotFound
+	}
+	delete(m.subscriptions, subscriptionId)
+	return nil
+}
+
+// copyWebhookSubscription detaches the events slice of a subscription from the stored one.
+func copyWebhookSubscription(subscription models.WebhookSubscription) models.WebhookSubscription {
+	subscription.Events = append([]string(nil), subscription.Events...)
+	return subscription
+}
+
+type memoryWebhookEvents struct {
+	mu     sync.RWMutex
+	events []models.WebhookEvent
+}
+
+func (m *memoryWebhookEvents) Create(ctx context.Context, event *models.WebhookEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.events = append(m.events, *event)
+	return nil
+}
+
+func (m *memoryWebhookEvents) Get(ctx context.Context, eventId string) (*models.WebhookEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, event := range m.events {
+		if event.Event_id == eventId {
+			return &event, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *memoryWebhookEvents) ListPending(ctx context.Context, limit int) ([]models.WebhookEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	events := []models.WebhookEvent{}
+	for _, event := range m.events {
+		if len(events) == limit {
+			break
+		}
+		if event.Dispatched_at == nil {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (m *memoryWebhookEvents) MarkDispatched(ctx context.Context, eventId string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.events {
+		if m.events[i].Event_id == eventId {
+			m.events[i].Dispatched_at = &at
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+type memoryWebhookDeliveries struct {
+	mu         sync.RWMutex
+	deliveries map[string]models.WebhookDelivery
+}
+
+func (m *memoryWebhookDeliveries) Create(ctx context.Context, delivery *models.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.deliveries[delivery.Delivery_id]; ok {
+		return ErrConflict
+	}
+	m.deliveries[delivery.Delivery_id] = *delivery
+	return nil
+}
+
+func (m *memoryWebhookDeliveries) Get(ctx context.Context, deliveryId string) (*models.WebhookDelivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	delivery, ok := m.deliveries[deliveryId]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &delivery, nil
+}
+
+func (m *memoryWebhookDeliveries) Update(ctx context.Context, delivery *models.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.deliveries[delivery.Delivery_id]; !ok {
+		return ErrNotFound
+	}
+	m.deliveries[delivery.Delivery_id] = *delivery
+	return nil
+}
+
+func (m *memoryWebhookDeliveries) ListDue(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	deliveries := []models.WebhookDelivery{}
+	for _, delivery := range m.deliveries {
+		if delivery.Status == models.WebhookPending && !delivery.Next_attempt_at.After(now) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].Next_attempt_at.Before(deliveries[j].Next_attempt_at)
+	})
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+func (m *memoryWebhookDeliveries) List(ctx context.Context, status string, subscriptionId string, limit int) ([]models.WebhookDelivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	deliveries := []models.WebhookDelivery{}
+	for _, delivery := range m.deliveries {
+		if (status == "" || delivery.Status == status) && (subscriptionId == "" || delivery.Subscription_id == subscriptionId) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].Created_at.After(deliveries[j].Created_at)
+	})
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,165 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/arunprasad2002/go-jwt/models"
+)
+
+func TestMigrate(t *testing.T) {
+	tests := []struct {
+		name string
+		// setup creates the tables the database had before
+		setup []string
+	}{
+		{name: "new database"},
+		{
+			name: "created before client certificates",
+			setup: []string{`CREATE TABLE service_accounts (
+				client_id TEXT PRIMARY KEY,
+				name TEXT NOT NULL,
+				scopes TEXT NOT NULL,
+				secret_hash TEXT,
+				public_keys TEXT,
+				created_by TEXT,
+				created_at TIMESTAMP NOT NULL,
+				updated_at TIMESTAMP NOT NULL,
+				secret_rotated_at TIMESTAMP,
+				disabled_at TIMESTAMP
+			)`},
+		},
+		{
+			name: "created with the column but without migrations",
+			setup: []string{`CREATE TABLE service_accounts (
+				client_id TEXT PRIMARY KEY,
+				name TEXT NOT NULL,
+				scopes TEXT NOT NULL,
+				secret_hash TEXT,
+				public_keys TEXT,
+				tls_client_auth_subject_dn TEXT,
+				created_by TEXT,
+				created_at TIMESTAMP NOT NULL,
+				updated_at TIMESTAMP NOT NULL,
+				secret_rotated_at TIMESTAMP,
+				disabled_at TIMESTAMP
+			)`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			path := filepath.Join(t.TempDir(), "store.db")
+			db, err := sql.Open("sqlite", path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, stmt := range tt.setup {
+				if _, err := db.Exec(stmt); err != nil {
+					t.Fatal(err)
+				}
+			}
+			db.Close()
+
+			// Opening twice must not apply a migration twice
+			for i := 0; i < 2; i++ {
+				st, err := OpenSQLite(ctx, path)
+				if err != nil {
+					t.Fatalf("open %d: %v", i+1, err)
+				}
+				st.Close(ctx)
+			}
+
+			st, err := OpenSQLite(ctx, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer st.Close(ctx)
+			now := time.Now().UTC().Truncate(time.Second)
+			account := &models.ServiceAccount{
+				Client_id:                  "billing",
+				Name:                       "Billing",
+				Scopes:                     []string{"users:read"},
+				Tls_client_auth_subject_dn: "CN=billing",
+				Created_at:                 now,
+				Updated_at:                 now,
+			}
+			if err := st.ServiceAccounts.Create(ctx, account); err != nil {
+				t.Fatal(err)
+			}
+			got, err := st.ServiceAccounts.GetByClientID(ctx, "billing")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Tls_client_auth_subject_dn != "CN=billing" {
+				t.Errorf("subject DN = %q, want CN=billing", got.Tls_client_auth_subject_dn)
+			}
+		})
+	}
+}
+
+func TestMigrateRefusesNewerSchema(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "store.db")
+	st, err := OpenSQLite(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Close(ctx)
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`, len(migrations)+1, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	if st, err := OpenSQLite(ctx, path); err == nil {
+		st.Close(ctx)
+		t.Fatal("opened a database migrated by a newer build")
+	}
+}
+
+func TestMigrateUserTypes(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "store.db")
+	st, err := OpenSQLite(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Close(ctx)
+
+	// A user created by Google login before the type was fixed, in a database not migrated yet
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmts := []string{
+		`INSERT INTO users (user_id, id, email, user_type, created_at, updated_at) VALUES ('u1', 'u1', 'a@example.com', 'user', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`,
+		`DELETE FROM schema_migrations WHERE version >= 5`,
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	st, err = OpenSQLite(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close(ctx)
+	user, err := st.Users.GetByID(ctx, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *user.User_type != models.UserTypeUser {
+		t.Errorf("user type = %q, want %q", *user.User_type, models.UserTypeUser)
+	}
+}
@@ -0,0 +1,703 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/arunprasad2002/go-jwt/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// NewMongoStore returns a store backed by the "user", "session", "service_account", "api_key",
+// "device_authorization", "audit_event", "webhook_subscription", "webhook_event" and
+// "webhook_delivery" collections of dbName.
+func NewMongoStore(client *mongo.Client, dbName string) *Store {
+	db := client.Database(dbName)
+	st := &Store{
+		Users:                &mongoUsers{collection: db.Collection("user")},
+		Sessions:             &mongoSessions{collection: db.Collection("session")},
+		ServiceAccounts:      &mongoServiceAccounts{collection: db.Collection("service_account")},
+		APIKeys:              &mongoAPIKeys{collection: db.Collection("api_key")},
+		DeviceAuthorizations: &mongoDeviceAuthorizations{collection: db.Collection("device_authorization")},
+		AuditEvents:          &mongoAuditEvents{collection: db.Collection("audit_event")},
+		WebhookSubscriptions: &mongoWebhookSubscriptions{collection: db.Collection("webhook_subscription")},
+		WebhookEvents:        &mongoWebhookEvents{collection: db.Collection("webhook_event")},
+		WebhookDeliveries:    &mongoWebhookDeliveries{collection: db.Collection("webhook_delivery")},
+		closer:               client.Disconnect,
+		pinger: func(ctx context.Context) error {
+			return client.Ping(ctx, nil)
+		},
+	}
+	// Operations join the transaction through the session context they are given.
+	// Standalone servers have no transactions, their changes are applied one by one.
+	var (
+		checkTransactions sync.Once
+		hasTransactions   bool
+	)
+	st.transaction = func(ctx context.Context, fn func(ctx context.Context, tx *Store) error) error {
+		checkTransactions.Do(func() {
+			hasTransactions = supportsTransactions(ctx, client)
+		})
+		tx := *st
+		tx.transaction = nil
+		if !hasTransactions {
+			return fn(ctx, &tx)
+		}
+
+		session, err := client.StartSession()
+		if err != nil {
+			return err
+		}
+		defer session.EndSession(ctx)
+
+		_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+			return nil, fn(sc, &tx)
+		})
+		return err
+	}
+	return st
+}
+
+// MigrateMongo fixes documents of dbName stored by earlier versions and
+// creates the indexes the store relies on. Its updates only match documents
+// that need them and creating an existing index does nothing, so it runs on
+// every start.
+func MigrateMongo(ctx context.Context, client *mongo.Client, dbName string) error {
+	db := client.Database(dbName)
+	// Users created by Google login had a lowercase type
+	_, err := db.Collection("user").UpdateMany(ctx,
+		bson.M{"user_type": "user"},
+		bson.M{"$set": bson.M{"user_type": models.UserTypeUser}})
+	if err != nil {
+		return err
+	}
+	// API keys are looked up by prefix, two keys must never share one
+	_, err = db.Collection("api_key").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "prefix", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// supportsTransactions reports whether the server is a replica set member or a mongos
+func supportsTransactions(ctx context.Context, client *mongo.Client) bool {
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+	return err == nil && (hello.SetName != "" || hello.Msg == "isdbgrid")
+}
+
+type mongoUsers struct {
+	collection *mongo.Collection
+}
+
+func (m *mongoUsers) Create(ctx context.Context, user *models.User) error {
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	if user.User_id == nil {
+		userId := user.ID.Hex()
+		user.User_id = &userId
+	}
+	_, err := m.collection.InsertOne(ctx, user)
+	return err
+}
+
+func (m *mongoUsers) Update(ctx context.Context, user *models.User) error {
+	if user.User_id == nil {
+		return ErrNotFound
+	}
+	result, err := m.collection.ReplaceOne(ctx, bson.M{"user_id": *user.User_id}, user)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *mongoUsers) Delete(ctx context.Context, userId string) error {
+	result, err := m.collection.DeleteOne(ctx, bson.M{"user_id": userId})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *mongoUsers) DeletePendingDeletion(ctx context.Context, userId string, before time.Time) error {
+	filter := bson.M{"user_id": userId, "status": models.StatusPendingDeletion, "delete_after": bson.M{"$lte": before}}
+	result, err := m.collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *mongoUsers) GetByID(ctx context.Context, userId string) (*models.User, error) {
+	return m.findOne(ctx, bson.M{"user_id": userId})
+}
+
+func (m *mongoUsers) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	return m.findOne(ctx, bson.M{"email": email})
+}
+
+func (m *mongoUsers) findOne(ctx context.Context, filter bson.M) (*models.User, error) {
+	var user models.User
+	err := m.collection.FindOne(ctx, filter).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (m *mongoUsers) EmailExists(ctx context.Context, email string) (bool, error) {
+	count, err := m.collection.CountDocuments(ctx, bson.M{"email": email})
+	return count > 0, err
+}
+
+func (m *mongoUsers) PhoneExists(ctx context.Context, phone string) (bool, error) {
+	count, err := m.collection.CountDocuments(ctx, bson.M{"phone": phone})
+	return count > 0, err
+}
+
+func (m *mongoUsers) List(ctx context.Context, offset int, limit int) ([]models.User, int, error) {
+	total, err := m.collection.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "user_id", Value: 1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit))
+	cursor, err := m.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	users := []models.User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, 0, err
+	}
+	return users, int(total), nil
+}
+
+func (m *mongoUsers) UpdateTokens(ctx context.Context, userId string, token string, refreshToken string) error {
+	updateObj := bson.D{
+		{Key: "token", Value: token},
+		{Key: "refresh_token", Value: refreshToken},
+		{Key: "updated_at", Value: time.Now()},
+	}
+	result, err := m.collection.UpdateOne(ctx, bson.M{"user_id": userId}, bson.D{{Key: "$set", Value: updateObj}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *mongoUsers) ListPendingDeletion(ctx context.Context, before time.Time) ([]models.User, error) {
+	filter := bson.M{"status": models.StatusPendingDeletion, "delete_after": bson.M{"$lte": before}}
+	cursor, err := m.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	users := []models.User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+type mongoSessions struct {
+	collection *mongo.Collection
+}
+
+func (m *mongoSessions) Create(ctx context.Context, session *models.Session) error {
+	_, err := m.collection.InsertOne(ctx, session)
+	return err
+}
+
+func (m *mongoSessions) Get(ctx context.Context, sessionId string) (*models.Session, error) {
+	var session models.Session
+	err := m.collection.FindOne(ctx, bson.M{"session_id": sessionId}).Decode(&session)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (m *mongoSessions) ListByUser(ctx context.Context, userId string) ([]models.Session, error) {
+	cursor, err := m.collection.Find(ctx, bson.M{"user_id": userId})
+	if err != nil {
+		return nil, err
+	}
+	sessions := []models.Session{}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (m *mongoSessions) RevokeByUser(ctx context.Context, userId string, at time.Time) error {
+	_, err := m.collection.UpdateMany(ctx,
+		bson.M{"user_id": userId, "revoked_at": nil},
+		bson.M{"$set": bson.M{"revoked_at": at}})
+	return err
+}
+
+func (m *mongoSessions) Rotate(ctx context.Context, sessionId string, refreshId string, nextRefreshId string, scopes []string, expiresAt time.Time) error {
+	result, err := m.collection.UpdateOne(ctx,
+		bson.M{"session_id": sessionId, "refresh_id": refreshId, "revoked_at": nil},
+		bson.M{"$set": bson.M{"refresh_id": nextRefreshId, "scopes": scopes, "expires_at": expiresAt}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *mongoSessions) Revoke(ctx context.Context, sessionId string, at time.Time) error {
+	_, err := m.collection.UpdateOne(ctx,
+		bson.M{"session_id": sessionId, "revoked_at": nil},
+		bson.M{"$set": bson.M{"revoked_at": at}})
+	return err
+}
+
+func (m *mongoSessions) DeleteByUser(ctx context.Context, userId string) error {
+	_, err := m.collection.DeleteMany(ctx, bson.M{"user_id": userId})
+	return err
+}
+
+type mongoServiceAccounts struct {
+	collection *mongo.Collection
+}
+
+func (m *mongoServiceAccounts) Create(ctx context.Context, account *models.ServiceAccount) error {
+	_, err := m.collection.InsertOne(ctx, account)
+	return err
+}
+
+func (m *mongoServiceAccounts) Update(ctx context.Context, account *models.ServiceAccount) error {
+	result, err := m.collection.ReplaceOne(ctx, bson.M{"client_id": account.Client_id}, account)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *mongoServiceAccounts) GetByClientID(ctx context.Context, clientId string) (*models.ServiceAccount, error) {
+	var account models.ServiceAccount
+	err := m.collection.FindOne(ctx, bson.M{"client_id": clientId}).Decode(&account)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (m *mongoServiceAccounts) List(ctx context.Context) ([]models.ServiceAccount, error) {
+	cursor, err := m.collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	accounts := []models.ServiceAccount{}
+	if err := cursor.All(ctx, &accounts); err != nil {
+		return nil, err
+	}
+	return accounts, nil
+}
+
+type mongoAPIKeys struct {
+	collection *mongo.Collection
+}
+
+func (m *mongoAPIKeys) Create(ctx context.Context, key *models.APIKey) error {
+	_, err := m.collection.InsertOne(ctx, key)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+func (m *mongoAPIKeys) GetByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	var key models.APIKey
+	err := m.collection.FindOne(ctx, bson.M{"prefix": prefix}).Decode(&key)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (m *mongoAPIKeys) ListByUser(ctx context.Context, userId string) ([]models.APIKey, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := m.collection.Find(ctx, bson.M{"user_id": userId}, opts)
+	if err != nil {
+		return nil, err
+	}
+	keys := []models.APIKey{}
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (m *mongoAPIKeys) Revoke(ctx context.Context, userId string, keyId string, at time.Time) error {
+	result, err := m.collection.UpdateOne(ctx,
+		bson.M{"key_id": keyId, "user_id": userId},
+		bson.A{bson.M{"$set": bson.M{"revoked_at": bson.M{"$ifNull": bson.A{"$revoked_at", at}}}}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *mongoAPIKeys) RecordUse(ctx context.Context, keyId string, at time.Time, ip string) error {
+	_, err := m.collection.UpdateOne(ctx,
+		bson.M{"key_id": keyId},
+		bson.M{"$set": bson.M{"last_used_at": at, "last_used_ip": ip}})
+	return err
+}
+
+func (m *mongoAPIKeys) DeleteByUser(ctx context.Context, userId string) error {
+	_, err := m.collection.DeleteMany(ctx, bson.M{"user_id": userId})
+	return err
+}
+
+type mongoDeviceAuthorizations struct {
+	collection *mongo.Collection
+}
+
+func (m *mongoDeviceAuthorizations) Create(ctx context.Context, auth *models.DeviceAuthorization) error {
+	_, err := m.collection.InsertOne(ctx, auth)
+	return err
+}
+
+func (m *mongoDeviceAuthorizations) GetByDeviceCode(ctx context.Context, deviceCodeHash string) (*models.DeviceAuthorization, error) {
+	return m.findOne(ctx, bson.M{"device_code_hash": deviceCodeHash})
+}
+
+func (m *mongoDeviceAuthorizations) GetByUserCode(ctx context.Context, userCode string) (*models.DeviceAuthorization, error) {
+	return m.findOne(ctx, bson.M{"user_code": userCode})
+}
+
+func (m *mongoDeviceAuthorizations) findOne(ctx context.Context, filter bson.M) (*models.DeviceAuthorization, error) {
+	var auth models.DeviceAuthorization
+	err := m.collection.FindOne(ctx, filter).Decode(&auth)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &auth, nil
+}
+
+func (m *mongoDeviceAuthorizations) RecordPoll(ctx context.Context, deviceCodeHash string, at time.Time, interval int) error {
+	result, err := m.collection.UpdateOne(ctx,
+		bson.M{"device_code_hash": deviceCodeHash},
+		bson.M{"$set": bson.M{"last_polled_at": at, "interval": interval}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *mongoDeviceAuthorizations) Decide(ctx context.Context, deviceCodeHash string, status string, userId string) error {
+	result, err := m.collection.UpdateOne(ctx,
+		bson.M{"device_code_hash": deviceCodeHash, "status": models.DeviceStatusPending},
+		bson.M{"$set": bson.M{"status": status, "user_id": userId}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *mongoDeviceAuthorizations) Delete(ctx context.Context, deviceCodeHash string) error {
+	result, err := m.collection.DeleteOne(ctx, bson.M{"device_code_hash": deviceCodeHash})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *mongoDeviceAuthorizations) DeleteExpired(ctx context.Context, before time.Time) error {
+	_, err := m.collection.DeleteMany(ctx, bson.M{"expires_at": bson.M{"$lt": before}})
+	return err
+}
+
+// mongoAuditEvents stores events with their sequence number as _id, which
+// makes sure two events can never take the same place in the chain.
+type mongoAuditEvents struct {
+	collection *mongo.Collection
+}
+
+func (m *mongoAuditEvents) Append(ctx context.Context, event *models.AuditEvent) error {
+	_, err := m.collection.InsertOne(ctx, event)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+func (m *mongoAuditEvents) Last(ctx context.Context) (*models.AuditEvent, error) {
+	var event models.AuditEvent
+	opts := options.FindOne().SetSort(bson.D{{Key: "_id", Value: -1}})
+	err := m.collection.FindOne(ctx, bson.M{}, opts).Decode(&event)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+func (m *mongoAuditEvents) List(ctx context.Context, query AuditQuery) ([]models.AuditEvent, error) {
+	filter := bson.M{"_id": bson.M{"$gt": query.After}}
+	if query.ActorId != "" {
+		filter["actor_id"] = query.ActorId
+	}
+	if query.TargetId != "" {
+		filter["target_id"] = query.TargetId
+	}
+	if query.UserId != "" {
+		filter["$or"] = bson.A{bson.M{"actor_id": query.UserId}, bson.M{"target_id": query.UserId}}
+	}
+	if query.Action != "" {
+		filter["action"] = query.Action
+	}
+	if query.Outcome != "" {
+		filter["outcome"] = query.Outcome
+	}
+	if !query.Since.IsZero() || !query.Until.IsZero() {
+		window := bson.M{}
+		if !query.Since.IsZero() {
+			window["$gte"] = query.Since
+		}
+		if !query.Until.IsZero() {
+			window["$lt"] = query.Until
+		}
+		filter["time"] = window
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+	if query.Limit > 0 {
+		opts.SetLimit(int64(query.Limit))
+	}
+	cursor, err := m.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	events := []models.AuditEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+type mongoWebhookSubscriptions struct {
+	collection *mongo.Collection
+}
+
+func (m *mongoWebhookSubscriptions) Create(ctx context.Context, subscription *models.WebhookSubscription) error {
+	_, err := m.collection.InsertOne(ctx, subscription)
+	return err
+}
+
+func (m *mongoWebhookSubscriptions) Get(ctx context.Context, subscriptionId string) (*models.WebhookSubscription, error) {
+	var subscription models.WebhookSubscription
+	err := m.collection.FindOne(ctx, bson.M{"subscription_id": subscriptionId}).Decode(&subscription)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+func (m *mongoWebhookSubscriptions) List(ctx context.Context) ([]models.WebhookSubscription, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := m.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	subscriptions := []models.WebhookSubscription{}
+	if err := cursor.All(ctx, &subscriptions); err != nil {
+		return nil, err
+	}
+	return subscriptions, nil
+}
+
+func (m *mongoWebhookSubscriptions) Delete(ctx context.Context, subscriptionId string) error {
+	result, err := m.collection.DeleteOne(ctx, bson.M{"subscription_id": subscriptionId})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type mongoWebhookEvents struct {
+	collection *mongo.Collection
+}
+
+func (m *mongoWebhookEvents) Create(ctx context.Context, event *models.WebhookEvent) error {
+	_, err := m.collection.InsertOne(ctx, event)
+	return err
+}
+
+func (m *mongoWebhookEvents) Get(ctx context.Context, eventId string) (*models.WebhookEvent, error) {
+	var event models.WebhookEvent
+	err := m.collection.FindOne(ctx, bson.M{"event_id": eventId}).Decode(&event)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+func (m *mongoWebhookEvents) ListPending(ctx context.Context, limit int) ([]models.WebhookEvent, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}).SetLimit(int64(limit))
+	cursor, err := m.collection.Find(ctx, bson.M{"dispatched_at": nil}, opts)
+	if err != nil {
+		return nil, err
+	}
+	events := []models.WebhookEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (m *mongoWebhookEvents) MarkDispatched(ctx context.Context, eventId string, at time.Time) error {
+	result, err := m.collection.UpdateOne(ctx, bson.M{"event_id": eventId}, bson.M{"$set": bson.M{"dispatched_at": at}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// mongoWebhookDeliveries stores deliveries with their ID as _id, so fanning an
+// event out twice cannot create duplicate deliveries.
+type mongoWebhookDeliveries struct {
+	collection *mongo.Collection
+}
+
+func (m *mongoWebhookDeliveries) Create(ctx context.Context, delivery *models.WebhookDelivery) error {
+	_, err := m.collection.InsertOne(ctx, mongoWebhookDelivery{ID: delivery.Delivery_id, WebhookDelivery: *delivery})
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+func (m *mongoWebhookDeliveries) Get(ctx context.Context, deliveryId string) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	err := m.collection.FindOne(ctx, bson.M{"_id": deliveryId}).Decode(&delivery)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+func (m *mongoWebhookDeliveries) Update(ctx context.Context, delivery *models.WebhookDelivery) error {
+	result, err := m.collection.ReplaceOne(ctx, bson.M{"_id": delivery.Delivery_id},
+		mongoWebhookDelivery{ID: delivery.Delivery_id, WebhookDelivery: *delivery})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *mongoWebhookDeliveries) ListDue(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).SetLimit(int64(limit))
+	return m.find(ctx, bson.M{"status": models.WebhookPending, "next_attempt_at": bson.M{"$lte": now}}, opts)
+}
+
+func (m *mongoWebhookDeliveries) List(ctx context.Context, status string, subscriptionId string, limit int) ([]models.WebhookDelivery, error) {
+	filter := bson.M{}
+	if status != "" {
+		filter["status"] = status
+	}
+	if subscriptionId != "" {
+		filter["subscription_id"] = subscriptionId
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(int64(limit))
+	return m.find(ctx, filter, opts)
+}
+
+func (m *mongoWebhookDeliveries) find(ctx context.Context, filter bson.M, opts *options.FindOptions) ([]models.WebhookDelivery, error) {
+	cursor, err := m.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	deliveries := []models.WebhookDelivery{}
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// mongoWebhookDelivery is a delivery as stored, keyed by its ID
+type mongoWebhookDelivery struct {
+	ID                     string `bson:"_id"`
+	models.WebhookDelivery `bson:",inline"`
+}
@@ -0,0 +1,1287 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arunprasad2002/go-jwt/models"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	_ "modernc.org/sqlite"
+)
+
+// dialect holds what differs between the SQL databases we support.
+type dialect struct {
+	driver        string
+	timestampType string
+	numbered      bool // $1, $2... placeholders instead of ?
+	// columnCount counts the columns of a table, given the table and the column, that have the name
+	columnCount string
+}
+
+var (
+	postgresDialect = dialect{
+		driver:        "pgx",
+		timestampType: "TIMESTAMPTZ",
+		numbered:      true,
+		columnCount:   `SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = ? AND column_name = ?`,
+	}
+	sqliteDialect = dialect{
+		driver:        "sqlite",
+		timestampType: "TIMESTAMP",
+		columnCount:   `SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`,
+	}
+)
+
+// rebind rewrites ? placeholders for the dialect.
+func (d dialect) rebind(query string) string {
+	if !d.numbered {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// schema creates the tables as they were first released, later changes are migrations
+func (d dialect) schema() []string {
+	ts := d.timestampType
+	return []string{
+		`CREATE TABLE IF NOT EXISTS users (
+			user_id TEXT PRIMARY KEY,
+			id TEXT NOT NULL,
+			first_name TEXT,
+			last_name TEXT,
+			password TEXT,
+			email TEXT,
+			phone TEXT,
+			token TEXT,
+			user_type TEXT,
+			refresh_token TEXT,
+			created_at ` + ts + ` NOT NULL,
+			updated_at ` + ts + ` NOT NULL,
+			status TEXT,
+			deactivated_at ` + ts + `,
+			delete_after ` + ts + `,
+			tokens_valid_after ` + ts + `,
+			identities TEXT
+		)`,
+		`CREATE INDEX IF NOT EXISTS users_email_idx ON users (email)`,
+		`CREATE INDEX IF NOT EXISTS users_phone_idx ON users (phone)`,
+		`CREATE TABLE IF NOT EXISTS sessions (
+			session_id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			ip TEXT,
+			user_agent TEXT,
+			created_at ` + ts + ` NOT NULL,
+			expires_at ` + ts + ` NOT NULL,
+			revoked_at ` + ts + `
+		)`,
+		`CREATE INDEX IF NOT EXISTS sessions_user_idx ON sessions (user_id)`,
+		`CREATE TABLE IF NOT EXISTS service_accounts (
+			client_id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			scopes TEXT NOT NULL,
+			secret_hash TEXT,
+			public_keys TEXT,
+			created_by TEXT,
+			created_at ` + ts + ` NOT NULL,
+			updated_at ` + ts + ` NOT NULL,
+			secret_rotated_at ` + ts + `,
+			disabled_at ` + ts + `
+		)`,
+		`CREATE TABLE IF NOT EXISTS api_keys (
+			key_id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			name TEXT NOT NULL,
+			prefix TEXT NOT NULL UNIQUE,
+			key_hash TEXT NOT NULL,
+			scopes TEXT NOT NULL,
+			created_at ` + ts + ` NOT NULL,
+			expires_at ` + ts + `,
+			last_used_at ` + ts + `,
+			last_used_ip TEXT,
+			revoked_at ` + ts + `
+		)`,
+		`CREATE INDEX IF NOT EXISTS api_keys_user_idx ON api_keys (user_id)`,
+		`CREATE TABLE IF NOT EXISTS device_authorizations (
+			device_code_hash TEXT PRIMARY KEY,
+			user_code TEXT NOT NULL UNIQUE,
+			client_id TEXT NOT NULL,
+			scope TEXT,
+			status TEXT NOT NULL,
+			user_id TEXT,
+			poll_interval INTEGER NOT NULL,
+			created_at ` + ts + ` NOT NULL,
+			expires_at ` + ts + ` NOT NULL,
+			last_polled_at ` + ts + `
+		)`,
+		`CREATE TABLE IF NOT EXISTS audit_events (
+			sequence BIGINT PRIMARY KEY,
+			occurred_at ` + ts + ` NOT NULL,
+			action TEXT NOT NULL,
+			outcome TEXT NOT NULL,
+			reason TEXT NOT NULL,
+			actor_id TEXT NOT NULL,
+			actor_type TEXT NOT NULL,
+			target_id TEXT NOT NULL,
+			target_type TEXT NOT NULL,
+			ip TEXT NOT NULL,
+			user_agent TEXT NOT NULL,
+			request_id TEXT NOT NULL,
+			details TEXT NOT NULL,
+			prev_hash TEXT NOT NULL,
+			hash TEXT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS audit_events_actor_idx ON audit_events (actor_id)`,
+		`CREATE INDEX IF NOT EXISTS audit_events_target_idx ON audit_events (target_id)`,
+		`CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+			subscription_id TEXT PRIMARY KEY,
+			url TEXT NOT NULL,
+			events TEXT NOT NULL,
+			description TEXT,
+			secret TEXT NOT NULL,
+			created_by TEXT,
+			created_at ` + ts + ` NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS webhook_events (
+			event_id TEXT PRIMARY KEY,
+			type TEXT NOT NULL,
+			data TEXT NOT NULL,
+			created_at ` + ts + ` NOT NULL,
+			dispatched_at ` + ts + `
+		)`,
+		`CREATE INDEX IF NOT EXISTS webhook_events_pending_idx ON webhook_events (dispatched_at, created_at)`,
+		`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			delivery_id TEXT PRIMARY KEY,
+			event_id TEXT NOT NULL,
+			event_type TEXT NOT NULL,
+			subscription_id TEXT NOT NULL,
+			status TEXT NOT NULL,
+			attempts INTEGER NOT NULL,
+			next_attempt_at ` + ts + ` NOT NULL,
+			last_attempt_at ` + ts + `,
+			last_status_code INTEGER NOT NULL,
+			last_error TEXT NOT NULL,
+			created_at ` + ts + ` NOT NULL,
+			delivered_at ` + ts + `
+		)`,
+		`CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (status, next_attempt_at)`,
+	}
+}
+
+// migration changes the schema of an existing database
+type migration func(ctx context.Context, db sqlDB, d dialect) error
+
+// migrations are applied in order to the tables of schema, each one once. The
+// number of migrations applied is kept in schema_migrations. Migrations are
+// never edited or reordered once released, new ones are appended.
+var migrations = []migration{
+	// 1: subject of the certificates that authenticate a service account
+	addColumn("service_accounts", "tls_client_auth_subject_dn", "TEXT"),
+	// 2-4: what the tokens of a session were issued for and its current refresh token
+	addColumn("sessions", "audience", "TEXT"),
+	addColumn("sessions", "scopes", "TEXT"),
+	addColumn("sessions", "refresh_id", "TEXT"),
+	// 5: users created by Google login had a lowercase type
+	statement(`UPDATE users SET user_type = 'USER' WHERE user_type = 'user'`),
+}
+
+// statement runs a single SQL statement
+func statement(query string) migration {
+	return func(ctx context.Context, db sqlDB, d dialect) error {
+		_, err := db.ExecContext(ctx, query)
+		return err
+	}
+}
+
+// addColumn adds a column unless it exists. Databases created while the
+// column was still part of the CREATE TABLE statement already have it.
+func addColumn(table string, column string, definition string) migration {
+	return func(ctx context.Context, db sqlDB, d dialect) error {
+		var count int
+		if err := db.QueryRowContext(ctx, d.rebind(d.columnCount), table, column).Scan(&count); err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+		_, err := db.ExecContext(ctx, `ALTER TABLE `+table+` ADD COLUMN `+column+` `+definition)
+		return err
+	}
+}
+
+// migrate creates the tables if needed and applies the migrations the database lacks
+func migrate(ctx context.Context, db *sql.DB, d dialect) error {
+	for _, stmt := range d.schema() {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("creating schema: %w", err)
+		}
+	}
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		applied_at `+d.timestampType+` NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("creating schema: %w", err)
+	}
+	var applied int
+	if err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&applied); err != nil {
+		return fmt.Errorf("reading schema version: %w", err)
+	}
+	if applied > len(migrations) {
+		return fmt.Errorf("database schema version %d is newer than this build's %d", applied, len(migrations))
+	}
+	for version := applied + 1; version <= len(migrations); version++ {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if err := migrations[version-1](ctx, tx, d); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("applying migration %d: %w", version, err)
+		}
+		if _, err := tx.ExecContext(ctx, d.rebind(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`), version, time.Now().UTC()); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("applying migration %d: %w", version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("applying migration %d: %w", version, err)
+		}
+	}
+	return nil
+}
+
+// OpenPostgres connects to PostgreSQL, creates the tables if needed and migrates them.
+func OpenPostgres(ctx context.Context, url string) (*Store, error) {
+	return openSQL(ctx, postgresDialect, url)
+}
+
+// OpenSQLite opens the SQLite database at path, creates the tables if needed and migrates them.
+func OpenSQLite(ctx context.Context, path string) (*Store, error) {
+	return openSQL(ctx, sqliteDialect, path)
+}
+
+func openSQL(ctx context.Context, d dialect, dsn string) (*Store, error) {
+	db, err := sql.Open(d.driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := migrate(ctx, db, d); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	st := newSQLStore(db, d)
+	st.closer = func(ctx context.Context) error {
+		return db.Close()
+	}
+	st.pinger = db.PingContext
+	st.transaction = func(ctx context.Context, fn func(ctx context.Context, tx *Store) error) error {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if err := fn(ctx, newSQLStore(tx, d)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		return tx.Commit()
+	}
+	return st, nil
+}
+
+// sqlDB is what the stores need from a connection pool or a transaction.
+type sqlDB interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func newSQLStore(db sqlDB, d dialect) *Store {
+	return &Store{
+		Users:                &sqlUsers{db: db, dialect: d},
+		Sessions:             &sqlSessions{db: db, dialect: d},
+		ServiceAccounts:      &sqlServiceAccounts{db: db, dialect: d},
+		APIKeys:              &sqlAPIKeys{db: db, dialect: d},
+		DeviceAuthorizations: &sqlDeviceAuthorizations{db: db, dialect: d},
+		AuditEvents:          &sqlAuditEvents{db: db, dialect: d},
+		WebhookSubscriptions: &sqlWebhookSubscriptions{db: db, dialect: d},
+		WebhookEvents:        &sqlWebhookEvents{db: db, dialect: d},
+		WebhookDeliveries:    &sqlWebhookDeliveries{db: db, dialect: d},
+	}
+}
+
+const userColumns = `user_id, id, first_name, last_name, password, email, phone, token, user_type, refresh_token,
+	created_at, updated_at, status, deactivated_at, delete_after, tokens_valid_after, identities`
+
+type sqlUsers struct {
+	db      sqlDB
+	dialect dialect
+}
+
+func (s *sqlUsers) Create(ctx context.Context, user *models.User) error {
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	if user.User_id == nil {
+		userId := user.ID.Hex()
+		user.User_id = &userId
+	}
+	args, err := userArgs(user)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO users (` + userColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = s.db.ExecContext(ctx, s.dialect.rebind(query), args...)
+	return err
+}
+
+func (s *sqlUsers) Update(ctx context.Context, user *models.User) error {
+	if user.User_id == nil {
+		return ErrNotFound
+	}
+	args, err := userArgs(user)
+	if err != nil {
+		return err
+	}
+	query := `UPDATE users SET id = ?, first_name = ?, last_name = ?, password = ?, email = ?, phone = ?, token = ?,
+		user_type = ?, refresh_token = ?, created_at = ?, updated_at = ?, status = ?, deactivated_at = ?,
+		delete_after = ?, tokens_valid_after = ?, identities = ? WHERE user_id = ?`
+	result, err := s.db.ExecContext(ctx, s.dialect.rebind(query), append(args[1:], args[0])...)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (s *sqlUsers) Delete(ctx context.Context, userId string) error {
+	result, err := s.db.ExecContext(ctx, s.dialect.rebind(`DELETE FROM users WHERE user_id = ?`), userId)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (s *sqlUsers) DeletePendingDeletion(ctx context.Context, userId string, before time.Time) error {
+	query := `DELETE FROM users WHERE user_id = ? AND status = ? AND delete_after <= ?`
+	result, err := s.db.ExecContext(ctx, s.dialect.rebind(query), userId, models.StatusPendingDeletion, before.UTC())
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (s *sqlUsers) GetByID(ctx context.Context, userId string) (*models.User, error) {
+	row := s.db.QueryRowContext(ctx, s.dialect.rebind(`SELECT `+userColumns+` FROM users WHERE user_id = ?`), userId)
+	return scanUser(row)
+}
+
+func (s *sqlUsers) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	row := s.db.QueryRowContext(ctx, s.dialect.rebind(`SELECT `+userColumns+` FROM users WHERE email = ? LIMIT 1`), email)
+	return scanUser(row)
+}
+
+func (s *sqlUsers) EmailExists(ctx context.Context, email string) (bool, error) {
+	return s.exists(ctx, `SELECT COUNT(*) FROM users WHERE email = ?`, email)
+}
+
+func (s *sqlUsers) PhoneExists(ctx context.Context, phone string) (bool, error) {
+	return s.exists(ctx, `SELECT COUNT(*) FROM users WHERE phone = ?`, phone)
+}
+
+func (s *sqlUsers) exists(ctx context.Context, query string, arg string) (bool, error) {
+	var count int
+	if err := s.db.QueryRowContext(ctx, s.dialect.rebind(query), arg).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (s *sqlUsers) List(ctx context.Context, offset int, limit int) ([]models.User, int, error) {
+	var total int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users`).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	query := `SELECT ` + userColumns + ` FROM users ORDER BY created_at, user_id LIMIT ? OFFSET ?`
+	users, err := s.query(ctx, query, limit, offset)
+	return users, total, err
+}
+
+func (s *sqlUsers) UpdateTokens(ctx context.Context, userId string, token string, refreshToken string) error {
+	query := `UPDATE users SET token = ?, refresh_token = ?, updated_at = ? WHERE user_id = ?`
+	result, err := s.db.ExecContext(ctx, s.dialect.rebind(query), token, refreshToken, time.Now().UTC(), userId)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (s *sqlUsers) ListPendingDeletion(ctx context.Context, before time.Time) ([]models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE status = ? AND delete_after <= ?`
+	return s.query(ctx, query, models.StatusPendingDeletion, before.UTC())
+}
+
+func (s *sqlUsers) query(ctx context.Context, query string, args ...interface{}) ([]models.User, error) {
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+	return users, rows.Err()
+}
+
+// userArgs returns the values of userColumns for user, in order.
+func userArgs(user *models.User) ([]interface{}, error) {
+	var identities interface{}
+	if user.Identities != nil {
+		encoded, err := json.Marshal(user.Identities)
+		if err != nil {
+			return nil, err
+		}
+		identities = string(encoded)
+	}
+	return []interface{}{
+		*user.User_id, user.ID.Hex(), user.First_name, user.Last_name, user.Password, user.Email, user.Phone,
+		user.Token, user.User_type, user.Refresh_token, user.Created_at.UTC(), user.Updated_at.UTC(), user.Status,
+		nullTime(user.Deactivated_at), nullTime(user.Delete_after), nullTime(user.Tokens_valid_after), identities,
+	}, nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanUser(row scanner) (*models.User, error) {
+	var (
+		user                                               models.User
+		userId, id                                         string
+		firstName, lastName, password, email, phone, token sql.NullString
+		userType, refreshToken, status, identities         sql.NullString
+		deactivatedAt, deleteAfter, tokensValidAfter       sql.NullTime
+	)
+	err := row.Scan(&userId, &id, &firstName, &lastName, &password, &email, &phone, &token, &userType,
+		&refreshToken, &user.Created_at, &user.Updated_at, &status, &deactivatedAt, &deleteAfter,
+		&tokensValidAfter, &identities)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user.User_id = &userId
+	if objectId, err := primitive.ObjectIDFromHex(id); err == nil {
+		user.ID = objectId
+	}
+	user.First_name = nullString(firstName)
+	user.Last_name = nullString(lastName)
+	user.Password = nullString(password)
+	user.Email = nullString(email)
+	user.Phone = nullString(phone)
+	user.Token = nullString(token)
+	user.User_type = nullString(userType)
+	user.Refresh_token = nullString(refreshToken)
+	user.Status = nullString(status)
+	user.Deactivated_at = timePointer(deactivatedAt)
+	user.Delete_after = timePointer(deleteAfter)
+	user.Tokens_valid_after = timePointer(tokensValidAfter)
+	if identities.Valid && identities.String != "" {
+		if err := json.Unmarshal([]byte(identities.String), &user.Identities); err != nil {
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+const sessionColumns = `session_id, user_id, ip, user_agent, audience, scopes, refresh_id, created_at, expires_at,
+	revoked_at`
+
+type sqlSessions struct {
+	db      sqlDB
+	dialect dialect
+}
+
+func (s *sqlSessions) Create(ctx context.Context, session *models.Session) error {
+	scopes, err := json.Marshal(session.Scopes)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO sessions (` + sessionColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = s.db.ExecContext(ctx, s.dialect.rebind(query), session.Session_id, session.User_id, session.Ip,
+		session.User_agent, session.Audience, string(scopes), session.Refresh_id, session.Created_at.UTC(),
+		session.Expires_at.UTC(), nullTime(session.Revoked_at))
+	return err
+}
+
+func (s *sqlSessions) Get(ctx context.Context, sessionId string) (*models.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE session_id = ?`
+	return scanSession(s.db.QueryRowContext(ctx, s.dialect.rebind(query), sessionId))
+}
+
+func (s *sqlSessions) ListByUser(ctx context.Context, userId string) ([]models.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE user_id = ? ORDER BY created_at`
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(query), userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, rows.Err()
+}
+
+func (s *sqlSessions) Rotate(ctx context.Context, sessionId string, refreshId string, nextRefreshId string, scopes []string, expiresAt time.Time) error {
+	encoded, err := json.Marshal(scopes)
+	if err != nil {
+		return err
+	}
+	query := `UPDATE sessions SET refresh_id = ?, scopes = ?, expires_at = ?
+		WHERE session_id = ? AND refresh_id = ? AND revoked_at IS NULL`
+	result, err := s.db.ExecContext(ctx, s.dialect.rebind(query), nextRefreshId, string(encoded), expiresAt.UTC(),
+		sessionId, refreshId)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (s *sqlSessions) Revoke(ctx context.Context, sessionId string, at time.Time) error {
+	query := `UPDATE sessions SET revoked_at = ? WHERE session_id = ? AND revoked_at IS NULL`
+	_, err := s.db.ExecContext(ctx, s.dialect.rebind(query), at.UTC(), sessionId)
+	return err
+}
+
+func (s *sqlSessions) RevokeByUser(ctx context.Context, userId string, at time.Time) error {
+	query := `UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`
+	_, err := s.db.ExecContext(ctx, s.dialect.rebind(query), at.UTC(), userId)
+	return err
+}
+
+func (s *sqlSessions) DeleteByUser(ctx context.Context, userId string) error {
+	_, err := s.db.ExecContext(ctx, s.dialect.rebind(`DELETE FROM sessions WHERE user_id = ?`), userId)
+	return err
+}
+
+func scanSession(row scanner) (*models.Session, error) {
+	var (
+		session                                    models.Session
+		ip, userAgent, audience, scopes, refreshId sql.NullString
+		revokedAt                                  sql.NullTime
+	)
+	err := row.Scan(&session.Session_id, &session.User_id, &ip, &userAgent, &audience, &scopes, &refreshId,
+		&session.Created_at, &session.Expires_at, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Sessions created before the scopes were kept have none
+	if scopes.Valid && scopes.String != "" {
+		if err := json.Unmarshal([]byte(scopes.String), &session.Scopes); err != nil {
+			return nil, err
+		}
+	}
+	session.Ip = ip.String
+	session.User_agent = userAgent.String
+	session.Audience = audience.String
+	session.Refresh_id = refreshId.String
+	session.Revoked_at = timePointer(revokedAt)
+	return &session, nil
+}
+
+const serviceAccountColumns = `client_id, name, scopes, secret_hash, public_keys, tls_client_auth_subject_dn, created_by,
+	created_at, updated_at, secret_rotated_at, disabled_at`
+
+type sqlServiceAccounts struct {
+	db      sqlDB
+	dialect dialect
+}
+
+func (s *sqlServiceAccounts) Create(ctx context.Context, account *models.ServiceAccount) error {
+	args, err := serviceAccountArgs(account)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO service_accounts (` + serviceAccountColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = s.db.ExecContext(ctx, s.dialect.rebind(query), args...)
+	return err
+}
+
+func (s *sqlServiceAccounts) Update(ctx context.Context, account *models.ServiceAccount) error {
+	args, err := serviceAccountArgs(account)
+	if err != nil {
+		return err
+	}
+	query := `UPDATE service_accounts SET name = ?, scopes = ?, secret_hash = ?, public_keys = ?,
+		tls_client_auth_subject_dn = ?, created_by = ?, created_at = ?, updated_at = ?, secret_rotated_at = ?,
+		disabled_at = ? WHERE client_id = ?`
+	result, err := s.db.ExecContext(ctx, s.dialect.rebind(query), append(args[1:], args[0])...)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (s *sqlServiceAccounts) GetByClientID(ctx context.Context, clientId string) (*models.ServiceAccount, error) {
+	query := `SELECT ` + serviceAccountColumns + ` FROM service_accounts WHERE client_id = ?`
+	return scanServiceAccount(s.db.QueryRowContext(ctx, s.dialect.rebind(query), clientId))
+}
+
+func (s *sqlServiceAccounts) List(ctx context.Context) ([]models.ServiceAccount, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+serviceAccountColumns+` FROM service_accounts ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := []models.ServiceAccount{}
+	for rows.Next() {
+		account, err := scanServiceAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, *account)
+	}
+	return accounts, rows.Err()
+}
+
+// serviceAccountArgs returns the values of serviceAccountColumns for account, in order.
+func serviceAccountArgs(account *models.ServiceAccount) ([]interface{}, error) {
+	scopes, err := json.Marshal(account.Scopes)
+	if err != nil {
+		return nil, err
+	}
+	var publicKeys interface{}
+	if account.Public_keys != nil {
+		encoded, err := json.Marshal(account.Public_keys)
+		if err != nil {
+			return nil, err
+		}
+		publicKeys = string(encoded)
+	}
+	return []interface{}{
+		account.Client_id, account.Name, string(scopes), account.Secret_hash, publicKeys,
+		account.Tls_client_auth_subject_dn, account.Created_by, account.Created_at.UTC(), account.Updated_at.UTC(), nullTime(account.Secret_rotated_at), nullTime(account.Disabled_at),
+	}, nil
+}
+
+func scanServiceAccount(row scanner) (*models.ServiceAccount, error) {
+	var (
+		account                                      models.ServiceAccount
+		scopes                                       string
+		secretHash, publicKeys, subjectDN, createdBy sql.NullString
+		secretRotatedAt, disabledAt                  sql.NullTime
+	)
+	err := row.Scan(&account.Client_id, &account.Name, &scopes, &secretHash, &publicKeys, &subjectDN, &createdBy,
+		&account.Created_at, &account.Updated_at, &secretRotatedAt, &disabledAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(scopes), &account.Scopes); err != nil {
+		return nil, err
+	}
+	if publicKeys.Valid && publicKeys.String != "" {
+		if err := json.Unmarshal([]byte(publicKeys.String), &account.Public_keys); err != nil {
+			return nil, err
+		}
+	}
+	account.Secret_hash = secretHash.String
+	account.Tls_client_auth_subject_dn = subjectDN.String
+	account.Created_by = createdBy.String
+	account.Secret_rotated_at = timePointer(secretRotatedAt)
+	account.Disabled_at = timePointer(disabledAt)
+	return &account, nil
+}
+
+const apiKeyColumns = `key_id, user_id, name, prefix, key_hash, scopes, created_at, expires_at, last_used_at,
+	last_used_ip, revoked_at`
+
+type sqlAPIKeys struct {
+	db      sqlDB
+	dialect dialect
+}
+
+func (s *sqlAPIKeys) Create(ctx context.Context, key *models.APIKey) error {
+	scopes, err := json.Marshal(key.Scopes)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO api_keys (` + apiKeyColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = s.db.ExecContext(ctx, s.dialect.rebind(query), key.Key_id, key.User_id, key.Name, key.Prefix, key.Key_hash,
+		string(scopes), key.Created_at.UTC(), nullTime(key.Expires_at), nullTime(key.Last_used_at), key.Last_used_ip,
+		nullTime(key.Revoked_at))
+	if err != nil {
+		// Drivers report unique violations differently, so look for the taken prefix instead
+		var taken int
+		check := `SELECT COUNT(*) FROM api_keys WHERE prefix = ?`
+		if s.db.QueryRowContext(ctx, s.dialect.rebind(check), key.Prefix).Scan(&taken) == nil && taken > 0 {
+			return ErrConflict
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *sqlAPIKeys) GetByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE prefix = ?`
+	return scanAPIKey(s.db.QueryRowContext(ctx, s.dialect.rebind(query), prefix))
+}
+
+func (s *sqlAPIKeys) ListByUser(ctx context.Context, userId string) ([]models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE user_id = ? ORDER BY created_at`
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(query), userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+func (s *sqlAPIKeys) Revoke(ctx context.Context, userId string, keyId string, at time.Time) error {
+	query := `UPDATE api_keys SET revoked_at = COALESCE(revoked_at, ?) WHERE key_id = ? AND user_id = ?`
+	result, err := s.db.ExecContext(ctx, s.dialect.rebind(query), at.UTC(), keyId, userId)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (s *sqlAPIKeys) RecordUse(ctx context.Context, keyId string, at time.Time, ip string) error {
+	query := `UPDATE api_keys SET last_used_at = ?, last_used_ip = ? WHERE key_id = ?`
+	_, err := s.db.ExecContext(ctx, s.dialect.rebind(query), at.UTC(), ip, keyId)
+	return err
+}
+
+func (s *sqlAPIKeys) DeleteByUser(ctx context.Context, userId string) error {
+	_, err := s.db.ExecContext(ctx, s.dialect.rebind(`DELETE FROM api_keys WHERE user_id = ?`), userId)
+	return err
+}
+
+func scanAPIKey(row scanner) (*models.APIKey, error) {
+	var (
+		key                              models.APIKey
+		scopes                           string
+		lastUsedIp                       sql.NullString
+		expiresAt, lastUsedAt, revokedAt sql.NullTime
+	)
+	err := row.Scan(&key.Key_id, &key.User_id, &key.Name, &key.Prefix, &key.Key_hash, &scopes, &key.Created_at,
+		&expiresAt, &lastUsedAt, &lastUsedIp, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(scopes), &key.Scopes); err != nil {
+		return nil, err
+	}
+	key.Expires_at = timePointer(expiresAt)
+	key.Last_used_at = timePointer(lastUsedAt)
+	key.Last_used_ip = lastUsedIp.String
+	key.Revoked_at = timePointer(revokedAt)
+	return &key, nil
+}
+
+const deviceAuthorizationColumns = `device_code_hash, user_code, client_id, scope, status, user_id, poll_interval,
+	created_at, expires_at, last_polled_at`
+
+type sqlDeviceAuthorizations struct {
+	db      sqlDB
+	dialect dialect
+}
+
+func (s *sqlDeviceAuthorizations) Create(ctx context.Context, auth *models.DeviceAuthorization) error {
+	query := `INSERT INTO device_authorizations (` + deviceAuthorizationColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.db.ExecContext(ctx, s.dialect.rebind(query), auth.Device_code_hash, auth.User_code, auth.Client_id,
+		auth.Scope, auth.Status, auth.User_id, auth.Interval, auth.Created_at.UTC(), auth.Expires_at.UTC(),
+		nullTime(auth.Last_polled_at))
+	return err
+}
+
+func (s *sqlDeviceAuthorizations) GetByDeviceCode(ctx context.Context, deviceCodeHash string) (*models.DeviceAuthorization, error) {
+	query := `SELECT ` + deviceAuthorizationColumns + ` FROM device_authorizations WHERE device_code_hash = ?`
+	return scanDeviceAuthorization(s.db.QueryRowContext(ctx, s.dialect.rebind(query), deviceCodeHash))
+}
+
+func (s *sqlDeviceAuthorizations) GetByUserCode(ctx context.Context, userCode string) (*models.DeviceAuthorization, error) {
+	query := `SELECT ` + deviceAuthorizationColumns + ` FROM device_authorizations WHERE user_code = ?`
+	return scanDeviceAuthorization(s.db.QueryRowContext(ctx, s.dialect.rebind(query), userCode))
+}
+
+func (s *sqlDeviceAuthorizations) RecordPoll(ctx context.Context, deviceCodeHash string, at time.Time, interval int) error {
+	query := `UPDATE device_authorizations SET last_polled_at = ?, poll_interval = ? WHERE device_code_hash = ?`
+	result, err := s.db.ExecContext(ctx, s.dialect.rebind(query), at.UTC(), interval, deviceCodeHash)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (s *sqlDeviceAuthorizations) Decide(ctx context.Context, deviceCodeHash string, status string, userId string) error {
+	query := `UPDATE device_authorizations SET status = ?, user_id = ? WHERE device_code_hash = ? AND status = ?`
+	result, err := s.db.ExecContext(ctx, s.dialect.rebind(query), status, userId, deviceCodeHash, models.DeviceStatusPending)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (s *sqlDeviceAuthorizations) Delete(ctx context.Context, deviceCodeHash string) error {
+	query := `DELETE FROM device_authorizations WHERE device_code_hash = ?`
+	result, err := s.db.ExecContext(ctx, s.dialect.rebind(query), deviceCodeHash)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (s *sqlDeviceAuthorizations) DeleteExpired(ctx context.Context, before time.Time) error {
+	query := `DELETE FROM device_authorizations WHERE expires_at < ?`
+	_, err := s.db.ExecContext(ctx, s.dialect.rebind(query), before.UTC())
+	return err
+}
+
+func scanDeviceAuthorization(row scanner) (*models.DeviceAuthorization, error) {
+	var (
+		auth          models.DeviceAuthorization
+		scope, userId sql.NullString
+		lastPolledAt  sql.NullTime
+	)
+	err := row.Scan(&auth.Device_code_hash, &auth.User_code, &auth.Client_id, &scope, &auth.Status, &userId,
+		&auth.Interval, &auth.Created_at, &auth.Expires_at, &lastPolledAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	auth.Scope = scope.String
+	auth.User_id = userId.String
+	auth.Last_polled_at = timePointer(lastPolledAt)
+	return &auth, nil
+}
+
+const auditEventColumns = `sequence, occurred_at, action, outcome, reason, actor_id, actor_type, target_id, target_type,
+	ip, user_agent, request_id, details, prev_hash, hash`
+
+type sqlAuditEvents struct {
+	db      sqlDB
+	dialect dialect
+}
+
+func (s *sqlAuditEvents) Append(ctx context.Context, event *models.AuditEvent) error {
+	details := ""
+	if len(event.Details) > 0 {
+		encoded, err := json.Marshal(event.Details)
+		if err != nil {
+			return err
+		}
+		details = string(encoded)
+	}
+	query := `INSERT INTO audit_events (` + auditEventColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.db.ExecContext(ctx, s.dialect.rebind(query), event.Sequence, event.Time.UTC(), event.Action,
+		event.Outcome, event.Reason, event.Actor_id, event.Actor_type, event.Target_id, event.Target_type, event.Ip,
+		event.User_agent, event.Request_id, details, event.Prev_hash, event.Hash)
+	if err != nil {
+		// Drivers report unique violations differently, so look for the taken sequence number instead
+		var taken int
+		check := `SELECT COUNT(*) FROM audit_events WHERE sequence = ?`
+		if s.db.QueryRowContext(ctx, s.dialect.rebind(check), event.Sequence).Scan(&taken) == nil && taken > 0 {
+			return ErrConflict
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *sqlAuditEvents) Last(ctx context.Context) (*models.AuditEvent, error) {
+	query := `SELECT ` + auditEventColumns + ` FROM audit_events ORDER BY sequence DESC LIMIT 1`
+	return scanAuditEvent(s.db.QueryRowContext(ctx, query))
+}
+
+func (s *sqlAuditEvents) List(ctx context.Context, query AuditQuery) ([]models.AuditEvent, error) {
+	conditions := []string{"sequence > ?"}
+	args := []interface{}{query.After}
+	if query.ActorId != "" {
+		conditions = append(conditions, "actor_id = ?")
+		args = append(args, query.ActorId)
+	}
+	if query.TargetId != "" {
+		conditions = append(conditions, "target_id = ?")
+		args = append(args, query.TargetId)
+	}
+	if query.UserId != "" {
+		conditions = append(conditions, "(actor_id = ? OR target_id = ?)")
+		args = append(args, query.UserId, query.UserId)
+	}
+	if query.Action != "" {
+		conditions = append(conditions, "action = ?")
+		args = append(args, query.Action)
+	}
+	if query.Outcome != "" {
+		conditions = append(conditions, "outcome = ?")
+		args = append(args, query.Outcome)
+	}
+	if !query.Since.IsZero() {
+		conditions = append(conditions, "occurred_at >= ?")
+		args = append(args, query.Since.UTC())
+	}
+	if !query.Until.IsZero() {
+		conditions = append(conditions, "occurred_at < ?")
+		args = append(args, query.Until.UTC())
+	}
+	statement := `SELECT ` + auditEventColumns + ` FROM audit_events WHERE ` + strings.Join(conditions, " AND ") +
+		` ORDER BY sequence`
+	if query.Limit > 0 {
+		statement += ` LIMIT ` + strconv.Itoa(query.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(statement), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.AuditEvent{}
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, *event)
+	}
+	return events, rows.Err()
+}
+
+func scanAuditEvent(row scanner) (*models.AuditEvent, error) {
+	var (
+		event   models.AuditEvent
+		details string
+	)
+	err := row.Scan(&event.Sequence, &event.Time, &event.Action, &event.Outcome, &event.Reason, &event.Actor_id,
+		&event.Actor_type, &event.Target_id, &event.Target_type, &event.Ip, &event.User_agent, &event.Request_id,
+		&details, &event.Prev_hash, &event.Hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if details != "" {
+		if err := json.Unmarshal([]byte(details), &event.Details); err != nil {
+			return nil, err
+		}
+	}
+	return &event, nil
+}
+
+const webhookSubscriptionColumns = `subscription_id, url, events, description, secret, created_by, created_at`
+
+type sqlWebhookSubscriptions struct {
+	db      sqlDB
+	dialect dialect
+}
+
+func (s *sqlWebhookSubscriptions) Create(ctx context.Context, subscription *models.WebhookSubscription) error {
+	events, err := json.Marshal(subscription.Events)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO webhook_subscriptions (` + webhookSubscriptionColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	_, err = s.db.ExecContext(ctx, s.dialect.rebind(query), subscription.Subscription_id, subscription.Url,
+		string(events), subscription.Description, subscription.Secret, subscription.Created_by,
+		subscription.Created_at.UTC())
+	return err
+}
+
+func (s *sqlWebhookSubscriptions) Get(ctx context.Context, subscriptionId string) (*models.WebhookSubscription, error) {
+	query := `SELECT ` + webhookSubscriptionColumns + ` FROM webhook_subscriptions WHERE subscription_id = ?`
+	return scanWebhookSubscription(s.db.QueryRowContext(ctx, s.dialect.rebind(query), subscriptionId))
+}
+
+func (s *sqlWebhookSubscriptions) List(ctx context.Context) ([]models.WebhookSubscription, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+webhookSubscriptionColumns+` FROM webhook_subscriptions ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscriptions := []models.WebhookSubscription{}
+	for rows.Next() {
+		subscription, err := scanWebhookSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, *subscription)
+	}
+	return subscriptions, rows.Err()
+}
+
+func (s *sqlWebhookSubscriptions) Delete(ctx context.Context, subscriptionId string) error {
+	query := `DELETE FROM webhook_subscriptions WHERE subscription_id = ?`
+	result, err := s.db.ExecContext(ctx, s.dialect.rebind(query), subscriptionId)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func scanWebhookSubscription(row scanner) (*models.WebhookSubscription, error) {
+	var (
+		subscription           models.WebhookSubscription
+		events                 string
+		description, createdBy sql.NullString
+	)
+	err := row.Scan(&subscription.Subscription_id, &subscription.Url, &events, &description, &subscription.Secret,
+		&createdBy, &subscription.Created_at)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(events), &subscription.Events); err != nil {
+		return nil, err
+	}
+	subscription.Description = description.String
+	subscription.Created_by = createdBy.String
+	return &subscription, nil
+}
+
+const webhookEventColumns = `event_id, type, data, created_at, dispatched_at`
+
+type sqlWebhookEvents struct {
+	db      sqlDB
+	dialect dialect
+}
+
+func (s *sqlWebhookEvents) Create(ctx context.Context, event *models.WebhookEvent) error {
+	query := `INSERT INTO webhook_events (` + webhookEventColumns + `) VALUES (?, ?, ?, ?, ?)`
+	_, err := s.db.ExecContext(ctx, s.dialect.rebind(query), event.Event_id, event.Type, string(event.Data),
+		event.Created_at.UTC(), nullTime(event.Dispatched_at))
+	return err
+}
+
+func (s *sqlWebhookEvents) Get(ctx context.Context, eventId string) (*models.WebhookEvent, error) {
+	query := `SELECT ` + webhookEventColumns + ` FROM webhook_events WHERE event_id = ?`
+	return scanWebhookEvent(s.db.QueryRowContext(ctx, s.dialect.rebind(query), eventId))
+}
+
+func (s *sqlWebhookEvents) ListPending(ctx context.Context, limit int) ([]models.WebhookEvent, error) {
+	query := `SELECT ` + webhookEventColumns + ` FROM webhook_events WHERE dispatched_at IS NULL ORDER BY created_at LIMIT ?`
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(query), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.WebhookEvent{}
+	for rows.Next() {
+		event, err := scanWebhookEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, *event)
+	}
+	return events, rows.Err()
+}
+
+func (s *sqlWebhookEvents) MarkDispatched(ctx context.Context, eventId string, at time.Time) error {
+	query := `UPDATE webhook_events SET dispatched_at = ? WHERE event_id = ?`
+	result, err := s.db.ExecContext(ctx, s.dialect.rebind(query), at.UTC(), eventId)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func scanWebhookEvent(row scanner) (*models.WebhookEvent, error) {
+	var (
+		event        models.WebhookEvent
+		data         string
+		dispatchedAt sql.NullTime
+	)
+	err := row.Scan(&event.Event_id, &event.Type, &data, &event.Created_at, &dispatchedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	event.Data = json.RawMessage(data)
+	event.Dispatched_at = timePointer(dispatchedAt)
+	return &event, nil
+}
+
+const webhookDeliveryColumns = `delivery_id, event_id, event_type, subscription_id, status, attempts, next_attempt_at,
+	last_attempt_at, last_status_code, last_error, created_at, delivered_at`
+
+type sqlWebhookDeliveries struct {
+	db      sqlDB
+	dialect dialect
+}
+
+func (s *sqlWebhookDeliveries) Create(ctx context.Context, delivery *models.WebhookDelivery) error {
+	query := `INSERT INTO webhook_deliveries (` + webhookDeliveryColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (delivery_id) DO NOTHING`
+	result, err := s.db.ExecContext(ctx, s.dialect.rebind(query), delivery.Delivery_id, delivery.Event_id,
+		delivery.Event_type, delivery.Subscription_id, delivery.Status, delivery.Attempts,
+		delivery.Next_attempt_at.UTC(), nullTime(delivery.Last_attempt_at), delivery.Last_status_code,
+		delivery.Last_error, delivery.Created_at.UTC(), nullTime(delivery.Delivered_at))
+	if err != nil {
+		return err
+	}
+	if expectAffected(result) == ErrNotFound {
+		return ErrConflict
+	}
+	return nil
+}
+
+func (s *sqlWebhookDeliveries) Get(ctx context.Context, deliveryId string) (*models.WebhookDelivery, error) {
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries WHERE delivery_id = ?`
+	return scanWebhookDelivery(s.db.QueryRowContext(ctx, s.dialect.rebind(query), deliveryId))
+}
+
+func (s *sqlWebhookDeliveries) Update(ctx context.Context, delivery *models.WebhookDelivery) error {
+	query := `UPDATE webhook_deliveries SET event_id = ?, event_type = ?, subscription_id = ?, status = ?, attempts = ?,
+		next_attempt_at = ?, last_attempt_at = ?, last_status_code = ?, last_error = ?, created_at = ?,
+		delivered_at = ? WHERE delivery_id = ?`
+	result, err := s.db.ExecContext(ctx, s.dialect.rebind(query), delivery.Event_id, delivery.Event_type,
+		delivery.Subscription_id, delivery.Status, delivery.Attempts, delivery.Next_attempt_at.UTC(),
+		nullTime(delivery.Last_attempt_at), delivery.Last_status_code, delivery.Last_error,
+		delivery.Created_at.UTC(), nullTime(delivery.Delivered_at), delivery.Delivery_id)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (s *sqlWebhookDeliveries) ListDue(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries WHERE status = ? AND next_attempt_at <= ?
+		ORDER BY next_attempt_at LIMIT ?`
+	return s.query(ctx, query, models.WebhookPending, now.UTC(), limit)
+}
+
+func (s *sqlWebhookDeliveries) List(ctx context.Context, status string, subscriptionId string, limit int) ([]models.WebhookDelivery, error) {
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries WHERE (? = '' OR status = ?)
+		AND (? = '' OR subscription_id = ?) ORDER BY created_at DESC LIMIT ?`
+	return s.query(ctx, query, status, status, subscriptionId, subscriptionId, limit)
+}
+
+func (s *sqlWebhookDeliveries) query(ctx context.Context, query string, args ...interface{}) ([]models.WebhookDelivery, error) {
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+func scanWebhookDelivery(row scanner) (*models.WebhookDelivery, error) {
+	var (
+		delivery                   models.WebhookDelivery
+		lastAttemptAt, deliveredAt sql.NullTime
+	)
+	err := row.Scan(&delivery.Delivery_id, &delivery.Event_id, &delivery.Event_type, &delivery.Subscription_id,
+		&delivery.Status, &delivery.Attempts, &delivery.Next_attempt_at, &lastAttemptAt, &delivery.Last_status_code,
+		&delivery.Last_error, &delivery.Created_at, &deliveredAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	delivery.Last_attempt_at = timePointer(lastAttemptAt)
+	delivery.Delivered_at = timePointer(deliveredAt)
+	return &delivery, nil
+}
+
+func expectAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
+
+func nullString(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
+
+func timePointer(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
@@ -0,0 +1,194 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/arunprasad2002/go-jwt/models"
+)
+
+var (
+	ErrNotFound = errors.New("record not found")
+	ErrConflict = errors.New("record already exists")
+)
+
+// UserStore persists user accounts.
+type UserStore interface {
+	Create(ctx context.Context, user *models.User) error
+	// Update replaces the stored user that has the same User_id.
+	Update(ctx context.Context, user *models.User) error
+	Delete(ctx context.Context, userId string) error
+	// DeletePendingDeletion deletes the user only if it is still pending deletion with
+	// a Delete_after not later than before, failing with ErrNotFound otherwise.
+	DeletePendingDeletion(ctx context.Context, userId string, before time.Time) error
+	GetByID(ctx context.Context, userId string) (*models.User, error)
+	GetByEmail(ctx context.Context, email string) (*models.User, error)
+	EmailExists(ctx context.Context, email string) (bool, error)
+	PhoneExists(ctx context.Context, phone string) (bool, error)
+	// List returns one page of users and the total number of users.
+	List(ctx context.Context, offset int, limit int) ([]models.User, int, error)
+	UpdateTokens(ctx context.Context, userId string, token string, refreshToken string) error
+	// ListPendingDeletion returns users scheduled for deletion before the given time.
+	ListPendingDeletion(ctx context.Context, before time.Time) ([]models.User, error)
+}
+
+// SessionStore persists the sessions issued at login.
+type SessionStore interface {
+	Create(ctx context.Context, session *models.Session) error
+	Get(ctx context.Context, sessionId string) (*models.Session, error)
+	ListByUser(ctx context.Context, userId string) ([]models.Session, error)
+	// Rotate replaces the refresh token of an active session with nextRefreshId, failing
+	// with ErrNotFound unless refreshId is still the one stored. The session keeps scopes
+	// and expires at expiresAt.
+	Rotate(ctx context.Context, sessionId string, refreshId string, nextRefreshId string, scopes []string, expiresAt time.Time) error
+	// Revoke marks the session as revoked at the given time.
+	Revoke(ctx context.Context, sessionId string, at time.Time) error
+	// RevokeByUser marks every active session of the user as revoked at the given time.
+	RevokeByUser(ctx context.Context, userId string, at time.Time) error
+	DeleteByUser(ctx context.Context, userId string) error
+}
+
+// ServiceAccountStore persists service accounts.
+type ServiceAccountStore interface {
+	Create(ctx context.Context, account *models.ServiceAccount) error
+	// Update replaces the stored service account that has the same Client_id.
+	Update(ctx context.Context, account *models.ServiceAccount) error
+	GetByClientID(ctx context.Context, clientId string) (*models.ServiceAccount, error)
+	List(ctx context.Context) ([]models.ServiceAccount, error)
+}
+
+// APIKeyStore persists personal API keys.
+type APIKeyStore interface {
+	// Create stores key, failing with ErrConflict if its prefix is taken.
+	Create(ctx context.Context, key *models.APIKey) error
+	GetByPrefix(ctx context.Context, prefix string) (*models.APIKey, error)
+	ListByUser(ctx context.Context, userId string) ([]models.APIKey, error)
+	// Revoke marks the user's key as revoked at the given time.
+	Revoke(ctx context.Context, userId string, keyId string, at time.Time) error
+	// RecordUse stores when and from where the key was last used.
+	RecordUse(ctx context.Context, keyId string, at time.Time, ip string) error
+	DeleteByUser(ctx context.Context, userId string) error
+}
+
+// DeviceAuthorizationStore persists pending device authorization grants.
+type DeviceAuthorizationStore interface {
+	Create(ctx context.Context, auth *models.DeviceAuthorization) error
+	GetByDeviceCode(ctx context.Context, deviceCodeHash string) (*models.DeviceAuthorization, error)
+	GetByUserCode(ctx context.Context, userCode string) (*models.DeviceAuthorization, error)
+	// RecordPoll stores when the device last polled and the interval it must keep from
+	// now on, failing with ErrNotFound if the grant is gone. The status is left alone.
+	RecordPoll(ctx context.Context, deviceCodeHash string, at time.Time, interval int) error
+	// Decide sets the status and user of the grant, failing with ErrNotFound unless it
+	// is still pending, so only the first of two decisions is recorded.
+	Decide(ctx context.Context, deviceCodeHash string, status string, userId string) error
+	// Delete removes the grant, failing with ErrNotFound if it is already gone. Grants
+	// are deleted when redeemed, so only one of two concurrent polls gets tokens.
+	Delete(ctx context.Context, deviceCodeHash string) error
+	// DeleteExpired removes grants that expired before the given time.
+	DeleteExpired(ctx context.Context, before time.Time) error
+}
+
+// AuditEventStore persists the audit log. It is append-only: events are never
+// updated or deleted.
+type AuditEventStore interface {
+	// Append stores event, failing with ErrConflict if its sequence number is taken.
+	Append(ctx context.Context, event *models.AuditEvent) error
+	// Last returns the event with the highest sequence number, ErrNotFound if there are none.
+	Last(ctx context.Context) (*models.AuditEvent, error)
+	// List returns the events matching query in sequence order.
+	List(ctx context.Context, query AuditQuery) ([]models.AuditEvent, error)
+}
+
+// AuditQuery filters audit events. Zero fields match everything.
+type AuditQuery struct {
+	ActorId  string
+	TargetId string
+	// UserId matches events where the user is either the actor or the target.
+	UserId  string
+	Action  string
+	Outcome string
+	Since   time.Time
+	Until   time.Time
+	// After skips events up to and including this sequence number.
+	After int64
+	// Limit caps the number of events returned, all of them if zero.
+	Limit int
+}
+
+// WebhookSubscriptionStore persists webhook subscriptions.
+type WebhookSubscriptionStore interface {
+	Create(ctx context.Context, subscription *models.WebhookSubscription) error
+	Get(ctx context.Context, subscriptionId string) (*models.WebhookSubscription, error)
+	List(ctx context.Context) ([]models.WebhookSubscription, error)
+	Delete(ctx context.Context, subscriptionId string) error
+}
+
+// WebhookEventStore is the webhook outbox. Events are created in the same
+// transaction as the change they describe and fanned out to deliveries later.
+type WebhookEventStore interface {
+	Create(ctx context.Context, event *models.WebhookEvent) error
+	Get(ctx context.Context, eventId string) (*models.WebhookEvent, error)
+	// ListPending returns up to limit events that have not been fanned out yet, oldest first.
+	ListPending(ctx context.Context, limit int) ([]models.WebhookEvent, error)
+	// MarkDispatched records that the deliveries of the event were created.
+	MarkDispatched(ctx context.Context, eventId string, at time.Time) error
+}
+
+// WebhookDeliveryStore persists deliveries of events to subscriptions, including
+// the dead ones that ran out of attempts.
+type WebhookDeliveryStore interface {
+	// Create stores delivery, failing with ErrConflict if it exists already.
+	Create(ctx context.Context, delivery *models.WebhookDelivery) error
+	Get(ctx context.Context, deliveryId string) (*models.WebhookDelivery, error)
+	// Update replaces the stored delivery that has the same Delivery_id.
+	Update(ctx context.Context, delivery *models.WebhookDelivery) error
+	// ListDue returns up to limit pending deliveries whose next attempt is due at now, oldest first.
+	ListDue(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error)
+	// List returns up to limit deliveries, newest first, filtered by status and subscription if they are set.
+	List(ctx context.Context, status string, subscriptionId string, limit int) ([]models.WebhookDelivery, error)
+}
+
+// Store bundles the stores of one backend.
+type Store struct {
+	Users                UserStore
+	Sessions             SessionStore
+	ServiceAccounts      ServiceAccountStore
+	APIKeys              APIKeyStore
+	DeviceAuthorizations DeviceAuthorizationStore
+	AuditEvents          AuditEventStore
+	WebhookSubscriptions WebhookSubscriptionStore
+	WebhookEvents        WebhookEventStore
+	WebhookDeliveries    WebhookDeliveryStore
+	closer               func(ctx context.Context) error
+	pinger               func(ctx context.Context) error
+	transaction          func(ctx context.Context, fn func(ctx context.Context, tx *Store) error) error
+}
+
+// Transaction runs fn with a store whose changes are committed together when fn
+// returns nil and rolled back when it fails. fn must only use tx and ctx.
+// MongoDB only has transactions on replica sets. On a standalone MongoDB server
+// and in the memory store there is no rollback, fn's changes are applied as it
+// makes them.
+func (s *Store) Transaction(ctx context.Context, fn func(ctx context.Context, tx *Store) error) error {
+	if s.transaction == nil {
+		return fn(ctx, s)
+	}
+	return s.transaction(ctx, fn)
+}
+
+// Ping checks that the backend can be reached.
+func (s *Store) Ping(ctx context.Context) error {
+	if s.pinger == nil {
+		return nil
+	}
+	return s.pinger(ctx)
+}
+
+// Close releases the backend's connections.
+func (s *Store) Close(ctx context.Context) error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer(ctx)
+}
@@ -0,0 +1,507 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arunprasad2002/go-jwt/models"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// backends opens an empty store of each backend, which is closed and dropped
+// when the test ends. SQLite and the memory store are always tested, Postgres
+// and MongoDB when a server is given in STORE_TEST_POSTGRES_URL or
+// STORE_TEST_MONGODB_URI.
+var backends = []struct {
+	name string
+	open func(t *testing.T) *Store
+}{
+	{name: "memory", open: func(t *testing.T) *Store { return NewMemoryStore() }},
+	{name: "sqlite", open: func(t *testing.T) *Store {
+		ctx := context.Background()
+		st, err := OpenSQLite(ctx, filepath.Join(t.TempDir(), "store.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { st.Close(ctx) })
+		return st
+	}},
+	{name: "postgres", open: func(t *testing.T) *Store {
+		url := os.Getenv("STORE_TEST_POSTGRES_URL")
+		if url == "" {
+			t.Skip("STORE_TEST_POSTGRES_URL is not set")
+		}
+		// Each test gets a schema of its own
+		ctx := context.Background()
+		db, err := sql.Open("pgx", url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		schema := fmt.Sprintf("go_jwt_test_%d", time.Now().UnixNano())
+		if _, err := db.ExecContext(ctx, "CREATE SCHEMA "+schema); err != nil {
+			db.Close()
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			db.ExecContext(ctx, "DROP SCHEMA "+schema+" CASCADE")
+			db.Close()
+		})
+		separator := "?"
+		if strings.Contains(url, "?") {
+			separator = "&"
+		}
+		st, err := OpenPostgres(ctx, url+separator+"search_path="+schema)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { st.Close(ctx) })
+		return st
+	}},
+	{name: "mongo", open: func(t *testing.T) *Store {
+		uri := os.Getenv("STORE_TEST_MONGODB_URI")
+		if uri == "" {
+			t.Skip("STORE_TEST_MONGODB_URI is not set")
+		}
+		ctx := context.Background()
+		client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+		if err != nil {
+			t.Fatal(err)
+		}
+		dbName := fmt.Sprintf("go_jwt_test_%d", time.Now().UnixNano())
+		if err := MigrateMongo(ctx, client, dbName); err != nil {
+			t.Fatal(err)
+		}
+		st := NewMongoStore(client, dbName)
+		t.Cleanup(func() {
+			client.Database(dbName).Drop(ctx)
+			st.Close(ctx)
+		})
+		return st
+	}},
+}
+
+// forEachBackend runs test on an empty store of every backend
+func forEachBackend(t *testing.T, test func(t *testing.T, ctx context.Context, st *Store)) {
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			test(t, context.Background(), backend.open(t))
+		})
+	}
+}
+
+func stringPointer(s string) *string {
+	return &s
+}
+
+func TestUsers(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ctx context.Context, st *Store) {
+		now := time.Now().UTC().Truncate(time.Second)
+		for i, email := range []string{"ada@example.com", "grace@example.com"} {
+			user := &models.User{
+				First_name: stringPointer("First"),
+				Last_name:  stringPointer("Last"),
+				Email:      stringPointer(email),
+				Phone:      stringPointer(fmt.Sprintf("+4400000000%d", i)),
+				User_type:  stringPointer(models.UserTypeUser),
+				User_id:    stringPointer(fmt.Sprintf("u%d", i+1)),
+				Created_at: now.Add(time.Duration(i) * time.Second),
+				Updated_at: now,
+			}
+			if err := st.Users.Create(ctx, user); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		tests := []struct {
+			name  string
+			check func() error
+		}{
+			{name: "get by id", check: func() error {
+				user, err := st.Users.GetByID(ctx, "u1")
+				if err != nil {
+					return err
+				}
+				if *user.Email != "ada@example.com" {
+					return fmt.Errorf("email = %q", *user.Email)
+				}
+				return nil
+			}},
+			{name: "get by email", check: func() error {
+				user, err := st.Users.GetByEmail(ctx, "grace@example.com")
+				if err != nil {
+					return err
+				}
+				if *user.User_id != "u2" {
+					return fmt.Errorf("user id = %q", *user.User_id)
+				}
+				return nil
+			}},
+			{name: "unknown user", check: func() error {
+				if _, err := st.Users.GetByID(ctx, "nobody"); !errors.Is(err, ErrNotFound) {
+					return fmt.Errorf("err = %v, want ErrNotFound", err)
+				}
+				return nil
+			}},
+			{name: "email and phone exist", check: func() error {
+				email, err := st.Users.EmailExists(ctx, "ada@example.com")
+				if err != nil {
+					return err
+				}
+				phone, err := st.Users.PhoneExists(ctx, "+44000000001")
+				if err != nil {
+					return err
+				}
+				missing, err := st.Users.EmailExists(ctx, "nobody@example.com")
+				if err != nil {
+					return err
+				}
+				if !email || !phone || missing {
+					return fmt.Errorf("email exists %v, phone exists %v, unknown email exists %v", email, phone, missing)
+				}
+				return nil
+			}},
+			{name: "list pages in creation order", check: func() error {
+				users, total, err := st.Users.List(ctx, 1, 10)
+				if err != nil {
+					return err
+				}
+				if total != 2 || len(users) != 1 || *users[0].User_id != "u2" {
+					return fmt.Errorf("got %d users of %d", len(users), total)
+				}
+				return nil
+			}},
+			{name: "update unknown user", check: func() error {
+				if err := st.Users.Update(ctx, &models.User{User_id: stringPointer("nobody")}); !errors.Is(err, ErrNotFound) {
+					return fmt.Errorf("err = %v, want ErrNotFound", err)
+				}
+				return nil
+			}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if err := tt.check(); err != nil {
+					t.Fatal(err)
+				}
+			})
+		}
+	})
+}
+
+func TestDeletePendingDeletion(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	pending := models.StatusPendingDeletion
+	active := models.StatusActive
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	tests := []struct {
+		name        string
+		status      *string
+		deleteAfter *time.Time
+		wantDeleted bool
+	}{
+		{name: "grace period over", status: &pending, deleteAfter: &past, wantDeleted: true},
+		{name: "grace period running", status: &pending, deleteAfter: &future},
+		{name: "deletion cancelled", status: &active},
+		{name: "never scheduled"},
+	}
+	forEachBackend(t, func(t *testing.T, ctx context.Context, st *Store) {
+		for i, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				userId := fmt.Sprintf("u%d", i+1)
+				user := &models.User{
+					Email:        stringPointer(userId + "@example.com"),
+					User_type:    stringPointer(models.UserTypeUser),
+					User_id:      stringPointer(userId),
+					Status:       tt.status,
+					Delete_after: tt.deleteAfter,
+					Created_at:   now,
+					Updated_at:   now,
+				}
+				if err := st.Users.Create(ctx, user); err != nil {
+					t.Fatal(err)
+				}
+
+				err := st.Users.DeletePendingDeletion(ctx, userId, now)
+				if tt.wantDeleted && err != nil {
+					t.Fatal(err)
+				}
+				if !tt.wantDeleted && !errors.Is(err, ErrNotFound) {
+					t.Fatalf("err = %v, want ErrNotFound", err)
+				}
+				_, err = st.Users.GetByID(ctx, userId)
+				if deleted := errors.Is(err, ErrNotFound); deleted != tt.wantDeleted {
+					t.Errorf("deleted = %v, want %v", deleted, tt.wantDeleted)
+				}
+			})
+		}
+	})
+}
+
+func TestSessionRotation(t *testing.T) {
+	tests := []struct {
+		name string
+		// revoke revokes the session before rotating
+		revoke    bool
+		refreshId string
+		wantErr   error
+	}{
+		{name: "current refresh token", refreshId: "r1"},
+		{name: "reused refresh token", refreshId: "r0", wantErr: ErrNotFound},
+		{name: "revoked session", revoke: true, refreshId: "r1", wantErr: ErrNotFound},
+	}
+	forEachBackend(t, func(t *testing.T, ctx context.Context, st *Store) {
+		now := time.Now().UTC().Truncate(time.Second)
+		for i, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				sessionId := fmt.Sprintf("s%d", i+1)
+				session := &models.Session{
+					Session_id: sessionId,
+					User_id:    "u1",
+					Audience:   "go-jwt",
+					Scopes:     []string{"users:read", "account:read"},
+					Refresh_id: "r1",
+					Created_at: now,
+					Expires_at: now.Add(time.Hour),
+				}
+				if err := st.Sessions.Create(ctx, session); err != nil {
+					t.Fatal(err)
+				}
+				if tt.revoke {
+					if err := st.Sessions.Revoke(ctx, sessionId, now); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				expiresAt := now.Add(2 * time.Hour)
+				err := st.Sessions.Rotate(ctx, sessionId, tt.refreshId, "r2", []string{"users:read"}, expiresAt)
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Rotate() = %v, want %v", err, tt.wantErr)
+				}
+
+				got, err := st.Sessions.Get(ctx, sessionId)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if tt.wantErr != nil {
+					if got.Refresh_id != "r1" {
+						t.Errorf("refresh id = %q after a refused rotation", got.Refresh_id)
+					}
+					return
+				}
+				if got.Refresh_id != "r2" || len(got.Scopes) != 1 || !got.Expires_at.Equal(expiresAt) {
+					t.Errorf("session after rotation = %+v", got)
+				}
+				// The token just replaced cannot rotate the session again
+				if err := st.Sessions.Rotate(ctx, sessionId, "r1", "r3", got.Scopes, expiresAt); !errors.Is(err, ErrNotFound) {
+					t.Errorf("second Rotate() = %v, want ErrNotFound", err)
+				}
+			})
+		}
+	})
+}
+
+func TestRevokeSessionsByUser(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ctx context.Context, st *Store) {
+		now := time.Now().UTC().Truncate(time.Second)
+		for _, session := range []models.Session{
+			{Session_id: "s1", User_id: "u1", Created_at: now, Expires_at: now.Add(time.Hour)},
+			{Session_id: "s2", User_id: "u1", Created_at: now, Expires_at: now.Add(time.Hour)},
+			{Session_id: "s3", User_id: "u2", Created_at: now, Expires_at: now.Add(time.Hour)},
+		} {
+			if err := st.Sessions.Create(ctx, &session); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := st.Sessions.RevokeByUser(ctx, "u1", now); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, tt := range []struct {
+			userId      string
+			wantRevoked bool
+		}{
+			{userId: "u1", wantRevoked: true},
+			{userId: "u2", wantRevoked: false},
+		} {
+			sessions, err := st.Sessions.ListByUser(ctx, tt.userId)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, session := range sessions {
+				if revoked := session.Revoked_at != nil; revoked != tt.wantRevoked {
+					t.Errorf("session %s revoked = %v, want %v", session.Session_id, revoked, tt.wantRevoked)
+				}
+			}
+		}
+	})
+}
+
+func TestAPIKeys(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ctx context.Context, st *Store) {
+		now := time.Now().UTC().Truncate(time.Second)
+		key := &models.APIKey{
+			Key_id:     "k1",
+			User_id:    "u1",
+			Name:       "ci",
+			Prefix:     "gjk_abcd",
+			Key_hash:   "hash",
+			Scopes:     []string{"users:read"},
+			Created_at: now,
+		}
+		if err := st.APIKeys.Create(ctx, key); err != nil {
+			t.Fatal(err)
+		}
+		duplicate := *key
+		duplicate.Key_id = "k2"
+		if err := st.APIKeys.Create(ctx, &duplicate); !errors.Is(err, ErrConflict) {
+			t.Fatalf("Create() with a taken prefix = %v, want %v", err, ErrConflict)
+		}
+
+		tests := []struct {
+			name    string
+			userId  string
+			wantErr error
+		}{
+			{name: "key of another user", userId: "u2", wantErr: ErrNotFound},
+			{name: "own key", userId: "u1"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if err := st.APIKeys.Revoke(ctx, tt.userId, "k1", now); !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Revoke() = %v, want %v", err, tt.wantErr)
+				}
+				got, err := st.APIKeys.GetByPrefix(ctx, "gjk_abcd")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if revoked := got.Revoked_at != nil; revoked != (tt.wantErr == nil) {
+					t.Errorf("revoked = %v", revoked)
+				}
+			})
+		}
+	})
+}
+
+func TestDeviceAuthorizationRedeemedOnce(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ctx context.Context, st *Store) {
+		now := time.Now().UTC().Truncate(time.Second)
+		auth := &models.DeviceAuthorization{
+			Device_code_hash: "hash",
+			User_code:        "ABCD-EFGH",
+			Client_id:        "tv",
+			Status:           models.DeviceStatusApproved,
+			Interval:         5,
+			Created_at:       now,
+			Expires_at:       now.Add(10 * time.Minute),
+		}
+		if err := st.DeviceAuthorizations.Create(ctx, auth); err != nil {
+			t.Fatal(err)
+		}
+		for i, want := range []error{nil, ErrNotFound} {
+			if err := st.DeviceAuthorizations.Delete(ctx, "hash"); !errors.Is(err, want) {
+				t.Errorf("Delete() %d = %v, want %v", i+1, err, want)
+			}
+		}
+	})
+}
+
+func TestDeviceAuthorizationDecidedOnce(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ctx context.Context, st *Store) {
+		now := time.Now().UTC().Truncate(time.Second)
+		auth := &models.DeviceAuthorization{
+			Device_code_hash: "hash",
+			User_code:        "ABCD-EFGH",
+			Client_id:        "tv",
+			Status:           models.DeviceStatusPending,
+			Interval:         5,
+			Created_at:       now,
+			Expires_at:       now.Add(10 * time.Minute),
+		}
+		if err := st.DeviceAuthorizations.Create(ctx, auth); err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			name    string
+			status  string
+			userId  string
+			wantErr error
+		}{
+			{name: "first decision", status: models.DeviceStatusApproved, userId: "u1"},
+			{name: "conflicting decision", status: models.DeviceStatusDenied, wantErr: ErrNotFound},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if err := st.DeviceAuthorizations.Decide(ctx, "hash", tt.status, tt.userId); !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Decide() = %v, want %v", err, tt.wantErr)
+				}
+			})
+		}
+
+		// A poll that read the grant before the approval only records itself
+		if err := st.DeviceAuthorizations.RecordPoll(ctx, "hash", now, 10); err != nil {
+			t.Fatal(err)
+		}
+		got, err := st.DeviceAuthorizations.GetByDeviceCode(ctx, "hash")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Status != models.DeviceStatusApproved || got.User_id != "u1" || got.Interval != 10 || got.Last_polled_at == nil {
+			t.Errorf("grant = %+v, want approved by u1 with the poll recorded", got)
+		}
+		if err := st.DeviceAuthorizations.RecordPoll(ctx, "gone", now, 10); !errors.Is(err, ErrNotFound) {
+			t.Errorf("RecordPoll() of a missing grant = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestAuditEvents(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, ctx context.Context, st *Store) {
+		if _, err := st.AuditEvents.Last(ctx); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Last() on an empty log = %v, want ErrNotFound", err)
+		}
+		now := time.Now().UTC().Truncate(time.Second)
+		for i, actor := range []string{"u1", "u2", "u1"} {
+			event := &models.AuditEvent{Sequence: int64(i + 1), Time: now, Action: "user.login", Outcome: "SUCCESS", Actor_id: actor, Hash: fmt.Sprint(i)}
+			if err := st.AuditEvents.Append(ctx, event); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := st.AuditEvents.Append(ctx, &models.AuditEvent{Sequence: 2, Time: now}); !errors.Is(err, ErrConflict) {
+			t.Errorf("Append() of a taken sequence = %v, want ErrConflict", err)
+		}
+
+		tests := []struct {
+			name  string
+			query AuditQuery
+			want  []int64
+		}{
+			{name: "everything", want: []int64{1, 2, 3}},
+			{name: "by actor", query: AuditQuery{ActorId: "u1"}, want: []int64{1, 3}},
+			{name: "after", query: AuditQuery{After: 1}, want: []int64{2, 3}},
+			{name: "limit", query: AuditQuery{Limit: 2}, want: []int64{1, 2}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				events, err := st.AuditEvents.List(ctx, tt.query)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var got []int64
+				for _, event := range events {
+					got = append(got, event.Sequence)
+				}
+				if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+					t.Errorf("sequences = %v, want %v", got, tt.want)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package verifier
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/arunprasad2002/go-jwt/dpop"
+)
+
+// Confirmation is the cnf claim of a sender-constrained token (RFC 7800).
+type Confirmation struct {
+	// JKT is the JWK thumbprint of the key DPoP proofs must be signed with (RFC 9449)
+	JKT string `json:"jkt,omitempty"`
+	// X5tS256 is the thumbprint of the client certificate the token must be used with (RFC 8705)
+	X5tS256 string `json:"x5t#S256,omitempty"`
+}
+
+// Binding checks that the client presenting a token holds the key the token
+// is bound to by cnf.
+type Binding func(cnf *Confirmation) error
+
+// RequestToken extracts the token from an Authorization header with the Bearer
+// or DPoP scheme and returns the scheme as well.
+func RequestToken(r *http.Request) (token string, scheme string) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	switch {
+	case !found:
+		return "", ""
+	case strings.EqualFold(scheme, "Bearer"):
+		return strings.TrimSpace(token), "Bearer"
+	case strings.EqualFold(scheme, "DPoP"):
+		return strings.TrimSpace(token), "DPoP"
+	}
+	return "", ""
+}
+
+// VerifyRequest verifies the token of r like Verify, also accepting tokens bound
+// to the client. Certificate bound tokens must come over a TLS connection
+// authenticated with that certificate, DPoP bound tokens with the DPoP scheme
+// and a proof signed with their key.
+func (v *Verifier) VerifyRequest(r *http.Request, requiredScopes ...string) (*Claims, error) {
+	token, scheme := RequestToken(r)
+	claims, err := v.VerifyBound(r.Context(), token, v.requestBinding(r, token, scheme), requiredScopes...)
+	if claims != nil && scheme == "DPoP" && (claims.Cnf == nil || claims.Cnf.JKT == "") {
+		return nil, fmt.Errorf("%w: token is not DPoP bound", ErrInvalidToken)
+	}
+	return claims, err
+}
+
+// requestBinding checks the proofs of possession sent with r
+func (v *Verifier) requestBinding(r *http.Request, token string, scheme string) Binding {
+	return func(cnf *Confirmation) error {
+		if cnf.X5tS256 != "" {
+			cert := clientCertificate(r)
+			if cert == nil || certificateThumbprint(cert) != cnf.X5tS256 {
+				return errors.New("token is bound to a client certificate that was not presented")
+			}
+		}
+		if cnf.JKT != "" {
+			// Sending a bound token as a bearer token would skip the proof
+			if scheme != "DPoP" {
+				return errors.New("DPoP bound tokens must be sent with the DPoP authorization scheme")
+			}
+			proofs := r.Header.Values("DPoP")
+			if len(proofs) != 1 {
+				return errors.New("exactly one DPoP proof is required")
+			}
+			jkt, err := v.dpop.Verify(proofs[0], r.Method, dpop.RequestURL(r), token)
+			if err != nil {
+				return err
+			}
+			if jkt != cnf.JKT {
+				return errors.New("DPoP proof is not signed with the key the token is bound to")
+			}
+		}
+		return nil
+	}
+}
+
+// clientCertificate returns the client certificate of the request if the
+// server verified it, nil otherwise
+func clientCertificate(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return r.TLS.VerifiedChains[0][0]
+}
+
+// certificateThumbprint returns the x5t#S256 of cert
+func certificateThumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
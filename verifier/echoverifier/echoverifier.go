@@ -0,0 +1,39 @@
+// Package echoverifier adapts a verifier.Verifier to Echo.
+package echoverifier
+
+import (
+	"github.com/arunprasad2002/go-jwt/verifier"
+	"github.com/labstack/echo/v4"
+)
+
+// ClaimsKey is the Echo context key the claims are stored under.
+const ClaimsKey = "claims"
+
+// Middleware rejects requests without a valid access token and stores the claims
+// in the Echo context and the request context.
+func Middleware(v *verifier.Verifier) echo.MiddlewareFunc {
+	return RequireScopes(v)
+}
+
+// RequireScopes is like Middleware but also requires the token to grant scopes.
+func RequireScopes(v *verifier.Verifier, scopes ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			claims, err := v.VerifyRequest(req, scopes...)
+			if err != nil {
+				status, challenge := v.Challenge(err, scopes...)
+				c.Response().Header().Set("WWW-Authenticate", challenge)
+				return c.JSON(status, map[string]string{"error": err.Error()})
+			}
+			c.Set(ClaimsKey, claims)
+			c.SetRequest(req.WithContext(verifier.WithClaims(req.Context(), claims)))
+			return next(c)
+		}
+	}
+}
+
+// Claims returns the claims stored by the middleware.
+func Claims(c echo.Context) (*verifier.Claims, bool) {
+	return verifier.ClaimsFromContext(c.Request().Context())
+}
@@ -0,0 +1,37 @@
+// Package ginverifier adapts a verifier.Verifier to Gin.
+package ginverifier
+
+import (
+	"github.com/arunprasad2002/go-jwt/verifier"
+	"github.com/gin-gonic/gin"
+)
+
+// ClaimsKey is the Gin context key the claims are stored under.
+const ClaimsKey = "claims"
+
+// Middleware rejects requests without a valid access token and stores the claims
+// in the Gin context and the request context.
+func Middleware(v *verifier.Verifier) gin.HandlerFunc {
+	return RequireScopes(v)
+}
+
+// RequireScopes is like Middleware but also requires the token to grant scopes.
+func RequireScopes(v *verifier.Verifier, scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := v.VerifyRequest(c.Request, scopes...)
+		if err != nil {
+			status, challenge := v.Challenge(err, scopes...)
+			c.Header("WWW-Authenticate", challenge)
+			c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.Set(ClaimsKey, claims)
+		c.Request = c.Request.WithContext(verifier.WithClaims(c.Request.Context(), claims))
+		c.Next()
+	}
+}
+
+// Claims returns the claims stored by the middleware.
+func Claims(c *gin.Context) (*verifier.Claims, bool) {
+	return verifier.ClaimsFromContext(c.Request.Context())
+}
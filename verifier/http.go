@@ -0,0 +1,79 @@
+package verifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type contextKey struct{}
+
+// WithClaims returns a copy of ctx carrying claims.
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, contextKey{}, claims)
+}
+
+// ClaimsFromContext returns the claims stored by the middleware.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(contextKey{}).(*Claims)
+	return claims, ok
+}
+
+// BearerToken extracts the token from an Authorization: Bearer header.
+func BearerToken(r *http.Request) string {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// Middleware rejects requests without a valid access token and stores the
+// claims in the request context. It is also a chi middleware.
+func (v *Verifier) Middleware(next http.Handler) http.Handler {
+	return v.RequireScopes()(next)
+}
+
+// RequireScopes is like Middleware but also requires the token to grant scopes.
+func (v *Verifier) RequireScopes(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, err := v.VerifyRequest(r, scopes...)
+			if err != nil {
+				v.WriteError(w, err, scopes...)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithClaims(r.Context(), claims)))
+		})
+	}
+}
+
+// Challenge returns the status code and WWW-Authenticate header for a Verify error (RFC 6750).
+func (v *Verifier) Challenge(err error, scopes ...string) (int, string) {
+	realm := v.opts.Realm
+	if realm == "" {
+		realm = "api"
+	}
+	header := fmt.Sprintf("Bearer realm=%q", realm)
+
+	switch {
+	case errors.Is(err, ErrNoToken):
+		return http.StatusUnauthorized, header
+	case errors.Is(err, ErrInsufficientScope):
+		return http.StatusForbidden, header + fmt.Sprintf(`, error="insufficient_scope", scope=%q`, strings.Join(scopes, " "))
+	default:
+		return http.StatusUnauthorized, header + `, error="invalid_token"`
+	}
+}
+
+// WriteError writes the JSON error response for a Verify error.
+func (v *Verifier) WriteError(w http.ResponseWriter, err error, scopes ...string) {
+	status, challenge := v.Challenge(err, scopes...)
+	w.Header().Set("WWW-Authenticate", challenge)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
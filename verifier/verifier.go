@@ -0,0 +1,384 @@
+// Package verifier lets downstream services validate access tokens issued by
+// this service without calling it on every request.
+//
+// A Verifier fetches the service's JWK Set, caches it in memory (and
+// optionally on disk), refreshes it in the background and refetches it when a
+// token is signed with a key it has not seen yet. Once keys are cached it
+// keeps working while the issuer is unreachable.
+//
+// Tokens bound to a DPoP key or a client certificate are only accepted with
+// proof that the client holds that key, which VerifyRequest and the
+// middleware check. Verify rejects them.
+//
+// Middleware adapters are provided for net/http (which chi uses directly:
+// r.Use(v.Middleware)), Gin (package ginverifier) and Echo (package
+// echoverifier).
+package verifier
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arunprasad2002/go-jwt/dpop"
+	"github.com/arunprasad2002/go-jwt/jwk"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrNoToken           = errors.New("verifier: no bearer token")
+	ErrInvalidToken      = errors.New("verifier: invalid token")
+	ErrInsufficientScope = errors.New("verifier: insufficient scope")
+)
+
+// Claims are the claims of an access token issued by the service.
+type Claims struct {
+	// Token_use is "access" for access tokens, Verify rejects any other token
+	Token_use  string `json:"token_use"`
+	Email      string `json:"email,omitempty"`
+	First_name string `json:"first_name,omitempty"`
+	Last_name  string `json:"last_name,omitempty"`
+	Uid        string `json:"uid,omitempty"`
+	User_type  string `json:"user_type,omitempty"`
+	Scope      string `json:"scope,omitempty"`
+	// Act is set on tokens obtained by token exchange and names the service acting for the user
+	Act *Actor `json:"act,omitempty"`
+	// Cnf is set on tokens bound to a key of the client
+	Cnf *Confirmation `json:"cnf,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Actor is an RFC 8693 act claim; Act holds the previous actor in a delegation chain.
+type Actor struct {
+	Subject string `json:"sub"`
+	Act     *Actor `json:"act,omitempty"`
+}
+
+// Scopes returns the space separated scope claim as a list.
+func (c *Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// HasScopes reports whether the token grants every one of scopes.
+func (c *Claims) HasScopes(scopes ...string) bool {
+	granted := map[string]bool{}
+	for _, scope := range c.Scopes() {
+		granted[scope] = true
+	}
+	for _, scope := range scopes {
+		if !granted[scope] {
+			return false
+		}
+	}
+	return true
+}
+
+// Options configures a Verifier. Only JWKSURL is required.
+type Options struct {
+	// JWKSURL is the issuer's JWK Set, e.g. https://auth.example.com/.well-known/jwks.json
+	JWKSURL string
+	// Issuer and Audience are enforced when set.
+	Issuer   string
+	Audience string
+	// Algorithms allowed for signatures. Defaults to RS256 and ES256.
+	Algorithms []string
+	// Leeway tolerates clock skew when checking exp, nbf and iat.
+	Leeway time.Duration
+	// RefreshInterval is how often keys are refetched in the background. Defaults to 10 minutes.
+	RefreshInterval time.Duration
+	// MinRefreshInterval limits refetches triggered by unknown key IDs. Defaults to 30 seconds.
+	MinRefreshInterval time.Duration
+	// CacheFile, when set, persists the JWK Set so a restarted service can start while the issuer is down.
+	CacheFile string
+	// Realm is sent in WWW-Authenticate challenges.
+	Realm string
+	// HTTPClient fetches the JWK Set. Defaults to a client with a 10 second timeout.
+	HTTPClient *http.Client
+	// Logger reports failed key refreshes. Defaults to slog.Default().
+	Logger *slog.Logger
+}
+
+type verificationKey struct {
+	algorithm string
+	public    crypto.PublicKey
+}
+
+// Verifier validates tokens against the issuer's published keys.
+type Verifier struct {
+	opts   Options
+	parser *jwt.Parser
+
+	mu          sync.RWMutex
+	keys        map[string]verificationKey
+	lastRefresh time.Time
+	refreshMu   sync.Mutex
+
+	// dpop checks DPoP proofs and holds the ones already used
+	dpop *dpop.Verifier
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New creates a Verifier and loads its keys, from the cache file if the issuer
+// cannot be reached. Background refreshing stops when ctx is cancelled or Close is called.
+func New(ctx context.Context, opts Options) (*Verifier, error) {
+	if opts.JWKSURL == "" {
+		return nil, errors.New("verifier: JWKSURL is required")
+	}
+	if len(opts.Algorithms) == 0 {
+		opts.Algorithms = []string{"RS256", "ES256"}
+	}
+	if opts.RefreshInterval <= 0 {
+		opts.RefreshInterval = 10 * time.Minute
+	}
+	if opts.MinRefreshInterval <= 0 {
+		opts.MinRefreshInterval = 30 * time.Second
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+
+	parserOpts := []jwt.ParserOption{
+		jwt.WithValidMethods(opts.Algorithms),
+		jwt.WithLeeway(opts.Leeway),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	}
+	if opts.Issuer != "" {
+		parserOpts = append(parserOpts, jwt.WithIssuer(opts.Issuer))
+	}
+	if opts.Audience != "" {
+		parserOpts = append(parserOpts, jwt.WithAudience(opts.Audience))
+	}
+
+	v := &Verifier{
+		opts:   opts,
+		parser: jwt.NewParser(parserOpts...),
+		keys:   map[string]verificationKey{},
+		done:   make(chan struct{}),
+
+		dpop: dpop.NewVerifier(opts.Leeway),
+	}
+
+	if opts.CacheFile != "" {
+		if set, err := readCache(opts.CacheFile); err == nil {
+			v.setKeys(set)
+		}
+	}
+	if err := v.refresh(ctx); err != nil {
+		if v.keyCount() == 0 {
+			return nil, err
+		}
+		opts.Logger.Warn("verifier: using cached keys, fetching keys failed", "url", opts.JWKSURL, "error", err)
+	}
+
+	ctx, v.cancel = context.WithCancel(ctx)
+	go v.refreshLoop(ctx)
+	return v, nil
+}
+
+// Close stops background refreshing.
+func (v *Verifier) Close() {
+	v.cancel()
+	<-v.done
+}
+
+// Verify validates token and checks that it grants all of requiredScopes.
+// Tokens bound to a key of the client are rejected, see VerifyRequest.
+func (v *Verifier) Verify(ctx context.Context, token string, requiredScopes ...string) (*Claims, error) {
+	return v.VerifyBound(ctx, token, nil, requiredScopes...)
+}
+
+// VerifyBound is like Verify but accepts tokens bound to a key of the client
+// when binding confirms the client holds it.
+func (v *Verifier) VerifyBound(ctx context.Context, token string, binding Binding, requiredScopes ...string) (*Claims, error) {
+	if token == "" {
+		return nil, ErrNoToken
+	}
+
+	claims := &Claims{}
+	_, err := v.parser.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		if kid == "" {
+			return nil, errors.New("token has no key ID")
+		}
+		key, ok := v.lookup(ctx, kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown key ID %q", kid)
+		}
+		if t.Method.Alg() != key.algorithm {
+			return nil, fmt.Errorf("key %q does not allow %s", kid, t.Method.Alg())
+		}
+		return key.public, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	// Refresh tokens are signed with the same keys but only the issuer accepts them
+	if claims.Token_use != "access" {
+		return nil, fmt.Errorf("%w: not an access token", ErrInvalidToken)
+	}
+	// A stolen bound token is worthless only if the proof of possession is checked
+	if claims.Cnf != nil && (claims.Cnf.JKT != "" || claims.Cnf.X5tS256 != "") {
+		if binding == nil {
+			return nil, fmt.Errorf("%w: token is bound to a key of the client", ErrInvalidToken)
+		}
+		if err := binding(claims.Cnf); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+		}
+	}
+
+	if !claims.HasScopes(requiredScopes...) {
+		return claims, fmt.Errorf("%w: requires %s", ErrInsufficientScope, strings.Join(requiredScopes, " "))
+	}
+	return claims, nil
+}
+
+// lookup finds a key, refetching the JWK Set once if the key ID is unknown.
+func (v *Verifier) lookup(ctx context.Context, kid string) (verificationKey, bool) {
+	v.mu.RLock()
+	key, ok := v.keys[kid]
+	lastRefresh := v.lastRefresh
+	v.mu.RUnlock()
+	if ok {
+		return key, true
+	}
+
+	if time.Since(lastRefresh) < v.opts.MinRefreshInterval {
+		return verificationKey{}, false
+	}
+	if err := v.refresh(ctx); err != nil {
+		v.opts.Logger.Warn("verifier: refreshing keys for unknown key ID failed", "kid", kid, "error", err)
+	}
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	key, ok = v.keys[kid]
+	return key, ok
+}
+
+func (v *Verifier) refreshLoop(ctx context.Context) {
+	defer close(v.done)
+	ticker := time.NewTicker(v.opts.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := v.refresh(ctx); err != nil {
+				v.opts.Logger.Warn("verifier: refreshing keys failed, keeping cached keys", "error", err)
+			}
+		}
+	}
+}
+
+// refresh fetches the JWK Set. On failure the current keys are kept.
+func (v *Verifier) refresh(ctx context.Context) error {
+	v.refreshMu.Lock()
+	defer v.refreshMu.Unlock()
+
+	v.mu.Lock()
+	v.lastRefresh = time.Now()
+	v.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.opts.JWKSURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := v.opts.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching %s: %s", v.opts.JWKSURL, resp.Status)
+	}
+
+	var set jwk.Set
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("decoding %s: %w", v.opts.JWKSURL, err)
+	}
+	v.setKeys(set)
+
+	if v.opts.CacheFile != "" {
+		if err := writeCache(v.opts.CacheFile, set); err != nil {
+			v.opts.Logger.Warn("verifier: writing key cache failed", "error", err)
+		}
+	}
+	return nil
+}
+
+func (v *Verifier) setKeys(set jwk.Set) {
+	allowed := map[string]bool{}
+	for _, alg := range v.opts.Algorithms {
+		allowed[alg] = true
+	}
+
+	keys := map[string]verificationKey{}
+	for _, k := range set.Keys {
+		if k.Kid == "" || !allowed[k.Alg] || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		public, err := k.PublicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = verificationKey{algorithm: k.Alg, public: public}
+	}
+
+	v.mu.Lock()
+	v.keys = keys
+	v.mu.Unlock()
+}
+
+func (v *Verifier) keyCount() int {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return len(v.keys)
+}
+
+func readCache(path string) (jwk.Set, error) {
+	var set jwk.Set
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return set, err
+	}
+	err = json.Unmarshal(content, &set)
+	return set, err
+}
+
+func writeCache(path string, set jwk.Set) error {
+	content, err := json.Marshal(set)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".jwks-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,305 @@
+package verifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arunprasad2002/go-jwt/keyring"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testIssuer   = "https://auth.example.com"
+	testAudience = "api"
+)
+
+// jwksServer serves the JWK Set of a key ring and counts how often it is fetched
+type jwksServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	ring    *keyring.Ring
+	fetches int
+}
+
+func newJWKSServer(t *testing.T, ring *keyring.Ring) *jwksServer {
+	s := &jwksServer{ring: ring}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.fetches++
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.ring.JWKS())
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// rotate makes the server publish the keys of ring instead
+func (s *jwksServer) rotate(ring *keyring.Ring) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ring = ring
+}
+
+func (s *jwksServer) fetchCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fetches
+}
+
+func newRing(t *testing.T) *keyring.Ring {
+	signing, err := keyring.Generate("ES256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ring, err := keyring.New(signing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ring
+}
+
+func newVerifier(t *testing.T, opts Options) *Verifier {
+	opts.Issuer = testIssuer
+	opts.Audience = testAudience
+	opts.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	v, err := New(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(v.Close)
+	return v
+}
+
+func validClaims() *Claims {
+	now := time.Now()
+	return &Claims{
+		Token_use: "access",
+		Uid:       "u1",
+		Scope:     "users:read users:write",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    testIssuer,
+			Subject:   "u1",
+			Audience:  jwt.ClaimStrings{testAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(5 * time.Minute)),
+		},
+	}
+}
+
+// sign signs claims with the signing key of ring
+func sign(t *testing.T, ring *keyring.Ring, claims *Claims) string {
+	key, ok := ring.Signing()
+	if !ok {
+		t.Fatal("ring has no signing key")
+	}
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+	signed, err := token.SignedString(key.Private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestVerify(t *testing.T) {
+	ring := newRing(t)
+	server := newJWKSServer(t, ring)
+	v := newVerifier(t, Options{JWKSURL: server.URL, Leeway: time.Minute, MinRefreshInterval: time.Hour})
+
+	tests := []struct {
+		name    string
+		token   func(claims *Claims) string
+		scopes  []string
+		wantErr error
+	}{
+		{name: "valid", scopes: []string{"users:read"}},
+		{name: "all scopes granted", scopes: []string{"users:read", "users:write"}},
+		{name: "missing scope", scopes: []string{"admin"}, wantErr: ErrInsufficientScope},
+		{name: "no token", token: func(claims *Claims) string { return "" }, wantErr: ErrNoToken},
+		{name: "other issuer", token: func(claims *Claims) string {
+			claims.Issuer = "https://evil.example.com"
+			return sign(t, ring, claims)
+		}, wantErr: ErrInvalidToken},
+		{name: "other audience", token: func(claims *Claims) string {
+			claims.Audience = jwt.ClaimStrings{"other"}
+			return sign(t, ring, claims)
+		}, wantErr: ErrInvalidToken},
+		{name: "expired", token: func(claims *Claims) string {
+			claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-2 * time.Minute))
+			return sign(t, ring, claims)
+		}, wantErr: ErrInvalidToken},
+		{name: "expired within leeway", token: func(claims *Claims) string {
+			claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-30 * time.Second))
+			return sign(t, ring, claims)
+		}},
+		{name: "no expiry", token: func(claims *Claims) string {
+			claims.ExpiresAt = nil
+			return sign(t, ring, claims)
+		}, wantErr: ErrInvalidToken},
+		{name: "refresh token", token: func(claims *Claims) string {
+			claims.Token_use = "refresh"
+			return sign(t, ring, claims)
+		}, wantErr: ErrInvalidToken},
+		{name: "DPoP bound token", token: func(claims *Claims) string {
+			claims.Cnf = &Confirmation{JKT: "thumbprint"}
+			return sign(t, ring, claims)
+		}, wantErr: ErrInvalidToken},
+		{name: "signed by an unpublished key", token: func(claims *Claims) string {
+			return sign(t, newRing(t), claims)
+		}, wantErr: ErrInvalidToken},
+		{name: "HMAC signed", token: func(claims *Claims) string {
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+			key, _ := ring.Signing()
+			token.Header["kid"] = key.ID
+			signed, err := token.SignedString([]byte("secret"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return signed
+		}, wantErr: ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := sign(t, ring, validClaims())
+			if tt.token != nil {
+				token = tt.token(validClaims())
+			}
+			claims, err := v.Verify(context.Background(), token, tt.scopes...)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && claims.Uid != "u1" {
+				t.Errorf("Uid = %q, want u1", claims.Uid)
+			}
+		})
+	}
+}
+
+func TestVerifierCachesKeys(t *testing.T) {
+	ring := newRing(t)
+	server := newJWKSServer(t, ring)
+	v := newVerifier(t, Options{JWKSURL: server.URL})
+
+	for i := 0; i < 5; i++ {
+		if _, err := v.Verify(context.Background(), sign(t, ring, validClaims())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := server.fetchCount(); got != 1 {
+		t.Errorf("fetched the JWK Set %d times, want 1", got)
+	}
+}
+
+func TestVerifierRefreshesKeys(t *testing.T) {
+	ring := newRing(t)
+	server := newJWKSServer(t, ring)
+	v := newVerifier(t, Options{JWKSURL: server.URL, RefreshInterval: 10 * time.Millisecond, MinRefreshInterval: time.Hour})
+
+	// The rotated key is unknown, the refetch it triggers is rate limited
+	rotated := newRing(t)
+	server.rotate(rotated)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, err := v.Verify(context.Background(), sign(t, rotated, validClaims()))
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Verify() with the rotated key = %v after refreshing in the background", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := v.Verify(context.Background(), sign(t, ring, validClaims())); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Verify() with the key no longer published = %v, want %v", err, ErrInvalidToken)
+	}
+}
+
+func TestVerifierRefetchesUnknownKeys(t *testing.T) {
+	tests := []struct {
+		name               string
+		minRefreshInterval time.Duration
+		wantErr            error
+		wantFetches        int
+	}{
+		// Once fetched the key is known, later tokens do not refetch
+		{name: "refetched", minRefreshInterval: time.Nanosecond, wantFetches: 2},
+		{name: "rate limited", minRefreshInterval: time.Hour, wantErr: ErrInvalidToken, wantFetches: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newJWKSServer(t, newRing(t))
+			v := newVerifier(t, Options{JWKSURL: server.URL, MinRefreshInterval: tt.minRefreshInterval})
+
+			rotated := newRing(t)
+			server.rotate(rotated)
+			for i := 0; i < 3; i++ {
+				if _, err := v.Verify(context.Background(), sign(t, rotated, validClaims())); !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Verify() = %v, want %v", err, tt.wantErr)
+				}
+			}
+			if got := server.fetchCount(); got != tt.wantFetches {
+				t.Errorf("fetched the JWK Set %d times, want %d", got, tt.wantFetches)
+			}
+		})
+	}
+}
+
+func TestVerifierStartsFromCacheFile(t *testing.T) {
+	ring := newRing(t)
+	server := newJWKSServer(t, ring)
+	cacheFile := filepath.Join(t.TempDir(), "jwks.json")
+
+	online := newVerifier(t, Options{JWKSURL: server.URL, CacheFile: cacheFile})
+	online.Close()
+	server.Close()
+
+	corrupt := filepath.Join(t.TempDir(), "corrupt.json")
+	if err := os.WriteFile(corrupt, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		cacheFile string
+		wantErr   bool
+	}{
+		{name: "cached keys", cacheFile: cacheFile},
+		{name: "no cache file", cacheFile: filepath.Join(t.TempDir(), "missing.json"), wantErr: true},
+		{name: "corrupt cache file", cacheFile: corrupt, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := New(context.Background(), Options{
+				JWKSURL:   server.URL,
+				CacheFile: tt.cacheFile,
+				Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+			})
+			if tt.wantErr {
+				if err == nil {
+					v.Close()
+					t.Fatal("New() succeeded while the issuer is down and no keys are cached")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer v.Close()
+			if _, err := v.Verify(context.Background(), sign(t, ring, validClaims())); err != nil {
+				t.Errorf("Verify() with cached keys = %v", err)
+			}
+		})
+	}
+}
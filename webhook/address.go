@@ -0,0 +1,73 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+var (
+	ErrInsecureURL    = errors.New("webhook URL must use https")
+	ErrPrivateAddress = errors.New("webhook receivers must have a public address")
+)
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598), not routable on the internet
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// CheckURL reports whether receivers at raw may be subscribed. They must use
+// https and must not be on a private, loopback or link-local address, unless
+// allowInsecure is set for development. Host names are checked again by the
+// dispatcher once resolved.
+func CheckURL(raw string, allowInsecure bool) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return errors.New("webhook URL must be an absolute http or https URL")
+	}
+	switch u.Scheme {
+	case "https":
+	case "http":
+		if !allowInsecure {
+			return ErrInsecureURL
+		}
+	default:
+		return errors.New("webhook URL must be an absolute http or https URL")
+	}
+	if allowInsecure {
+		return nil
+	}
+	host := u.Hostname()
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return ErrPrivateAddress
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && !publicAddress(addr) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+// publicAddress reports whether addr may receive webhooks
+func publicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddressSpace.Contains(addr)
+}
+
+// checkDial refuses connections to addresses that are not public. It runs
+// after name resolution, so a host name cannot lead to an internal service.
+func checkDial(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !publicAddress(addr) {
+		return fmt.Errorf("%w, %s is not", ErrPrivateAddress, addr)
+	}
+	return nil
+}
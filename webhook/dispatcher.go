@@ -0,0 +1,255 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/arunprasad2002/go-jwt/models"
+	"github.com/arunprasad2002/go-jwt/store"
+)
+
+// MaxAttempts is how often a delivery is tried before it is marked DEAD
+const MaxAttempts = 8
+
+// batchSize bounds the events and deliveries handled in one pass
+const batchSize = 100
+
+// defaultConcurrency is how many deliveries NewDispatcher attempts at once
+const defaultConcurrency = 8
+
+// Backoff returns how long to wait after the given number of failed attempts:
+// 30 seconds doubling each time up to 6 hours, with up to 10% jitter so
+// receivers that were down are not hit by every retry at once.
+func Backoff(attempts int) time.Duration {
+	delay := 6 * time.Hour
+	if attempts < 20 {
+		delay = min(30*time.Second<<(attempts-1), delay)
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay/10)+1))
+}
+
+// Dispatcher fans outbox events out to subscriptions and delivers them.
+// Deliveries are at least once, receivers should ignore webhook-ids they have
+// already seen.
+type Dispatcher struct {
+	Store  *store.Store
+	Client *http.Client
+	// Concurrency bounds the deliveries attempted at once, one at a time if not positive
+	Concurrency int
+}
+
+// NewDispatcher returns a Dispatcher whose client gives up on a receiver after
+// 10 seconds and does not follow redirects. It refuses to connect to private,
+// loopback and link-local addresses unless allowPrivate is set for development.
+func NewDispatcher(st *store.Store, allowPrivate bool) *Dispatcher {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !allowPrivate {
+		dialer := &net.Dialer{Timeout: 10 * time.Second, Control: checkDial}
+		transport.DialContext = dialer.DialContext
+		// A proxy would connect to the receiver for us, out of reach of the check
+		transport.Proxy = nil
+	}
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   10 * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return &Dispatcher{Store: st, Client: client, Concurrency: defaultConcurrency}
+}
+
+// Run dispatches every interval until ctx is cancelled
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			dispatchCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+			if err := d.Dispatch(dispatchCtx); err != nil {
+				slog.Error("failed to dispatch webhooks", "error", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// Dispatch creates the deliveries of pending events and attempts the deliveries
+// that are due, Concurrency at a time. A delivery that fails is logged and
+// does not stop the others.
+func (d *Dispatcher) Dispatch(ctx context.Context) error {
+	if err := d.fanOut(ctx); err != nil {
+		return err
+	}
+	deliveries, err := d.Store.WebhookDeliveries.ListDue(ctx, time.Now(), batchSize)
+	if err != nil {
+		return err
+	}
+
+	slots := make(chan struct{}, max(d.Concurrency, 1))
+	var wg sync.WaitGroup
+	for i := range deliveries {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(delivery *models.WebhookDelivery) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			if err := d.deliver(ctx, delivery); err != nil {
+				slog.Error("failed to attempt webhook delivery", "delivery_id", delivery.Delivery_id,
+					"subscription_id", delivery.Subscription_id, "error", err)
+			}
+		}(&deliveries[i])
+	}
+	wg.Wait()
+	return nil
+}
+
+// fanOut creates a delivery of each pending event for every subscription that
+// wants it. Delivery ids are derived from the event and subscription, so an
+// event that was fanned out before a crash is not delivered twice.
+func (d *Dispatcher) fanOut(ctx context.Context) error {
+	events, err := d.Store.WebhookEvents.ListPending(ctx, batchSize)
+	if err != nil || len(events) == 0 {
+		return err
+	}
+	subscriptions, err := d.Store.WebhookSubscriptions.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		for _, subscription := range subscriptions {
+			if !slices.Contains(subscription.Events, event.Type) {
+				continue
+			}
+			now := time.Now()
+			delivery := models.WebhookDelivery{
+				Delivery_id:     deliveryID(event.Event_id, subscription.Subscription_id),
+				Event_id:        event.Event_id,
+				Event_type:      event.Type,
+				Subscription_id: subscription.Subscription_id,
+				Status:          models.WebhookPending,
+				Next_attempt_at: now,
+				Created_at:      now,
+			}
+			err := d.Store.WebhookDeliveries.Create(ctx, &delivery)
+			if err != nil && !errors.Is(err, store.ErrConflict) {
+				return err
+			}
+		}
+		if err := d.Store.WebhookEvents.MarkDispatched(ctx, event.Event_id, time.Now()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deliveryID(eventId string, subscriptionId string) string {
+	sum := sha256.Sum256([]byte(eventId + "/" + subscriptionId))
+	return "dlv_" + hex.EncodeToString(sum[:12])
+}
+
+// deliver makes one attempt at delivery and stores the outcome
+func (d *Dispatcher) deliver(ctx context.Context, delivery *models.WebhookDelivery) error {
+	now := time.Now()
+	subscription, err := d.Store.WebhookSubscriptions.Get(ctx, delivery.Subscription_id)
+	if errors.Is(err, store.ErrNotFound) {
+		delivery.Status = models.WebhookDead
+		delivery.Last_error = "subscription was deleted"
+		return d.Store.WebhookDeliveries.Update(ctx, delivery)
+	}
+	if err != nil {
+		return d.postpone(ctx, delivery, err)
+	}
+	event, err := d.Store.WebhookEvents.Get(ctx, delivery.Event_id)
+	if err != nil {
+		return d.postpone(ctx, delivery, err)
+	}
+
+	delivery.Attempts++
+	delivery.Last_attempt_at = &now
+	statusCode, sendErr := d.send(ctx, subscription, event)
+	delivery.Last_status_code = statusCode
+	switch {
+	case sendErr == nil:
+		delivery.Status = models.WebhookDelivered
+		delivery.Delivered_at = &now
+		delivery.Last_error = ""
+	case delivery.Attempts >= MaxAttempts:
+		delivery.Status = models.WebhookDead
+		delivery.Last_error = sendErr.Error()
+		slog.Warn("webhook delivery is dead", "delivery_id", delivery.Delivery_id,
+			"subscription_id", delivery.Subscription_id, "attempts", delivery.Attempts, "error", sendErr)
+	default:
+		delivery.Next_attempt_at = now.Add(Backoff(delivery.Attempts))
+		delivery.Last_error = sendErr.Error()
+		slog.Info("webhook delivery failed", "delivery_id", delivery.Delivery_id,
+			"subscription_id", delivery.Subscription_id, "attempts", delivery.Attempts, "error", sendErr)
+	}
+	return d.Store.WebhookDeliveries.Update(ctx, delivery)
+}
+
+// postpone records err on a delivery that could not be attempted and retries
+// it after a backoff. It is not counted as an attempt.
+func (d *Dispatcher) postpone(ctx context.Context, delivery *models.WebhookDelivery, err error) error {
+	delivery.Last_error = err.Error()
+	delivery.Next_attempt_at = time.Now().Add(Backoff(max(delivery.Attempts, 1)))
+	if updateErr := d.Store.WebhookDeliveries.Update(ctx, delivery); updateErr != nil {
+		return errors.Join(err, updateErr)
+	}
+	return err
+}
+
+// send posts the signed event to the subscription's URL. Any 2xx response is a success.
+func (d *Dispatcher) send(ctx context.Context, subscription *models.WebhookSubscription, event *models.WebhookEvent) (int, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now()
+	signature, err := Sign(subscription.Secret, event.Event_id, timestamp, body)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "go-jwt-webhooks")
+	req.Header.Set(HeaderID, event.Event_id)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp.Unix(), 10))
+	req.Header.Set(HeaderSignature, signature)
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
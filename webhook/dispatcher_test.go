@@ -0,0 +1,342 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arunprasad2002/go-jwt/models"
+	"github.com/arunprasad2002/go-jwt/store"
+)
+
+// received is a request the receiver got
+type received struct {
+	header http.Header
+	body   []byte
+}
+
+// receiver is a local webhook endpoint answering with status
+func receiver(t *testing.T, status int) (*httptest.Server, func() []received) {
+	var (
+		mu       sync.Mutex
+		requests []received
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, received{header: r.Header.Clone(), body: body})
+		mu.Unlock()
+		if status == http.StatusFound {
+			w.Header().Set("Location", "http://example.com/elsewhere")
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []received {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]received(nil), requests...)
+	}
+}
+
+// subscribe stores a subscription of url to eventTypes and returns it
+func subscribe(t *testing.T, st *store.Store, url string, eventTypes ...string) *models.WebhookSubscription {
+	t.Helper()
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	subscription := &models.WebhookSubscription{
+		Subscription_id: "whs_1",
+		Url:             url,
+		Events:          eventTypes,
+		Secret:          secret,
+		Created_at:      time.Now(),
+	}
+	if err := st.WebhookSubscriptions.Create(context.Background(), subscription); err != nil {
+		t.Fatal(err)
+	}
+	return subscription
+}
+
+// onlyDelivery returns the one delivery of the store
+func onlyDelivery(t *testing.T, st *store.Store) models.WebhookDelivery {
+	t.Helper()
+	deliveries, err := st.WebhookDeliveries.List(context.Background(), "", "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("%d deliveries, want 1", len(deliveries))
+	}
+	return deliveries[0]
+}
+
+func TestDispatch(t *testing.T) {
+	tests := []struct {
+		name           string
+		status         int
+		subscribedTo   string
+		wantRequests   int
+		wantStatus     string
+		wantStatusCode int
+	}{
+		{name: "delivered", status: http.StatusNoContent, subscribedTo: EventUserCreated, wantRequests: 1, wantStatus: models.WebhookDelivered, wantStatusCode: http.StatusNoContent},
+		{name: "receiver failing", status: http.StatusInternalServerError, subscribedTo: EventUserCreated, wantRequests: 1, wantStatus: models.WebhookPending, wantStatusCode: http.StatusInternalServerError},
+		{name: "redirect not followed", status: http.StatusFound, subscribedTo: EventUserCreated, wantRequests: 1, wantStatus: models.WebhookPending, wantStatusCode: http.StatusFound},
+		{name: "not subscribed", status: http.StatusNoContent, subscribedTo: EventUserDeleted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			st := store.NewMemoryStore()
+			server, requests := receiver(t, tt.status)
+			subscription := subscribe(t, st, server.URL, tt.subscribedTo)
+			user := models.User{User_id: stringPointer("u1"), Email: stringPointer("ada@example.com")}
+			if err := Publish(ctx, st.WebhookEvents, EventUserCreated, UserData(user)); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := NewDispatcher(st, true).Dispatch(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			got := requests()
+			if len(got) != tt.wantRequests {
+				t.Fatalf("receiver got %d requests, want %d", len(got), tt.wantRequests)
+			}
+			if tt.wantRequests == 0 {
+				return
+			}
+			checkSignature(t, subscription.Secret, got[0])
+			var payload struct {
+				Type string `json:"type"`
+				Data struct {
+					User models.UserResponse `json:"user"`
+				} `json:"data"`
+			}
+			if err := json.Unmarshal(got[0].body, &payload); err != nil {
+				t.Fatal(err)
+			}
+			if payload.Type != EventUserCreated || payload.Data.User.Email != "ada@example.com" {
+				t.Errorf("payload = %s", got[0].body)
+			}
+
+			delivery := onlyDelivery(t, st)
+			if delivery.Status != tt.wantStatus || delivery.Attempts != 1 || delivery.Last_status_code != tt.wantStatusCode {
+				t.Errorf("delivery = %+v", delivery)
+			}
+			if tt.wantStatus == models.WebhookPending && !delivery.Next_attempt_at.After(time.Now()) {
+				t.Errorf("next attempt at %v, want a retry later", delivery.Next_attempt_at)
+			}
+		})
+	}
+}
+
+func TestDispatchMarksDeliveryDead(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemoryStore()
+	server, requests := receiver(t, http.StatusServiceUnavailable)
+	subscribe(t, st, server.URL, EventUserCreated)
+	if err := Publish(ctx, st.WebhookEvents, EventUserCreated, UserEventData{}); err != nil {
+		t.Fatal(err)
+	}
+	dispatcher := NewDispatcher(st, true)
+	if err := dispatcher.Dispatch(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Make the last attempt due now instead of after the backoff
+	delivery := onlyDelivery(t, st)
+	delivery.Attempts = MaxAttempts - 1
+	delivery.Next_attempt_at = time.Now()
+	if err := st.WebhookDeliveries.Update(ctx, &delivery); err != nil {
+		t.Fatal(err)
+	}
+	if err := dispatcher.Dispatch(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	delivery = onlyDelivery(t, st)
+	if delivery.Status != models.WebhookDead || delivery.Attempts != MaxAttempts {
+		t.Errorf("delivery = %+v, want DEAD after %d attempts", delivery, MaxAttempts)
+	}
+	if len(requests()) != 2 {
+		t.Errorf("receiver got %d requests, want 2", len(requests()))
+	}
+}
+
+func TestDispatchDeliversConcurrently(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemoryStore()
+	const receivers = 3
+
+	// Each receiver only answers once all of them were called
+	var arrived sync.WaitGroup
+	arrived.Add(receivers)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived.Done()
+		waited := make(chan struct{})
+		go func() {
+			arrived.Wait()
+			close(waited)
+		}()
+		select {
+		case <-waited:
+			w.WriteHeader(http.StatusNoContent)
+		case <-time.After(5 * time.Second):
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(server.Close)
+	for i := 0; i < receivers; i++ {
+		subscription := &models.WebhookSubscription{
+			Subscription_id: "whs_" + strconv.Itoa(i),
+			Url:             server.URL,
+			Events:          []string{EventUserCreated},
+			Created_at:      time.Now(),
+		}
+		if err := st.WebhookSubscriptions.Create(ctx, subscription); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Publish(ctx, st.WebhookEvents, EventUserCreated, UserEventData{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := NewDispatcher(st, true).Dispatch(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	deliveries, err := st.WebhookDeliveries.List(ctx, "", "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != receivers {
+		t.Fatalf("%d deliveries, want %d", len(deliveries), receivers)
+	}
+	for _, delivery := range deliveries {
+		if delivery.Status != models.WebhookDelivered {
+			t.Errorf("delivery = %+v, want it delivered", delivery)
+		}
+	}
+}
+
+func TestDispatchContinuesAfterFailedDelivery(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemoryStore()
+	server, requests := receiver(t, http.StatusNoContent)
+	subscribe(t, st, server.URL, EventUserCreated)
+	if err := Publish(ctx, st.WebhookEvents, EventUserCreated, UserEventData{}); err != nil {
+		t.Fatal(err)
+	}
+	// A delivery whose event cannot be loaded
+	broken := &models.WebhookDelivery{
+		Delivery_id:     "dlv_broken",
+		Event_id:        "evt_missing",
+		Event_type:      EventUserCreated,
+		Subscription_id: "whs_1",
+		Status:          models.WebhookPending,
+		Next_attempt_at: time.Now(),
+		Created_at:      time.Now(),
+	}
+	if err := st.WebhookDeliveries.Create(ctx, broken); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := NewDispatcher(st, true).Dispatch(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requests()) != 1 {
+		t.Errorf("receiver got %d requests, want 1", len(requests()))
+	}
+	got, err := st.WebhookDeliveries.Get(ctx, "dlv_broken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != models.WebhookPending || got.Attempts != 0 || got.Last_error == "" || !got.Next_attempt_at.After(time.Now()) {
+		t.Errorf("delivery = %+v, want its error recorded and a retry later", got)
+	}
+}
+
+func TestDispatchRefusesPrivateAddresses(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemoryStore()
+	server, requests := receiver(t, http.StatusNoContent)
+	subscribe(t, st, server.URL, EventUserCreated)
+	if err := Publish(ctx, st.WebhookEvents, EventUserCreated, UserEventData{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := NewDispatcher(st, false).Dispatch(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requests()) != 0 {
+		t.Fatal("a receiver on a loopback address was called")
+	}
+	delivery := onlyDelivery(t, st)
+	if delivery.Status != models.WebhookPending || !strings.Contains(delivery.Last_error, ErrPrivateAddress.Error()) {
+		t.Errorf("delivery = %+v, want it refused for the private address", delivery)
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		url           string
+		allowInsecure bool
+		want          error
+		wantErr       bool
+	}{
+		{url: "https://hooks.example.com/go-jwt"},
+		{url: "http://hooks.example.com/go-jwt", want: ErrInsecureURL, wantErr: true},
+		{url: "http://localhost:9000/hook", allowInsecure: true},
+		{url: "https://localhost/hook", want: ErrPrivateAddress, wantErr: true},
+		{url: "https://127.0.0.1/hook", want: ErrPrivateAddress, wantErr: true},
+		{url: "https://10.0.0.5/hook", want: ErrPrivateAddress, wantErr: true},
+		{url: "https://169.254.169.254/latest/meta-data", want: ErrPrivateAddress, wantErr: true},
+		{url: "https://[::1]/hook", want: ErrPrivateAddress, wantErr: true},
+		{url: "https://[::ffff:192.168.1.1]/hook", want: ErrPrivateAddress, wantErr: true},
+		{url: "https://100.64.0.1/hook", want: ErrPrivateAddress, wantErr: true},
+		{url: "https://93.184.216.34/hook"},
+		{url: "ftp://hooks.example.com/go-jwt", wantErr: true},
+		{url: "/relative", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := CheckURL(tt.url, tt.allowInsecure)
+			if (err != nil) != tt.wantErr || (tt.want != nil && !errors.Is(err, tt.want)) {
+				t.Errorf("CheckURL(%q) = %v, want %v", tt.url, err, tt.want)
+			}
+		})
+	}
+}
+
+// checkSignature verifies a request the way receivers are told to
+func checkSignature(t *testing.T, secret string, r received) {
+	t.Helper()
+	unix, err := strconv.ParseInt(r.header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := Sign(secret, r.header.Get(HeaderID), time.Unix(unix, 0), r.body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.header.Get(HeaderSignature) != want {
+		t.Errorf("signature = %q, want %q", r.header.Get(HeaderSignature), want)
+	}
+}
+
+func stringPointer(s string) *string {
+	return &s
+}
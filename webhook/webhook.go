@@ -0,0 +1,119 @@
+// Package webhook tells other systems about user lifecycle events.
+//
+// Events are written to an outbox in the same transaction as the change they
+// describe, so they are sent exactly when the change is committed. A
+// Dispatcher fans each event out to the subscriptions that want it and sends
+// it, signed with the subscription's secret following the Standard Webhooks
+// scheme. Failed deliveries are retried with exponential backoff and end up
+// DEAD after MaxAttempts, where they stay until an admin redelivers them.
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arunprasad2002/go-jwt/models"
+	"github.com/arunprasad2002/go-jwt/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Event types sent to subscribers.
+const (
+	EventUserCreated           = "user.created"
+	EventUserEmailChanged      = "user.email_changed"
+	EventUserDeactivated       = "user.deactivated"
+	EventUserReactivated       = "user.reactivated"
+	EventUserDeletionScheduled = "user.deletion_scheduled"
+	EventUserIdentityLinked    = "user.identity_linked"
+	EventUserDeleted           = "user.deleted"
+)
+
+// EventTypes lists every event type a subscription may ask for.
+var EventTypes = []string{
+	EventUserCreated,
+	EventUserEmailChanged,
+	EventUserDeactivated,
+	EventUserReactivated,
+	EventUserDeletionScheduled,
+	EventUserIdentityLinked,
+	EventUserDeleted,
+}
+
+// Headers of a webhook request.
+const (
+	HeaderID        = "webhook-id"
+	HeaderTimestamp = "webhook-timestamp"
+	HeaderSignature = "webhook-signature"
+)
+
+// secretPrefix marks webhook signing secrets
+const secretPrefix = "whsec_"
+
+// UserEventData is the data of user events.
+type UserEventData struct {
+	User models.UserResponse `json:"user"`
+	// Previous_email is set on user.email_changed
+	Previous_email string `json:"previous_email,omitempty"`
+	// Method is how the user signed up or which identity was linked
+	Method string `json:"method,omitempty"`
+}
+
+// UserData returns the event data for user. Subscribers see what an admin would.
+func UserData(user models.User) UserEventData {
+	return UserEventData{User: models.NewUserResponse(user, models.VisibilityAdmin)}
+}
+
+// IsEventType reports whether eventType is one of EventTypes
+func IsEventType(eventType string) bool {
+	for _, t := range EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Publish adds an event to the outbox. Call it with the events store of the
+// transaction that makes the change the event describes.
+func Publish(ctx context.Context, events store.WebhookEventStore, eventType string, data interface{}) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	event := models.WebhookEvent{
+		Event_id:   "evt_" + primitive.NewObjectID().Hex(),
+		Type:       eventType,
+		Created_at: time.Now().UTC().Truncate(time.Millisecond),
+		Data:       encoded,
+	}
+	return events.Create(ctx, &event)
+}
+
+// NewSecret returns a new signing secret for a subscription.
+func NewSecret() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return secretPrefix + base64.StdEncoding.EncodeToString(key), nil
+}
+
+// Sign returns the webhook-signature header for a payload: "v1," and the base64
+// HMAC-SHA256 of "id.timestamp.body" keyed with the decoded secret.
+func Sign(secret string, id string, timestamp time.Time, body []byte) (string, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(secret, secretPrefix))
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id + "." + strconv.FormatInt(timestamp.Unix(), 10) + "."))
+	mac.Write(body)
+	return "v1," + base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+}